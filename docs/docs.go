@@ -18,9 +18,161 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/change-password": {
-            "post": {
-                "description": "Allows an authenticated user to change their password.",
+        "/audit": {
+            "get": {
+                "description": "Returns the audit log entries matching the filters, newest first, a page at a time.\nPass the returned nextBefore as the before parameter, together with the same filters, to get the next page.\nRequires the admin role.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "audit"
+                ],
+                "summary": "List the audit log",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only entries of the user with this username",
+                        "name": "actor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries of this action, e.g. report.deleted",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries about this kind of target, e.g. report",
+                        "name": "targetType",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries about the target with this ID or username",
+                        "name": "targetId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Recorded at or after, RFC 3339 timestamp or YYYY-MM-DD",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Recorded before, RFC 3339 timestamp or YYYY-MM-DD",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only entries older than the one with this ID",
+                        "name": "before",
+                        "in": "query"
+                    },
+                    {
+                        "maximum": 500,
+                        "minimum": 1,
+                        "type": "integer",
+                        "default": 100,
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/db.AuditPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/audit/export": {
+            "get": {
+                "description": "Downloads every audit log entry matching the filters, newest first, as a JSON file. Requires the admin role.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "audit"
+                ],
+                "summary": "Export the audit log",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only entries of the user with this username",
+                        "name": "actor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries of this action, e.g. report.deleted",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries about this kind of target, e.g. report",
+                        "name": "targetType",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries about the target with this ID or username",
+                        "name": "targetId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Recorded at or after, RFC 3339 timestamp or YYYY-MM-DD",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Recorded before, RFC 3339 timestamp or YYYY-MM-DD",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/db.AuditEntry"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/changepassword": {
+            "put": {
+                "description": "Allows an authenticated user to change their password.\nThe new password is sent in plain text in the password field and hashed by the server.",
                 "consumes": [
                     "application/json"
                 ],
@@ -31,9 +183,23 @@ const docTemplate = `{
                     "user"
                 ],
                 "summary": "Change user password",
+                "parameters": [
+                    {
+                        "description": "New password",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.UserJSON"
+                        }
+                    }
+                ],
                 "responses": {
-                    "303": {
-                        "description": "See Other"
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
                     },
                     "500": {
                         "description": "Internal Server Error"
@@ -41,9 +207,26 @@ const docTemplate = `{
                 }
             }
         },
+        "/events": {
+            "get": {
+                "description": "Streams changes as Server-Sent Events. The event name is the type of the change\n(report.created, report.edited, report.solved, report.reopened, report.deleted, report.restored or update.posted)\nand the data is the report or incident update as JSON. Reports moved to or restored from the trash\nonly come with their ID, as in {\"id\": 1}, since the trash is only visible to admins.\nWho created reports, updates and maintenances is left out, as on the rest of the public API.\nA comment is sent every 25 seconds to keep the stream open.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "reports"
+                ],
+                "summary": "Stream report changes",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    }
+                }
+            }
+        },
         "/login": {
             "post": {
-                "description": "Authenticate a user using their login credentials.\nPassword: sha256(sha256(password + salt) + pepper)",
+                "description": "Authenticate a user using their login credentials.\nThe password is sent in plain text, so the app has to be served over TLS.\nAfter a few failed logins from the same address or as the same username the next attempt is delayed,\ntwice as long after every further failure, and after 10 failures in a row the username is locked out\nfor an hour unless an admin unlocks it. Unknown usernames are treated the same way as real ones.\nFor users with two-factor authentication the password only starts the login: the Location header points\nto the page asking for the code, which is sent to /login/twofactor.",
                 "consumes": [
                     "application/json"
                 ],
@@ -70,7 +253,53 @@ const docTemplate = `{
                         "description": "OK"
                     },
                     "403": {
-                        "description": "Forbidden"
+                        "description": "Wrong username or password, or a disabled account"
+                    },
+                    "429": {
+                        "description": "Too many failed logins, retry after the number of seconds in the Retry-After header"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/login/twofactor": {
+            "post": {
+                "description": "The second step of logging in as a user with two-factor authentication, within 5 minutes after /login\naccepted the password and pointed to the page asking for the code.\nTakes a code from the authenticator app or one of the recovery codes, each of which works only once.\nWrong codes count as failed logins, see /login.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Finish a login with two-factor authentication",
+                "parameters": [
+                    {
+                        "description": "Code from the authenticator app or a recovery code",
+                        "name": "code",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.TwoFactorCode"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "401": {
+                        "description": "The password wasn't accepted in the last 5 minutes, log in again"
+                    },
+                    "403": {
+                        "description": "Wrong code, or a disabled account"
+                    },
+                    "429": {
+                        "description": "Too many failed logins, retry after the number of seconds in the Retry-After header"
                     },
                     "500": {
                         "description": "Internal Server Error"
@@ -79,7 +308,7 @@ const docTemplate = `{
             }
         },
         "/logout": {
-            "get": {
+            "post": {
                 "description": "Log out the currently authenticated user by invalidating the session.",
                 "produces": [
                     "text/plain"
@@ -92,179 +321,2604 @@ const docTemplate = `{
                     "303": {
                         "description": "See Other"
                     },
+                    "403": {
+                        "description": "Forbidden"
+                    },
                     "500": {
                         "description": "Internal Server Error"
                     }
                 }
             }
         },
-        "/pepper": {
+        "/maintenances": {
             "get": {
-                "description": "Generates and returns a one time salt used to login.",
+                "description": "Returns the maintenance windows ordered by start, only the ones with the given statuses with ?status=,\ne.g. ?status=scheduled,in_progress for the upcoming and ongoing ones.",
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
-                    "user"
+                    "maintenances"
+                ],
+                "summary": "List maintenance windows",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Comma-separated statuses: scheduled, in_progress, completed, cancelled",
+                        "name": "status",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Get one time salt",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/db.Maintenance"
+                            }
                         }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
                     }
                 }
-            }
-        },
-        "/reports": {
+            },
             "post": {
-                "description": "Adds a new report to the system",
+                "description": "Announces planned downtime. The maintenance is scheduled until it starts, then in progress until it ends\nand completed afterwards, which the scheduler takes care of. Requires the editor role.",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
-                    "reports"
+                    "maintenances"
                 ],
-                "summary": "Add a new report",
+                "summary": "Schedule a maintenance window",
                 "parameters": [
                     {
-                        "description": "New Report",
-                        "name": "report",
+                        "description": "New maintenance",
+                        "name": "maintenance",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/db.NewReport"
+                            "$ref": "#/definitions/db.NewMaintenance"
                         }
                     }
                 ],
                 "responses": {
                     "201": {
-                        "description": "Created"
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/db.Maintenance"
+                        }
                     },
                     "400": {
                         "description": "Bad Request"
                     },
+                    "403": {
+                        "description": "Forbidden"
+                    },
                     "500": {
                         "description": "Internal Server Error"
                     }
                 }
             }
         },
-        "/reports/{id}": {
-            "put": {
-                "description": "Edits the details of an existing report",
-                "consumes": [
-                    "multipart/form-data"
-                ],
+        "/maintenances/{id}": {
+            "get": {
+                "description": "Returns a single maintenance window.",
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
-                    "reports"
+                    "maintenances"
                 ],
-                "summary": "Edit an existing report",
+                "summary": "Get a maintenance window",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Report ID",
+                        "description": "Maintenance ID",
                         "name": "id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Title",
-                        "name": "title",
-                        "in": "formData",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Content",
-                        "name": "content",
-                        "in": "formData",
-                        "required": true
-                    },
-                    {
-                        "type": "boolean",
-                        "description": "Is Solved",
-                        "name": "isSolved",
-                        "in": "formData",
-                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/db.Maintenance"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found"
                     },
                     "500": {
                         "description": "Internal Server Error"
                     }
                 }
             },
-            "delete": {
-                "description": "Deletes a report from the system",
+            "put": {
+                "description": "Replaces the title, description and schedule of a maintenance which isn't completed or cancelled yet.\nMoving the start of one in progress to the future makes it scheduled again. Requires the editor role.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
-                    "reports"
+                    "maintenances"
                 ],
-                "summary": "Delete a report",
+                "summary": "Edit a maintenance window",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Report ID",
+                        "description": "Maintenance ID",
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "Maintenance",
+                        "name": "maintenance",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.NewMaintenance"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/db.Maintenance"
+                        }
                     },
-                    "500": {
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "409": {
+                        "description": "The maintenance is already completed or cancelled"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/maintenances/{id}/cancel": {
+            "post": {
+                "description": "Calls off a maintenance which is scheduled or in progress. Requires the editor role.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "maintenances"
+                ],
+                "summary": "Cancel a maintenance window",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maintenance ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/db.Maintenance"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "409": {
+                        "description": "The maintenance is already completed or cancelled"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/reports": {
+            "get": {
+                "description": "Returns reports matching the filters, a page at a time.\nPass the returned nextCursor as the cursor parameter, together with the same filters, to get the next page.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reports"
+                ],
+                "summary": "List reports",
+                "parameters": [
+                    {
+                        "enum": [
+                            "open",
+                            "solved",
+                            "all"
+                        ],
+                        "type": "string",
+                        "description": "Only open or solved reports",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Text searched for in the title and content",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only reports with one of the comma separated severities, e.g. major,critical",
+                        "name": "severity",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only reports attached to the service with this ID",
+                        "name": "service",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created at or after, RFC 3339 timestamp or YYYY-MM-DD",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created before, RFC 3339 timestamp or YYYY-MM-DD",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "id",
+                            "created_at",
+                            "title"
+                        ],
+                        "type": "string",
+                        "default": "id",
+                        "description": "Sort field",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "default": "asc",
+                        "description": "Sort order",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "maximum": 200,
+                        "minimum": 1,
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the next page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/db.ReportPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "post": {
+                "description": "Adds a new report to the system",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reports"
+                ],
+                "summary": "Add a new report",
+                "parameters": [
+                    {
+                        "description": "New Report",
+                        "name": "report",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.NewReport"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/db.CreatedReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/reports/search": {
+            "get": {
+                "description": "Returns the reports containing every word of the query, or words starting with them,\nin the title, content or updates, open ones first and then newest first.\nEach result comes with HTML snippets of the matching parts, with the matches enclosed in \u003cmark\u003e.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reports"
+                ],
+                "summary": "Search reports",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Words to search for",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "maximum": 500,
+                        "minimum": 1,
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Maximum number of results",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/db.SearchResult"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/reports/trash": {
+            "get": {
+                "description": "Returns the deleted reports which haven't been purged yet, oldest first.\nRequires the admin role.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reports"
+                ],
+                "summary": "List the reports in the trash",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/db.Report"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/reports/{id}": {
+            "get": {
+                "description": "Returns a single report.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reports"
+                ],
+                "summary": "Get a report",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Report ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/db.Report"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "put": {
+                "description": "Edits the details of an existing report",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "reports"
+                ],
+                "summary": "Edit an existing report",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Report ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Title",
+                        "name": "title",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Content",
+                        "name": "content",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Is Solved",
+                        "name": "isSolved",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "maintenance",
+                            "minor",
+                            "major",
+                            "critical"
+                        ],
+                        "type": "string",
+                        "description": "Severity, left unchanged when missing",
+                        "name": "severity",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "integer"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "IDs of the affected services, left unchanged when the field is missing. An empty value detaches all services.",
+                        "name": "services",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "delete": {
+                "description": "Moves a report to the trash, which hides it everywhere else. It can be restored from there\nuntil it's purged for good, trash_retention_days after it was deleted",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "reports"
+                ],
+                "summary": "Delete a report",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Report ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/reports/{id}/events": {
+            "get": {
+                "description": "Returns every change made to a report, oldest first. Also works for deleted reports.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reports"
+                ],
+                "summary": "Get report history",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Report ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/db.ReportEvent"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/reports/{id}/restore": {
+            "post": {
+                "description": "Brings a report back from the trash, as it was when it was deleted.\nRequires the admin role.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reports"
+                ],
+                "summary": "Restore a deleted report",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Report ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/db.Report"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "The report isn't in the trash"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/reports/{id}/updates": {
+            "get": {
+                "description": "Returns the updates posted about a report, newest first.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reports"
+                ],
+                "summary": "List report updates",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Report ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/db.ReportUpdate"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "post": {
+                "description": "Appends an update to a report. The resolved status also solves the report, while any other status reopens a solved one.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reports"
+                ],
+                "summary": "Post a report update",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Report ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Update",
+                        "name": "update",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.NewReportUpdate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/db.ReportUpdate"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/services": {
+            "get": {
+                "description": "Returns every service reports can be attached to, ordered by group and name.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "services"
+                ],
+                "summary": "List services",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/db.Service"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "post": {
+                "description": "Adds a service to the catalog. Requires the admin role.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "services"
+                ],
+                "summary": "Create a service",
+                "parameters": [
+                    {
+                        "description": "New service",
+                        "name": "service",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.NewService"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/db.Service"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/services/{id}": {
+            "get": {
+                "description": "Returns a single service.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "services"
+                ],
+                "summary": "Get a service",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Service ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/db.Service"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "put": {
+                "description": "Replaces the name, description, group and owner of a service. Requires the admin role.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "services"
+                ],
+                "summary": "Update a service",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Service ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Service",
+                        "name": "service",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.NewService"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "delete": {
+                "description": "Removes a service from the catalog and detaches it from its reports. Requires the admin role.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "services"
+                ],
+                "summary": "Delete a service",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Service ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/stats": {
+            "get": {
+                "description": "Returns the downtime, uptime, number of incidents and mean time to recovery over the last 24 hours,\n7, 30 and 90 days, together with the daily history of the last 90 days, for all incidents and for each service.\nEvery period a report stays open is an incident, and maintenance reports aren't counted.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "stats"
+                ],
+                "summary": "Get downtime statistics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/stats.Stats"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/subscribers": {
+            "post": {
+                "description": "Sends a link confirming the subscription to the address. Nothing else is sent before it's opened.\nThe response is the same whether the address is new, unconfirmed or already subscribed,\nand the confirmation is sent again at most every 10 minutes.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "subscribers"
+                ],
+                "summary": "Subscribe to notifications",
+                "parameters": [
+                    {
+                        "description": "Email address",
+                        "name": "subscription",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/notify.NewSubscription"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Emails are disabled"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/subscribers/confirm": {
+            "post": {
+                "description": "Confirms the subscription with the token from the link sent to the address. Confirming it again does nothing.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "subscribers"
+                ],
+                "summary": "Confirm a subscription",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Token from the confirmation link",
+                        "name": "token",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/subscribers/unsubscribe": {
+            "post": {
+                "description": "Removes the subscriber the token belongs to. It's also the one-click unsubscribe address\ngiven to mail clients in the List-Unsubscribe header of every notification.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "subscribers"
+                ],
+                "summary": "Unsubscribe from notifications",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Token from the unsubscribe link",
+                        "name": "token",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/tokens": {
+            "get": {
+                "description": "Returns the personal API tokens of the logged-in user, without the tokens themselves.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tokens"
+                ],
+                "summary": "List API tokens",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/db.Token"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a personal API token. The token is only returned in this response.\nSend it as \"Authorization: Bearer \u003ctoken\u003e\" to call the API without a session.\nThe scope is the highest role the token can act as and defaults to the role of the user.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tokens"
+                ],
+                "summary": "Create an API token",
+                "parameters": [
+                    {
+                        "description": "New token",
+                        "name": "token",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.NewToken"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/db.CreatedToken"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/tokens/{id}": {
+            "delete": {
+                "description": "Revokes one of the personal API tokens of the logged-in user.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "tokens"
+                ],
+                "summary": "Revoke an API token",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Token ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/twofactor/disable": {
+            "post": {
+                "description": "Turns off two-factor authentication for the current user and forgets the secret and the recovery codes.\nTakes a code from the authenticator app or a recovery code, so that an unattended session can't do it.\nRefused while the admins require two-factor authentication. Not available with an API token.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Disable two-factor authentication",
+                "parameters": [
+                    {
+                        "description": "Code from the authenticator app or a recovery code",
+                        "name": "code",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.TwoFactorCode"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Wrong code"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "409": {
+                        "description": "Two-factor authentication isn't enabled"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/twofactor/enable": {
+            "post": {
+                "description": "Turns on two-factor authentication with the secret from /twofactor/setup, once a code from the authenticator app\nconfirms it was set up right, and returns the recovery codes. They are shown only once.\nNot available with an API token.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Enable two-factor authentication",
+                "parameters": [
+                    {
+                        "description": "Code from the authenticator app",
+                        "name": "code",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.TwoFactorCode"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/db.RecoveryCodes"
+                        }
+                    },
+                    "400": {
+                        "description": "Wrong code, or the setup wasn't started"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "409": {
+                        "description": "Two-factor authentication is already enabled"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/twofactor/policy": {
+            "get": {
+                "description": "Tells whether every user has to set up two-factor authentication. Requires the admin role.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get the two-factor policy",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/db.TwoFactorPolicy"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "put": {
+                "description": "Makes two-factor authentication required for every user or optional. Requires the admin role.\nWhile it's required, users without it can only set it up or log out, and nobody can turn it off for themselves.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Change the two-factor policy",
+                "parameters": [
+                    {
+                        "description": "Policy",
+                        "name": "policy",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.TwoFactorPolicy"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/twofactor/recovery-codes": {
+            "post": {
+                "description": "Replaces the recovery codes of the current user with new ones, which are shown only once.\nTakes a code from the authenticator app or a recovery code. Not available with an API token.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Generate new recovery codes",
+                "parameters": [
+                    {
+                        "description": "Code from the authenticator app or a recovery code",
+                        "name": "code",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.TwoFactorCode"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/db.RecoveryCodes"
+                        }
+                    },
+                    "400": {
+                        "description": "Wrong code"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "409": {
+                        "description": "Two-factor authentication isn't enabled"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/twofactor/setup": {
+            "post": {
+                "description": "Generates a new TOTP secret for the current user and returns it with the provisioning URI to show as a QR code.\nTwo-factor authentication is only turned on by /twofactor/enable, once a code from the authenticator app confirms the setup.\nNot available with an API token.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "user"
+                ],
+                "summary": "Start setting up two-factor authentication",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/db.TwoFactorSetup"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "409": {
+                        "description": "Two-factor authentication is already enabled"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/users": {
+            "get": {
+                "description": "Returns all accounts with their roles. Requires the admin role.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List users",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/db.User"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a new account with the given role. Requires the admin role.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Create a user",
+                "parameters": [
+                    {
+                        "description": "New user",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.NewUser"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/users/lockouts": {
+            "get": {
+                "description": "Returns the usernames locked out after too many failed logins in a row, with when the lockout ends.\nUsernames which don't belong to any account are locked out too, so that lockouts don't reveal which ones exist.\nRequires the admin role.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List locked out usernames",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/db.LoginThrottle"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/users/{username}": {
+            "put": {
+                "description": "Renames an account, changes its role or disables it. Requires the admin role.\nThe last enabled admin can't be demoted nor disabled.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Update a user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Changed fields",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.UserUpdate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/users/{username}/lockout": {
+            "delete": {
+                "description": "Lifts the lockout of a username after too many failed logins and forgets its failed logins.\nFailed logins counted against client addresses are left alone. Requires the admin role.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Unlock a username",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "No failed logins are recorded for the username"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/users/{username}/password": {
+            "post": {
+                "description": "Replaces the password of an account with a random one and returns it. Requires the admin role.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Reset a user's password",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/db.PasswordReset"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/users/{username}/twofactor": {
+            "delete": {
+                "description": "Turns off two-factor authentication of an account and forgets its secret and recovery codes,\nso that the user can log in with the password alone and set it up again. Requires the admin role.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Reset a user's two-factor authentication",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/webhooks": {
+            "get": {
+                "description": "Returns every webhook together with its secret. Requires the admin role.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List webhooks",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/db.Webhook"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "post": {
+                "description": "Adds a webhook receiving the given types of events, or every type when none are given.\nEach delivery is a POST with a JSON body signed in the X-Noticeboard-Signature header\nas \"sha256=\" followed by the hex HMAC-SHA256 of the body keyed with the secret.\nA secret is generated when none is given. Requires the admin role.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Create a webhook",
+                "parameters": [
+                    {
+                        "description": "New webhook",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.NewWebhook"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/db.Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}": {
+            "put": {
+                "description": "Replaces the URL, events and state of a webhook, and its secret if one is given. Requires the admin role.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Update a webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Webhook",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/db.NewWebhook"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "delete": {
+                "description": "Removes a webhook together with its deliveries, including the pending ones. Requires the admin role.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Delete a webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}/deliveries": {
+            "get": {
+                "description": "Returns the 50 most recent deliveries to a webhook, newest first. Requires the admin role.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List webhook deliveries",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/db.WebhookDelivery"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}/deliveries/{delivery}/redeliver": {
+            "post": {
+                "description": "Queues a new delivery with the same event and payload as a past one. It's sent within a few seconds\nand retried like any other delivery. Requires the admin role.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Redeliver a webhook delivery",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Delivery ID",
+                        "name": "delivery",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/db.WebhookDelivery"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
                         "description": "Internal Server Error"
                     }
                 }
             }
+        }
+    },
+    "definitions": {
+        "db.AuditAction": {
+            "type": "string",
+            "enum": [
+                "user.login",
+                "user.login_failed",
+                "user.logout",
+                "user.password_changed",
+                "user.created",
+                "user.updated",
+                "user.password_reset",
+                "user.login_blocked",
+                "user.locked",
+                "user.unlocked",
+                "user.2fa_enabled",
+                "user.2fa_disabled",
+                "user.2fa_reset",
+                "user.2fa_failed",
+                "user.recovery_codes_generated",
+                "user.recovery_code_used",
+                "report.created",
+                "report.edited",
+                "report.deleted",
+                "report.restored",
+                "update.posted",
+                "maintenance.scheduled",
+                "maintenance.edited",
+                "maintenance.cancelled",
+                "service.created",
+                "service.updated",
+                "service.deleted",
+                "token.created",
+                "token.revoked",
+                "webhook.created",
+                "webhook.updated",
+                "webhook.deleted",
+                "webhook.redelivered",
+                "settings.updated"
+            ],
+            "x-enum-varnames": [
+                "AuditLogin",
+                "AuditLoginFailed",
+                "AuditLogout",
+                "AuditPasswordChanged",
+                "AuditUserCreated",
+                "AuditUserUpdated",
+                "AuditPasswordReset",
+                "AuditLoginBlocked",
+                "AuditUserLocked",
+                "AuditUserUnlocked",
+                "AuditTwoFactorEnabled",
+                "AuditTwoFactorDisabled",
+                "AuditTwoFactorReset",
+                "AuditTwoFactorFailed",
+                "AuditRecoveryCodesGenerated",
+                "AuditRecoveryCodeUsed",
+                "AuditReportCreated",
+                "AuditReportEdited",
+                "AuditReportDeleted",
+                "AuditReportRestored",
+                "AuditUpdatePosted",
+                "AuditMaintenanceScheduled",
+                "AuditMaintenanceEdited",
+                "AuditMaintenanceCancelled",
+                "AuditServiceCreated",
+                "AuditServiceUpdated",
+                "AuditServiceDeleted",
+                "AuditTokenCreated",
+                "AuditTokenRevoked",
+                "AuditWebhookCreated",
+                "AuditWebhookUpdated",
+                "AuditWebhookDeleted",
+                "AuditWebhookRedelivered",
+                "AuditSettingsUpdated"
+            ]
+        },
+        "db.AuditChange": {
+            "type": "object",
+            "properties": {
+                "after": {
+                    "type": "object"
+                },
+                "before": {
+                    "type": "object"
+                }
+            }
+        },
+        "db.AuditEntry": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "$ref": "#/definitions/db.AuditAction"
+                },
+                "actor": {
+                    "description": "Actor is the username of whoever did it, empty for failed logins.",
+                    "type": "string"
+                },
+                "changes": {
+                    "description": "Changes holds the fields of the target changed by the action, by field name.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/db.AuditChange"
+                    }
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "targetId": {
+                    "type": "string"
+                },
+                "targetType": {
+                    "description": "TargetType and TargetID identify what the action was done to, e.g. \"report\" and \"42\" or \"user\" and \"alice\".",
+                    "type": "string"
+                },
+                "userAgent": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.AuditPage": {
+            "type": "object",
+            "properties": {
+                "entries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/db.AuditEntry"
+                    }
+                },
+                "nextBefore": {
+                    "description": "NextBefore is passed as the before parameter to get the next, older page, 0 on the last page.",
+                    "type": "integer"
+                }
+            }
+        },
+        "db.CreatedReport": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "db.CreatedToken": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "lastUsedAt": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "scope": {
+                    "description": "Scope is the highest role the token can act as, it's never higher than the role of its owner.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.Role"
+                        }
+                    ]
+                },
+                "token": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.DeliveryStatus": {
+            "type": "string",
+            "enum": [
+                "pending",
+                "delivered",
+                "failed"
+            ],
+            "x-enum-varnames": [
+                "DeliveryPending",
+                "DeliveryDelivered",
+                "DeliveryFailed"
+            ]
+        },
+        "db.EventAction": {
+            "type": "string",
+            "enum": [
+                "created",
+                "edited",
+                "solved",
+                "reopened",
+                "deleted",
+                "restored"
+            ],
+            "x-enum-varnames": [
+                "EventCreated",
+                "EventEdited",
+                "EventSolved",
+                "EventReopened",
+                "EventDeleted",
+                "EventRestored"
+            ]
+        },
+        "db.LoginThrottle": {
+            "type": "object",
+            "properties": {
+                "blockedUntil": {
+                    "description": "BlockedUntil is when the next attempt is let through.",
+                    "type": "string"
+                },
+                "failures": {
+                    "type": "integer"
+                },
+                "kind": {
+                    "$ref": "#/definitions/db.ThrottleKind"
+                },
+                "lastFailureAt": {
+                    "type": "string"
+                },
+                "locked": {
+                    "description": "Locked is set once a username failed lockoutFailures times. It stays locked out until BlockedUntil,\nunless an admin unlocks it earlier.",
+                    "type": "boolean"
+                },
+                "subject": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.Maintenance": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "createdBy": {
+                    "description": "CreatedBy is left out of what anyone can read, see Public.",
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "endsAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "startsAt": {
+                    "type": "string"
+                },
+                "status": {
+                    "$ref": "#/definitions/db.MaintenanceStatus"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "description": "UpdatedAt is when the maintenance was last edited or cancelled.",
+                    "type": "string"
+                }
+            }
+        },
+        "db.MaintenanceStatus": {
+            "type": "string",
+            "enum": [
+                "scheduled",
+                "in_progress",
+                "completed",
+                "cancelled"
+            ],
+            "x-enum-varnames": [
+                "MaintenanceScheduled",
+                "MaintenanceInProgress",
+                "MaintenanceCompleted",
+                "MaintenanceCancelled"
+            ]
+        },
+        "db.NewMaintenance": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "endsAt": {
+                    "type": "string"
+                },
+                "startsAt": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.NewReport": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "type": "string"
+                },
+                "services": {
+                    "description": "Services are the IDs of the affected services.",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "severity": {
+                    "description": "Severity is one of maintenance, minor, major or critical, minor when empty.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.Severity"
+                        }
+                    ]
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.NewReportUpdate": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                },
+                "status": {
+                    "$ref": "#/definitions/db.UpdateStatus"
+                }
+            }
+        },
+        "db.NewService": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "group": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "owner": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.NewToken": {
+            "type": "object",
+            "properties": {
+                "expiresInDays": {
+                    "description": "ExpiresInDays sets the lifetime of the token, 0 means the token never expires.",
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "scope": {
+                    "$ref": "#/definitions/db.Role"
+                }
+            }
+        },
+        "db.NewUser": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string"
+                },
+                "role": {
+                    "$ref": "#/definitions/db.Role"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.NewWebhook": {
+            "type": "object",
+            "properties": {
+                "disabled": {
+                    "type": "boolean"
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "secret": {
+                    "description": "Secret is generated when a webhook is created without one, and left alone when it's updated without one.",
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.PasswordReset": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.RecoveryCodes": {
+            "type": "object",
+            "properties": {
+                "codes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
         },
-        "/salt": {
-            "get": {
-                "description": "Generates and returns a salt assigned to the user.",
-                "produces": [
-                    "text/plain"
-                ],
-                "tags": [
-                    "user"
-                ],
-                "summary": "Get user salt",
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "type": "string"
-                        }
+        "db.Report": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "type": "string"
+                },
+                "createdAt": {
+                    "description": "CreatedAt, UpdatedAt and CreatedBy are unknown for reports created before they were recorded.",
+                    "type": "string"
+                },
+                "createdBy": {
+                    "description": "CreatedBy is left out of what anyone can read, see Public.",
+                    "type": "string"
+                },
+                "deletedAt": {
+                    "description": "DeletedAt and DeletedBy are only set for reports in the trash.",
+                    "type": "string"
+                },
+                "deletedBy": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "isSolved": {
+                    "type": "boolean"
+                },
+                "resolvedAt": {
+                    "type": "string"
+                },
+                "services": {
+                    "description": "ServiceIDs are the services affected by the problem.",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
                     }
+                },
+                "severity": {
+                    "$ref": "#/definitions/db.Severity"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "updatedAt": {
+                    "type": "string"
                 }
             }
-        }
-    },
-    "definitions": {
-        "db.NewReport": {
+        },
+        "db.ReportEvent": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "$ref": "#/definitions/db.EventAction"
+                },
+                "actor": {
+                    "type": "string"
+                },
+                "content": {
+                    "type": "string"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "isSolved": {
+                    "type": "boolean"
+                },
+                "reportId": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.ReportPage": {
+            "type": "object",
+            "properties": {
+                "nextCursor": {
+                    "description": "NextCursor is passed as the cursor parameter to get the next page, empty on the last page.",
+                    "type": "string"
+                },
+                "reports": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/db.Report"
+                    }
+                }
+            }
+        },
+        "db.ReportUpdate": {
+            "type": "object",
+            "properties": {
+                "author": {
+                    "description": "Author is left out of what anyone can read, see Public.",
+                    "type": "string"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "reportId": {
+                    "type": "integer"
+                },
+                "status": {
+                    "$ref": "#/definitions/db.UpdateStatus"
+                }
+            }
+        },
+        "db.Role": {
+            "type": "string",
+            "enum": [
+                "viewer",
+                "editor",
+                "admin"
+            ],
+            "x-enum-varnames": [
+                "RoleViewer",
+                "RoleEditor",
+                "RoleAdmin"
+            ]
+        },
+        "db.SearchResult": {
             "type": "object",
             "properties": {
                 "content": {
                     "type": "string"
                 },
+                "report": {
+                    "$ref": "#/definitions/db.Report"
+                },
                 "title": {
                     "type": "string"
+                },
+                "updates": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.Service": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "group": {
+                    "description": "Group collects related services on the public page, e.g. \"Network\" or \"Office\".",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "owner": {
+                    "description": "Owner is the person or team responsible for the service.",
+                    "type": "string"
+                }
+            }
+        },
+        "db.Severity": {
+            "type": "string",
+            "enum": [
+                "maintenance",
+                "minor",
+                "major",
+                "critical",
+                "minor"
+            ],
+            "x-enum-varnames": [
+                "SeverityMaintenance",
+                "SeverityMinor",
+                "SeverityMajor",
+                "SeverityCritical",
+                "DefaultSeverity"
+            ]
+        },
+        "db.ThrottleKind": {
+            "type": "string",
+            "enum": [
+                "ip",
+                "user"
+            ],
+            "x-enum-varnames": [
+                "ThrottleIP",
+                "ThrottleUser"
+            ]
+        },
+        "db.Token": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "lastUsedAt": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "scope": {
+                    "description": "Scope is the highest role the token can act as, it's never higher than the role of its owner.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/db.Role"
+                        }
+                    ]
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.TwoFactorCode": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.TwoFactorPolicy": {
+            "type": "object",
+            "properties": {
+                "required": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "db.TwoFactorSetup": {
+            "type": "object",
+            "properties": {
+                "secret": {
+                    "description": "Secret is shown for typing into the authenticator app when the QR code can't be scanned.",
+                    "type": "string"
+                },
+                "uri": {
+                    "description": "URI is the provisioning URI encoded in the QR code.",
+                    "type": "string"
+                }
+            }
+        },
+        "db.UpdateStatus": {
+            "type": "string",
+            "enum": [
+                "investigating",
+                "identified",
+                "monitoring",
+                "resolved"
+            ],
+            "x-enum-varnames": [
+                "UpdateInvestigating",
+                "UpdateIdentified",
+                "UpdateMonitoring",
+                "UpdateResolved"
+            ]
+        },
+        "db.User": {
+            "type": "object",
+            "properties": {
+                "disabled": {
+                    "type": "boolean"
+                },
+                "role": {
+                    "$ref": "#/definitions/db.Role"
+                },
+                "twoFactor": {
+                    "description": "TwoFactor is set when logging in takes a TOTP code after the password.",
+                    "type": "boolean"
+                },
+                "username": {
+                    "type": "string"
                 }
             }
         },
@@ -274,13 +2928,202 @@ const docTemplate = `{
                 "password": {
                     "type": "string"
                 },
-                "pepper": {
+                "username": {
                     "type": "string"
+                }
+            }
+        },
+        "db.UserUpdate": {
+            "type": "object",
+            "properties": {
+                "disabled": {
+                    "type": "boolean"
+                },
+                "role": {
+                    "$ref": "#/definitions/db.Role"
                 },
                 "username": {
                     "type": "string"
                 }
             }
+        },
+        "db.Webhook": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "disabled": {
+                    "type": "boolean"
+                },
+                "events": {
+                    "description": "Events are the types of events sent to the webhook, every type when empty.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "secret": {
+                    "description": "Secret signs the payloads, so the receiver can tell they come from us.",
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "db.WebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Error describes why the last attempt failed.",
+                    "type": "string"
+                },
+                "event": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "lastAttemptAt": {
+                    "type": "string"
+                },
+                "nextAttemptAt": {
+                    "type": "string"
+                },
+                "payload": {
+                    "description": "Payload is the exact body sent to the webhook.",
+                    "type": "object"
+                },
+                "responseStatus": {
+                    "description": "ResponseStatus is the HTTP status of the last attempt, 0 if no response was received.",
+                    "type": "integer"
+                },
+                "status": {
+                    "$ref": "#/definitions/db.DeliveryStatus"
+                },
+                "webhookId": {
+                    "type": "integer"
+                }
+            }
+        },
+        "notify.NewSubscription": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string"
+                }
+            }
+        },
+        "stats.Day": {
+            "type": "object",
+            "properties": {
+                "date": {
+                    "description": "Date is formatted as YYYY-MM-DD.",
+                    "type": "string"
+                },
+                "downtimeSeconds": {
+                    "type": "integer"
+                },
+                "incidents": {
+                    "description": "Incidents is the number of incidents which started that day.",
+                    "type": "integer"
+                }
+            }
+        },
+        "stats.ServiceStats": {
+            "type": "object",
+            "properties": {
+                "days": {
+                    "description": "Days is the daily history, oldest first.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/stats.Day"
+                    }
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "windows": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/stats.WindowStats"
+                    }
+                }
+            }
+        },
+        "stats.Stats": {
+            "type": "object",
+            "properties": {
+                "generatedAt": {
+                    "type": "string"
+                },
+                "overall": {
+                    "$ref": "#/definitions/stats.Summary"
+                },
+                "services": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/stats.ServiceStats"
+                    }
+                }
+            }
+        },
+        "stats.Summary": {
+            "type": "object",
+            "properties": {
+                "days": {
+                    "description": "Days is the daily history, oldest first.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/stats.Day"
+                    }
+                },
+                "windows": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/stats.WindowStats"
+                    }
+                }
+            }
+        },
+        "stats.WindowStats": {
+            "type": "object",
+            "properties": {
+                "downtimePercent": {
+                    "type": "number"
+                },
+                "downtimeSeconds": {
+                    "description": "DowntimeSeconds is how long at least one incident was open during the window.",
+                    "type": "integer"
+                },
+                "incidents": {
+                    "description": "Incidents is the number of incidents which started during the window.",
+                    "type": "integer"
+                },
+                "mttrSeconds": {
+                    "description": "MTTRSeconds is the mean time to recovery of the incidents solved during the window, 0 if none were.",
+                    "type": "integer"
+                },
+                "uptimePercent": {
+                    "type": "number"
+                },
+                "window": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
@@ -4,24 +4,36 @@ import (
 	"context"
 	"errors"
 	_ "example/downdetector/docs"
+	"example/downdetector/internal/broadcast"
+	"example/downdetector/internal/checker"
+	"example/downdetector/internal/config"
 	"example/downdetector/internal/db"
+	"example/downdetector/internal/maintenance"
+	"example/downdetector/internal/notify"
+	"example/downdetector/internal/stats"
+	"example/downdetector/internal/trash"
 	"example/downdetector/internal/utils"
+	"example/downdetector/internal/webhooks"
 
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/MadAppGang/httplog"
 	"github.com/charmbracelet/log"
 	"github.com/swaggo/http-swagger"
 )
 
+// conf is the configuration the server was set up with.
+var conf = config.Default()
+
 // SetupServer sets up the HTTP server and routes.
-func SetupServer() *http.Server {
-	// Serve static files from the ./static directory.
-	fs := http.FileServer(http.Dir("./static"))
+func SetupServer(cfg config.Config) *http.Server {
+	conf = cfg
+
+	// Serve static files from the configured static directory.
+	fs := http.FileServer(http.Dir(conf.StaticDir))
 	http.Handle("GET /static/", http.StripPrefix("/static/", fs))
 
 	// Serve swagger documentation under /docs/
@@ -29,36 +41,188 @@ func SetupServer() *http.Server {
 
 	// Set up static endpoint
 	http.Handle("GET /", httplog.Logger(http.HandlerFunc(RenderOpenReports)))
+	http.Handle("GET /feed.rss", httplog.Logger(http.HandlerFunc(RSSFeedHandler)))
+	http.Handle("GET /feed.atom", httplog.Logger(http.HandlerFunc(AtomFeedHandler)))
 	http.Handle("GET /dashboard", httplog.Logger(db.CheckIfUserLoggedIn(RenderDashboard)))
 	http.Handle("GET /login", httplog.Logger(http.HandlerFunc(ServeLogin)))
-	http.Handle("GET /zglos", httplog.Logger(db.CheckIfUserLoggedIn(ServeNewReport)))
+	http.Handle("GET /login/twofactor", httplog.Logger(http.HandlerFunc(ServeTwoFactorLogin)))
+	http.Handle("GET /zglos", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleEditor, RenderNewReport))))
 	http.Handle("GET /changepassword", httplog.Logger(db.CheckIfUserLoggedIn(ServeChangePassword)))
+	http.Handle("GET /users", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, RenderUsers))))
+	http.Handle("GET /tokens", httplog.Logger(db.CheckIfUserLoggedIn(RenderTokens)))
+	http.Handle("GET /twofactor", httplog.Logger(db.CheckIfUserLoggedIn(RenderTwoFactor)))
+	http.Handle("GET /services", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, RenderServices))))
+	http.Handle("GET /webhooks", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, RenderWebhooks))))
+	http.Handle("GET /audit", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, RenderAudit))))
+	http.Handle("GET /subscription/confirm", httplog.Logger(RenderSubscription("confirm")))
+	http.Handle("GET /subscription/unsubscribe", httplog.Logger(RenderSubscription("unsubscribe")))
 
 	//Set up API endpoints
 	// GET
-	http.Handle("GET /api/logout", httplog.Logger(db.CheckIfUserLoggedIn(db.LogoutHandler)))
-	http.Handle("GET /api/salt", httplog.Logger(http.HandlerFunc(db.GetSaltHandler)))
-	http.Handle("GET /api/pepper", httplog.Logger(http.HandlerFunc(db.GetPepperHandler)))
+	http.Handle("GET /api/reports", httplog.Logger(publicAPI(db.ListReportsHandler)))
+	http.Handle("GET /api/reports/search", httplog.Logger(publicAPI(db.SearchReportsHandler)))
+	http.Handle("GET /api/reports/trash", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.ListTrashHandler))))
+	http.Handle("GET /api/reports/{id}", httplog.Logger(publicAPI(db.GetReportHandler)))
+	http.Handle("GET /api/reports/{id}/updates", httplog.Logger(publicAPI(db.ReportUpdatesHandler)))
+	http.Handle("GET /api/reports/{id}/events", httplog.Logger(db.CheckIfUserLoggedIn(db.ReportEventsHandler)))
+	http.Handle("GET /api/maintenances", httplog.Logger(publicAPI(db.ListMaintenancesHandler)))
+	http.Handle("GET /api/maintenances/{id}", httplog.Logger(publicAPI(db.GetMaintenanceHandler)))
+	http.Handle("GET /api/stats", httplog.Logger(publicAPI(stats.StatsHandler)))
+	http.Handle("GET /api/services", httplog.Logger(publicAPI(db.ListServicesHandler)))
+	http.Handle("GET /api/services/{id}", httplog.Logger(publicAPI(db.GetServiceHandler)))
+	// The event stream skips the request logger, whose response writer doesn't let it lift the write timeout
+	http.Handle("GET /api/events", publicAPI(broadcast.StreamHandler))
+	http.Handle("GET /api/users", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.ListUsersHandler))))
+	http.Handle("GET /api/users/lockouts", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.ListLockoutsHandler))))
+	http.Handle("GET /api/tokens", httplog.Logger(db.CheckIfUserLoggedIn(db.ListTokensHandler)))
+	http.Handle("GET /api/twofactor/policy", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.GetTwoFactorPolicyHandler))))
+	http.Handle("GET /api/webhooks", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.ListWebhooksHandler))))
+	http.Handle("GET /api/webhooks/{id}/deliveries", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.WebhookDeliveriesHandler))))
+	http.Handle("GET /api/audit", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.ListAuditHandler))))
+	http.Handle("GET /api/audit/export", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.ExportAuditHandler))))
 
 	// POST, PUT and DELETE
-	http.Handle("POST /api/reports", httplog.Logger(db.CheckIfUserLoggedIn(db.AddReportHandler)))
+	http.Handle("POST /api/reports", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleEditor, db.AddReportHandler))))
+	http.Handle("POST /api/maintenances", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleEditor, db.CreateMaintenanceHandler))))
+	http.Handle("POST /api/maintenances/{id}/cancel", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleEditor, db.CancelMaintenanceHandler))))
+	http.Handle("POST /api/services", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.CreateServiceHandler))))
+	http.Handle("POST /api/reports/{id}/restore", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.RestoreReportHandler))))
+	http.Handle("POST /api/reports/{id}/updates", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleEditor, db.AddReportUpdateHandler))))
 	http.Handle("POST /api/login", httplog.Logger(db.LoginMiddleware(db.SessionHandler)))
-	http.Handle("PUT /api/reports/{id}", httplog.Logger(db.CheckIfUserLoggedIn(db.EditReportHandler)))
+	http.Handle("POST /api/login/twofactor", httplog.Logger(http.HandlerFunc(db.TwoFactorLoginHandler)))
+	http.Handle("POST /api/logout", httplog.Logger(db.CheckIfUserLoggedIn(db.LogoutHandler)))
+	http.Handle("POST /api/users", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.CreateUserHandler))))
+	http.Handle("POST /api/tokens", httplog.Logger(db.CheckIfUserLoggedIn(db.CreateTokenHandler)))
+	http.Handle("POST /api/twofactor/setup", httplog.Logger(db.CheckIfUserLoggedIn(db.SetupTwoFactorHandler)))
+	http.Handle("POST /api/twofactor/enable", httplog.Logger(db.CheckIfUserLoggedIn(db.EnableTwoFactorHandler)))
+	http.Handle("POST /api/twofactor/disable", httplog.Logger(db.CheckIfUserLoggedIn(db.DisableTwoFactorHandler)))
+	http.Handle("POST /api/twofactor/recovery-codes", httplog.Logger(db.CheckIfUserLoggedIn(db.RegenerateRecoveryCodesHandler)))
+	http.Handle("POST /api/webhooks", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.CreateWebhookHandler))))
+	http.Handle("POST /api/webhooks/{id}/deliveries/{delivery}/redeliver", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.RedeliverHandler))))
+	http.Handle("POST /api/subscribers", httplog.Logger(http.HandlerFunc(notify.SubscribeHandler)))
+	http.Handle("POST /api/subscribers/confirm", httplog.Logger(http.HandlerFunc(notify.ConfirmSubscriptionHandler)))
+	http.Handle("POST /api/subscribers/unsubscribe", httplog.Logger(http.HandlerFunc(notify.UnsubscribeHandler)))
+	http.Handle("POST /api/users/{username}/password", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.ResetPasswordHandler))))
+	http.Handle("PUT /api/reports/{id}", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleEditor, db.EditReportHandler))))
+	http.Handle("PUT /api/maintenances/{id}", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleEditor, db.UpdateMaintenanceHandler))))
+	http.Handle("PUT /api/services/{id}", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.UpdateServiceHandler))))
 	http.Handle("PUT /api/changepassword", httplog.Logger(db.CheckIfUserLoggedIn(db.ChangePasswordHandler)))
-	http.Handle("DELETE /api/reports/{id}", httplog.Logger(db.CheckIfUserLoggedIn(db.DeleteReportHandler)))
+	http.Handle("PUT /api/users/{username}", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.UpdateUserHandler))))
+	http.Handle("PUT /api/twofactor/policy", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.UpdateTwoFactorPolicyHandler))))
+	http.Handle("PUT /api/webhooks/{id}", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.UpdateWebhookHandler))))
+	http.Handle("DELETE /api/reports/{id}", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.DeleteReportHandler))))
+	http.Handle("DELETE /api/users/{username}/lockout", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.UnlockUserHandler))))
+	http.Handle("DELETE /api/users/{username}/twofactor", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.ResetTwoFactorHandler))))
+	http.Handle("DELETE /api/services/{id}", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.DeleteServiceHandler))))
+	http.Handle("DELETE /api/tokens/{id}", httplog.Logger(db.CheckIfUserLoggedIn(db.DeleteTokenHandler)))
+	http.Handle("DELETE /api/webhooks/{id}", httplog.Logger(db.CheckIfUserLoggedIn(db.RequireRole(db.RoleAdmin, db.DeleteWebhookHandler))))
 
 	// Initialize the HTTP server.
 	srv := &http.Server{
-		Handler: nil,
-		Addr:    ":8080",
+		// Every request changing something goes through the CSRF checks first
+		Handler:      db.CSRFMiddleware(http.DefaultServeMux),
+		Addr:         conf.Addr,
+		ReadTimeout:  conf.ReadTimeout,
+		WriteTimeout: conf.WriteTimeout,
+		IdleTimeout:  conf.IdleTimeout,
 	}
+	// End the event streams, otherwise shutdown would wait for them until it times out
+	srv.RegisterOnShutdown(broadcast.Close)
 
 	return srv
 }
 
-// ConnectDB initializes the database connection.
+// publicAPI lets pages served from other origins read public API endpoints.
+// Cookies are never sent along such requests, so nothing beyond public data is exposed.
+func publicAPI(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		f(w, r)
+	}
+}
+
+// ConnectDB initializes the database connection and the session store.
 func ConnectDB() error {
-	return db.Connect()
+	if err := db.SetupSessions(conf); err != nil {
+		return err
+	}
+	return db.Connect(conf)
+}
+
+// workers stop the background workers and wait for them to finish.
+var workers []func()
+
+// startWorker runs f in the background until shutdown.
+func startWorker(f func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		f(ctx)
+		close(done)
+	}()
+	workers = append(workers, func() {
+		cancel()
+		<-done
+	})
+}
+
+// stopWorkers stops every background worker, in the reverse order they were started,
+// so that workers started first, like the mail sender, can still handle what the others do while stopping.
+func stopWorkers() {
+	for i := len(workers) - 1; i >= 0; i-- {
+		workers[i]()
+	}
+	workers = nil
+}
+
+// StartNotifications starts emailing the subscribers in the background when an SMTP relay is configured.
+func StartNotifications() error {
+	if err := notify.Setup(conf); err != nil {
+		return err
+	}
+	if !notify.Enabled() {
+		return nil
+	}
+
+	startWorker(notify.Run)
+	utils.NoReportLog.Info("Started email notifications", "relay", conf.SMTPAddr)
+	return nil
+}
+
+// StartWebhooks starts sending report events to the webhooks in the background.
+func StartWebhooks() {
+	startWorker(webhooks.New().Run)
+}
+
+// StartMaintenance starts moving the maintenance windows along their schedule in the background.
+func StartMaintenance() {
+	startWorker(maintenance.New().Run)
+}
+
+// StartTrash starts purging the old reports from the trash in the background, unless they're kept forever.
+func StartTrash() {
+	if conf.TrashRetentionDays == 0 {
+		return
+	}
+
+	startWorker(trash.New(conf.TrashRetentionDays).Run)
+	utils.NoReportLog.Info("Started purging the trash", "retentionDays", conf.TrashRetentionDays)
+}
+
+// StartChecks starts probing the configured health checks in the background.
+func StartChecks() error {
+	if len(conf.Checks) == 0 {
+		return nil
+	}
+
+	c, err := checker.New(conf.Checks)
+	if err != nil {
+		return err
+	}
+
+	startWorker(c.Run)
+	utils.NoReportLog.Info("Started health checks", "count", len(conf.Checks))
+	return nil
 }
 
 // GracefulShutdown handles server and database shutdown gracefully.
@@ -75,7 +239,7 @@ func GracefulShutdown(srv *http.Server, logFile *os.File) {
 		utils.NoReportLog.Warn("Received interrupt")
 
 		// Attempt to gracefully shut down the server.
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
 		defer cancel()
 
 		if err := srv.Shutdown(ctx); err != nil {
@@ -84,6 +248,9 @@ func GracefulShutdown(srv *http.Server, logFile *os.File) {
 			utils.NoReportLog.Info("Server gracefully stopped")
 		}
 
+		// Stop the health checks, the maintenance scheduler and webhooks, then send the queued emails, before the database goes away.
+		stopWorkers()
+
 		// Close the database connection.
 		if err := db.DB.Close(); err != nil {
 			log.Error("Error closing database: %v", err)
@@ -94,8 +261,15 @@ func GracefulShutdown(srv *http.Server, logFile *os.File) {
 		close(idleConnsClosed)
 	}()
 
-	utils.NoReportLog.Info("Serving http...")
-	if err := srv.ListenAndServe(); err != nil {
+	var err error
+	if conf.TLSCertFile != "" {
+		utils.NoReportLog.Info("Serving https...", "addr", srv.Addr)
+		err = srv.ListenAndServeTLS(conf.TLSCertFile, conf.TLSKeyFile)
+	} else {
+		utils.NoReportLog.Warn("Serving http without TLS, passwords are sent in plain text", "addr", srv.Addr)
+		err = srv.ListenAndServe()
+	}
+	if err != nil {
 		if !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("Server failed: %v", err)
 		}
@@ -0,0 +1,351 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"example/downdetector/internal/db"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// feedSize is the number of most recently changed reports listed in a feed.
+const feedSize = 50
+
+// feedTitle is the title of the feeds, followed by the name of the variant.
+const feedTitle = "Downdetector"
+
+// feed is what both the RSS and the Atom feed are built from.
+type feed struct {
+	// Status is the variant of the feed: "open", "solved" or empty for all reports.
+	Status  string
+	Title   string
+	BaseURL string
+	// SelfURL is the address of the feed itself.
+	SelfURL string
+	// Updated is when any report was last changed.
+	Updated time.Time
+	Items   []feedItem
+}
+
+// feedItem is a single report in a feed.
+type feedItem struct {
+	ID      uint
+	Title   string
+	Content string
+	// Link points at the report on the public page, where only open reports are listed, so solved ones lead to the top of it.
+	Link      string
+	Published time.Time
+	Updated   time.Time
+	// Categories are the names of the affected services.
+	Categories []string
+}
+
+// GUID is the identifier of the item, which only depends on the report ID,
+// so it stays the same when the report is edited or the app moves to another address.
+func (i feedItem) GUID() string {
+	return fmt.Sprintf("urn:noticeboard:report:%d", i.ID)
+}
+
+// baseURL returns the address the app is reached at, without a trailing slash.
+func baseURL(r *http.Request) string {
+	if conf.PublicURL != "" {
+		return strings.TrimSuffix(conf.PublicURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// lastChange returns the time the report was last changed at, zero if it's unknown.
+func lastChange(report db.Report) time.Time {
+	for _, t := range []*time.Time{report.UpdatedAt, report.ResolvedAt, report.CreatedAt} {
+		if t != nil {
+			return *t
+		}
+	}
+	return time.Time{}
+}
+
+// buildFeed collects the most recently changed reports matching the status, which is "open", "solved" or empty for all.
+func buildFeed(r *http.Request, status string) (feed, error) {
+	var reports []db.Report
+	var err error
+	if status == "open" {
+		reports, err = db.DB.OpenReports()
+	} else {
+		reports, err = db.DB.AllReports()
+	}
+	if err != nil {
+		return feed{}, err
+	}
+	if status == "solved" {
+		reports = slices.DeleteFunc(reports, func(report db.Report) bool { return !report.IsSolved })
+	}
+
+	services, err := db.DB.Services()
+	if err != nil {
+		return feed{}, err
+	}
+	serviceNames := map[int64]string{}
+	for _, service := range services {
+		serviceNames[service.ID] = service.Name
+	}
+
+	// Deleted reports leave no trace among the remaining ones, so the history tells when the feed last changed
+	updated, err := db.DB.LastReportChange()
+	if err != nil {
+		return feed{}, err
+	}
+
+	// Newest first, reports without timestamps go last in the order they were created
+	slices.SortStableFunc(reports, func(a, b db.Report) int {
+		return lastChange(b).Compare(lastChange(a))
+	})
+	reports = reports[:min(len(reports), feedSize)]
+
+	base := baseURL(r)
+	f := feed{Status: status, Title: feedTitle, BaseURL: base, SelfURL: base + r.URL.RequestURI()}
+	switch status {
+	case "open":
+		f.Title += " – otwarte zgłoszenia"
+	case "solved":
+		f.Title += " – rozwiązane zgłoszenia"
+	default:
+		f.Title += " – zgłoszenia"
+	}
+
+	for _, report := range reports {
+		item := feedItem{
+			ID:      report.ID,
+			Title:   fmt.Sprintf("[%s] %s", db.SeverityNames[report.Severity], report.Title),
+			Content: report.Content,
+			Link:    fmt.Sprintf("%s/#report-%d", base, report.ID),
+			Updated: lastChange(report),
+		}
+		if report.IsSolved {
+			item.Title += " (rozwiązane)"
+		}
+		item.Published = item.Updated
+		if report.CreatedAt != nil {
+			item.Published = *report.CreatedAt
+		}
+		for _, id := range report.ServiceIDs {
+			item.Categories = append(item.Categories, serviceNames[id])
+		}
+		if item.Updated.After(updated) {
+			updated = item.Updated
+		}
+		f.Items = append(f.Items, item)
+	}
+	f.Updated = updated
+
+	return f, nil
+}
+
+// feedStatus reads the variant of the feed from the status query parameter.
+func feedStatus(r *http.Request) (string, bool) {
+	status := r.URL.Query().Get("status")
+	return status, status == "" || status == "open" || status == "solved"
+}
+
+// serveFeed renders the feed and sends it, answering conditional requests with 304 Not Modified.
+func serveFeed(w http.ResponseWriter, r *http.Request, contentType string, render func(feed) any) {
+	status, ok := feedStatus(r)
+	if !ok {
+		http.Error(w, "status must be open or solved", http.StatusBadRequest)
+		return
+	}
+
+	f, err := buildFeed(r, status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to build feed", "err", err)
+		return
+	}
+
+	body, err := xml.MarshalIndent(render(f), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to encode feed", "err", err)
+		return
+	}
+	body = append([]byte(xml.Header), body...)
+
+	sum := sha256.Sum256(body)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	// ServeContent checks If-None-Match and If-Modified-Since, and sets Last-Modified unless the time is zero
+	http.ServeContent(w, r, "", f.Updated, bytes.NewReader(body))
+}
+
+type rssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	AtomSpace string     `xml:"xmlns:atom,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Self          rssLink   `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+// rssLink is the atom:link pointing an RSS feed at itself.
+type rssLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate,omitempty"`
+	Categories  []string `xml:"category"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// rssDate formats t as RFC 822 dates required by RSS, empty if it's unknown.
+func rssDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC1123Z)
+}
+
+func renderRSS(f feed) any {
+	channel := rssChannel{
+		Title:         f.Title,
+		Link:          f.BaseURL + "/",
+		Description:   "Zgłoszenia o awariach i pracach serwisowych",
+		Language:      "pl",
+		LastBuildDate: rssDate(f.Updated),
+		Self:          rssLink{Href: f.SelfURL, Rel: "self", Type: "application/rss+xml"},
+	}
+	for _, item := range f.Items {
+		channel.Items = append(channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Content,
+			GUID:        rssGUID{Value: item.GUID()},
+			// Readers show the pubDate as the time of the item, which is when it last changed
+			PubDate:    rssDate(item.Updated),
+			Categories: item.Categories,
+		})
+	}
+	return rssFeed{Version: "2.0", AtomSpace: "http://www.w3.org/2005/Atom", Channel: channel}
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Lang    string      `xml:"xml:lang,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published,omitempty"`
+	Link       atomLink       `xml:"link"`
+	Summary    string         `xml:"summary"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// atomDate formats t as RFC 3339 dates required by Atom. Atom requires the dates, so unknown ones are the Unix epoch.
+func atomDate(t time.Time) string {
+	if t.IsZero() {
+		t = time.Unix(0, 0)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func renderAtom(f feed) any {
+	variant := f.Status
+	if variant == "" {
+		variant = "all"
+	}
+	atom := atomFeed{
+		Lang: "pl",
+		// The ID has to stay the same, so it doesn't depend on the address of the app
+		ID:      "urn:noticeboard:feed:" + variant,
+		Title:   f.Title,
+		Updated: atomDate(f.Updated),
+		Author:  atomAuthor{Name: feedTitle},
+		Links: []atomLink{
+			{Href: f.SelfURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.BaseURL + "/", Rel: "alternate", Type: "text/html"},
+		},
+	}
+	for _, item := range f.Items {
+		entry := atomEntry{
+			ID:      item.GUID(),
+			Title:   item.Title,
+			Updated: atomDate(item.Updated),
+			Link:    atomLink{Href: item.Link, Rel: "alternate", Type: "text/html"},
+			Summary: item.Content,
+		}
+		if !item.Published.IsZero() {
+			entry.Published = atomDate(item.Published)
+		}
+		for _, category := range item.Categories {
+			entry.Categories = append(entry.Categories, atomCategory{Term: category})
+		}
+		atom.Entries = append(atom.Entries, entry)
+	}
+	return atom
+}
+
+// RSSFeedHandler serves the most recently changed reports as an RSS 2.0 feed,
+// only the open or the solved ones with ?status=open or ?status=solved.
+// Items are identified by report ID, so edits update an item instead of adding a new one.
+func RSSFeedHandler(w http.ResponseWriter, r *http.Request) {
+	serveFeed(w, r, "application/rss+xml; charset=utf-8", renderRSS)
+}
+
+// AtomFeedHandler serves the most recently changed reports as an Atom feed,
+// only the open or the solved ones with ?status=open or ?status=solved.
+// Entries are identified by report ID, so edits update an entry instead of adding a new one.
+func AtomFeedHandler(w http.ResponseWriter, r *http.Request) {
+	serveFeed(w, r, "application/atom+xml; charset=utf-8", renderAtom)
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"errors"
+	"example/downdetector/internal/config"
+	"example/downdetector/internal/db"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// migrateUsage describes the migrate subcommand.
+const migrateUsage = "usage: noticeboard migrate up|down [steps]|status [flags]"
+
+// RunMigrate runs the migrate subcommand: up applies pending migrations,
+// down reverts the given number of migrations (1 by default) and status lists them.
+// The remaining arguments are configuration flags.
+func RunMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	action, args := args[0], args[1:]
+
+	steps := 1
+	if action == "down" && len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			if n < 1 {
+				return errors.New("steps must be at least 1")
+			}
+			steps, args = n, args[1:]
+		}
+	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		return err
+	}
+	if err := db.Open(cfg); err != nil {
+		return err
+	}
+	defer db.DB.Close()
+
+	switch action {
+	case "up":
+		return db.DB.MigrateUp()
+	case "down":
+		return db.DB.MigrateDown(steps)
+	case "status":
+		states, err := db.DB.MigrationStatus()
+		printMigrations(states)
+		return err
+	default:
+		return fmt.Errorf("unknown migrate action %q\n%s", action, migrateUsage)
+	}
+}
+
+// printMigrations writes the migration states as a table to standard output.
+func printMigrations(states []db.MigrationState) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, state := range states {
+		applied := "pending"
+		if state.AppliedAt != nil {
+			applied = state.AppliedAt.Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", state.Version, state.Name, applied)
+	}
+	w.Flush()
+}
@@ -1,15 +1,105 @@
 package app
 
 import (
+	"errors"
+	"example/downdetector/internal/broadcast"
 	"example/downdetector/internal/db"
+	"example/downdetector/internal/notify"
+	"example/downdetector/internal/stats"
 	"github.com/charmbracelet/log"
 	"html/template"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
 )
 
+// ServiceStatus is a service together with its open reports.
+type ServiceStatus struct {
+	db.Service
+	Reports []db.Report
+	// Anchored holds the reports given their report-{id} anchor, which the feeds link to, under this service.
+	// A report affecting several services is anchored under the first one only.
+	Anchored map[uint]bool
+	// Stats are the downtime statistics of the service.
+	Stats stats.Summary
+}
+
+// Operational reports whether nothing is currently reported about the service.
+func (s ServiceStatus) Operational() bool {
+	return len(s.Reports) == 0
+}
+
+// Severity returns the severity of the worst report about the service, empty when it's operational.
+func (s ServiceStatus) Severity() db.Severity {
+	return db.WorstSeverity(s.Reports)
+}
+
+// ServiceGroup holds the services sharing a group on the public page.
+type ServiceGroup struct {
+	Name     string
+	Services []ServiceStatus
+}
+
+// IndexData is passed to the public page template.
+type IndexData struct {
+	Groups []ServiceGroup
+	// Unassigned holds the open reports which aren't attached to any service.
+	Unassigned []db.Report
+	IsEmpty    bool
+	// Status is the severity of the worst open report, empty when everything works.
+	Status db.Severity
+	// Updates holds the updates of each open report, newest first, by report ID.
+	Updates map[uint][]db.ReportUpdate
+	// Subscriptions tells whether viewers can subscribe to email notifications.
+	Subscriptions bool
+	// Maintenances are the upcoming and ongoing maintenance windows, and the recently completed ones.
+	Maintenances []db.Maintenance
+	// Stats are the downtime statistics of all services together.
+	Stats stats.Summary
+}
+
+// completedShown is how long a completed maintenance stays on the public page.
+const completedShown = 24 * time.Hour
+
+// DashboardData is passed to the dashboard template.
+type DashboardData struct {
+	Reports []db.Report
+	// Events holds the history of each report, by report ID.
+	Events map[uint][]db.ReportEvent
+	// Updates holds the updates of each report, newest first, by report ID.
+	Updates        map[uint][]db.ReportUpdate
+	UpdateStatuses []db.UpdateStatus
+	Services       []db.Service
+	// ServiceNames holds the name of each service, by service ID.
+	ServiceNames map[int64]string
+	Severities   []db.Severity
+	// Maintenances holds every maintenance window, the latest first.
+	Maintenances []db.Maintenance
+	// NewMaintenance is the blank maintenance filled in by the form scheduling a new one.
+	NewMaintenance db.Maintenance
+	// Trash holds the deleted reports, only for admins, who can restore them.
+	Trash []db.Report
+	// TrashRetentionDays is how long deleted reports stay in the trash, 0 when they're kept forever.
+	TrashRetentionDays int
+	User               db.User
+}
+
+// UsersData is passed to the user management template.
+type UsersData struct {
+	Users []db.User
+	// Lockouts holds the usernames locked out after too many failed logins, by username.
+	Lockouts map[string]db.LoginThrottle
+	// TwoFactorRequired tells whether every user has to set up two-factor authentication.
+	TwoFactorRequired bool
+	User              db.User
+	Roles             []db.Role
+}
+
 func RenderOpenReports(w http.ResponseWriter, r *http.Request) {
-	lp := filepath.Join("templates", "index.html")
+	lp := filepath.Join(conf.TemplateDir, "index.html")
 
 	tmpl, err := template.ParseFiles(lp)
 	if err != nil {
@@ -18,13 +108,61 @@ func RenderOpenReports(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := db.GetOpenReports()
+	services, err := db.DB.Services()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	reports, err := db.DB.OpenReports()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	updates, err := db.GetOpenReportUpdates()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	maintenances, err := db.DB.Maintenances()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	history, err := stats.Load()
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Error(err)
 		return
 	}
 
+	data := groupByService(services, reports)
+	data.Updates = updates
+	data.Stats = history.Overall
+	for _, group := range data.Groups {
+		for i := range group.Services {
+			if serviceStats, ok := history.Service(group.Services[i].ID); ok {
+				group.Services[i].Stats = serviceStats.Summary
+			}
+		}
+	}
+	data.Subscriptions = notify.Enabled()
+	data.Maintenances = slices.DeleteFunc(maintenances, func(m db.Maintenance) bool {
+		return m.Status == db.MaintenanceCancelled || (m.Status == db.MaintenanceCompleted && time.Since(m.EndsAt) > completedShown)
+	})
+	// Ongoing maintenance is worth a banner too, unless something worse is going on
+	inProgress := slices.ContainsFunc(data.Maintenances, func(m db.Maintenance) bool { return m.Status == db.MaintenanceInProgress })
+	if inProgress && data.Status == "" {
+		data.Status = db.SeverityMaintenance
+	}
+
 	if err := tmpl.Execute(w, data); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		log.Error(err)
@@ -33,8 +171,213 @@ func RenderOpenReports(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// groupByService attaches the open reports to their services and groups the services.
+// Services come ordered by group, so each group is collected in one pass.
+// The most severe reports are listed first.
+func groupByService(services []db.Service, reports []db.Report) IndexData {
+	db.SortBySeverity(reports)
+	data := IndexData{IsEmpty: len(reports) == 0, Status: db.WorstSeverity(reports)}
+
+	anchored := map[uint]bool{}
+	for _, service := range services {
+		status := ServiceStatus{Service: service, Anchored: map[uint]bool{}}
+		for _, report := range reports {
+			if report.HasService(service.ID) {
+				status.Reports = append(status.Reports, report)
+				if !anchored[report.ID] {
+					anchored[report.ID] = true
+					status.Anchored[report.ID] = true
+				}
+			}
+		}
+
+		if n := len(data.Groups); n == 0 || data.Groups[n-1].Name != service.Group {
+			data.Groups = append(data.Groups, ServiceGroup{Name: service.Group})
+		}
+		group := &data.Groups[len(data.Groups)-1]
+		group.Services = append(group.Services, status)
+	}
+
+	for _, report := range reports {
+		if len(report.ServiceIDs) == 0 {
+			data.Unassigned = append(data.Unassigned, report)
+		}
+	}
+
+	return data
+}
+
 func RenderDashboard(w http.ResponseWriter, r *http.Request) {
-	lp := filepath.Join("templates", "dashboard.html")
+	lp := filepath.Join(conf.TemplateDir, "dashboard.html")
+
+	tmpl, err := template.ParseFiles(lp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	reports, err := db.DB.AllReports()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	// Open reports come first, the most severe on top
+	db.SortBySeverity(reports)
+	slices.SortStableFunc(reports, func(a, b db.Report) int {
+		switch {
+		case a.IsSolved == b.IsSolved:
+			return 0
+		case a.IsSolved:
+			return 1
+		default:
+			return -1
+		}
+	})
+
+	events, err := db.GetAllReportEvents()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	updates, err := db.GetAllReportUpdates()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	services, err := db.DB.Services()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	serviceNames := map[int64]string{}
+	for _, service := range services {
+		serviceNames[service.ID] = service.Name
+	}
+
+	maintenances, err := db.DB.Maintenances()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	slices.Reverse(maintenances)
+
+	user, _ := db.CurrentUser(r)
+	var trash []db.Report
+	if user.IsAdmin() {
+		trash, err = db.DB.TrashedReports()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Error(err)
+			return
+		}
+	}
+
+	data := DashboardData{Reports: reports, Events: events, Updates: updates, UpdateStatuses: db.UpdateStatuses, Services: services, ServiceNames: serviceNames, Severities: db.Severities, Maintenances: maintenances,
+		Trash: trash, TrashRetentionDays: conf.TrashRetentionDays, User: user}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+}
+
+func RenderUsers(w http.ResponseWriter, r *http.Request) {
+	lp := filepath.Join(conf.TemplateDir, "users.html")
+
+	tmpl, err := template.ParseFiles(lp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	users, err := db.DB.Users()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	lockouts, err := db.DB.LoginLockouts(time.Now().UTC())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	locked := map[string]db.LoginThrottle{}
+	for _, lockout := range lockouts {
+		locked[lockout.Subject] = lockout
+	}
+
+	required, err := db.TwoFactorRequired()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	user, _ := db.CurrentUser(r)
+	data := UsersData{Users: users, Lockouts: locked, TwoFactorRequired: required, User: user, Roles: db.Roles}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+}
+
+// ServicesData is passed to the service management template.
+type ServicesData struct {
+	Services []db.Service
+	User     db.User
+}
+
+func RenderServices(w http.ResponseWriter, r *http.Request) {
+	lp := filepath.Join(conf.TemplateDir, "services.html")
+
+	tmpl, err := template.ParseFiles(lp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	services, err := db.DB.Services()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	user, _ := db.CurrentUser(r)
+	data := ServicesData{Services: services, User: user}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+}
+
+// TokensData is passed to the API tokens template.
+type TokensData struct {
+	Tokens []db.Token
+	User   db.User
+	Roles  []db.Role
+}
+
+func RenderTokens(w http.ResponseWriter, r *http.Request) {
+	lp := filepath.Join(conf.TemplateDir, "tokens.html")
 
 	tmpl, err := template.ParseFiles(lp)
 	if err != nil {
@@ -43,13 +386,23 @@ func RenderDashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := db.GetAllReports()
+	user, _ := db.CurrentUser(r)
+	tokens, err := db.DB.Tokens(user.Username)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Error(err)
 		return
 	}
 
+	// Only offer scopes the user is allowed to grant
+	var roles []db.Role
+	for _, role := range db.Roles {
+		if user.Role.Allows(role) {
+			roles = append(roles, role)
+		}
+	}
+	data := TokensData{Tokens: tokens, User: user, Roles: roles}
+
 	if err := tmpl.Execute(w, data); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Error(err)
@@ -58,13 +411,230 @@ func RenderDashboard(w http.ResponseWriter, r *http.Request) {
 }
 
 func ServeLogin(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, "./static/login.html")
+	http.ServeFile(w, r, filepath.Join(conf.StaticDir, "login.html"))
+}
+
+// ServeTwoFactorLogin asks for the code of the authenticator app after the password was accepted.
+func ServeTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	http.ServeFile(w, r, filepath.Join(conf.StaticDir, "loginTwoFactor.html"))
+}
+
+// TwoFactorData is passed to the two-factor authentication template.
+type TwoFactorData struct {
+	// RecoveryCodesLeft is the number of unused recovery codes, when two-factor authentication is enabled.
+	RecoveryCodesLeft int
+	// Required tells whether the admins require two-factor authentication, so it can't be turned off.
+	Required bool
+	User     db.User
+}
+
+func RenderTwoFactor(w http.ResponseWriter, r *http.Request) {
+	lp := filepath.Join(conf.TemplateDir, "twofactor.html")
+
+	tmpl, err := template.ParseFiles(lp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	user, _ := db.CurrentUser(r)
+	left, err := db.DB.RecoveryCodesLeft(user.Username)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	required, err := db.TwoFactorRequired()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	data := TwoFactorData{RecoveryCodesLeft: left, Required: required, User: user}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
 }
 
-func ServeNewReport(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, "./static/newReport.html")
+// NewReportData is passed to the new report template.
+type NewReportData struct {
+	Services   []db.Service
+	Severities []db.Severity
+	// Default is the severity selected at first.
+	Default db.Severity
+}
+
+func RenderNewReport(w http.ResponseWriter, r *http.Request) {
+	lp := filepath.Join(conf.TemplateDir, "newReport.html")
+
+	tmpl, err := template.ParseFiles(lp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	services, err := db.DB.Services()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	if err := tmpl.Execute(w, NewReportData{Services: services, Severities: db.Severities, Default: db.DefaultSeverity}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
 }
 
 func ServeChangePassword(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, "./static/changePassword.html")
+	http.ServeFile(w, r, filepath.Join(conf.StaticDir, "changePassword.html"))
+}
+
+// WebhooksData is passed to the webhook management template.
+type WebhooksData struct {
+	Webhooks []db.Webhook
+	// EventTypes are the types of events webhooks can subscribe to.
+	EventTypes []string
+	User       db.User
+}
+
+func RenderWebhooks(w http.ResponseWriter, r *http.Request) {
+	lp := filepath.Join(conf.TemplateDir, "webhooks.html")
+
+	tmpl, err := template.ParseFiles(lp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	webhooks, err := db.DB.Webhooks()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	user, _ := db.CurrentUser(r)
+	data := WebhooksData{Webhooks: webhooks, EventTypes: broadcast.Types, User: user}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+}
+
+// AuditData is passed to the audit log template.
+type AuditData struct {
+	Page db.AuditPage
+	// Query holds the filters, to fill in the form with.
+	Query url.Values
+	// ExportURL downloads every entry matching the filters, NextURL shows the next page.
+	ExportURL, NextURL string
+	Actions            []db.AuditAction
+	TargetTypes        []string
+	User               db.User
+}
+
+func RenderAudit(w http.ResponseWriter, r *http.Request) {
+	lp := filepath.Join(conf.TemplateDir, "audit.html")
+
+	tmpl, err := template.ParseFiles(lp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	query := r.URL.Query()
+	filter, err := db.ParseAuditFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := db.LoadAuditPage(filter)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	user, _ := db.CurrentUser(r)
+	data := AuditData{Page: page, Query: query, Actions: db.AuditActions, TargetTypes: db.AuditTargetTypes, User: user}
+
+	filters := url.Values{}
+	for key, values := range query {
+		if key != "before" && key != "limit" {
+			filters[key] = values
+		}
+	}
+	data.ExportURL = "/api/audit/export?" + filters.Encode()
+	if page.NextBefore != 0 {
+		next := url.Values{}
+		for key, values := range filters {
+			next[key] = values
+		}
+		next.Set("before", strconv.FormatInt(page.NextBefore, 10))
+		data.NextURL = "/audit?" + next.Encode()
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+}
+
+// SubscriptionData is passed to the template confirming or cancelling a subscription.
+type SubscriptionData struct {
+	// Action is "confirm" or "unsubscribe".
+	Action string
+	Token  string
+	// Email is the subscribed address, empty when the token doesn't belong to any subscriber.
+	Email string
+}
+
+// RenderSubscription asks the subscriber to confirm or cancel the subscription.
+// The change itself is posted from the page, so that mail scanners opening the links don't make it.
+func RenderSubscription(action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lp := filepath.Join(conf.TemplateDir, "subscription.html")
+
+		tmpl, err := template.ParseFiles(lp)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Error(err)
+			return
+		}
+
+		data := SubscriptionData{Action: action, Token: r.URL.Query().Get("token")}
+		if data.Token != "" {
+			subscriber, err := db.DB.SubscriberByToken(data.Token)
+			if err != nil && !errors.Is(err, db.ErrNotFound) {
+				w.WriteHeader(http.StatusInternalServerError)
+				log.Error(err)
+				return
+			}
+			data.Email = subscriber.Email
+		}
+		if data.Email == "" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+
+		if err := tmpl.Execute(w, data); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Error(err)
+			return
+		}
+	}
 }
@@ -0,0 +1,167 @@
+// Package broadcast passes notifications about changes to everything in the process that listens for them,
+// e.g. browsers connected to the event stream.
+package broadcast
+
+import (
+	"sync"
+)
+
+// Types of events published about reports.
+const (
+	ReportCreated  = "report.created"
+	ReportEdited   = "report.edited"
+	ReportSolved   = "report.solved"
+	ReportReopened = "report.reopened"
+	ReportDeleted  = "report.deleted"
+	// ReportRestored is published when a deleted report is brought back from the trash.
+	ReportRestored = "report.restored"
+	// UpdatePosted is published when an incident update is posted to a report.
+	UpdatePosted = "update.posted"
+)
+
+// Types of events published about maintenance windows.
+const (
+	MaintenanceScheduled = "maintenance.scheduled"
+	MaintenanceEdited    = "maintenance.edited"
+	// MaintenanceStarted and MaintenanceCompleted are published by the scheduler when the window opens and closes.
+	MaintenanceStarted   = "maintenance.started"
+	MaintenanceCompleted = "maintenance.completed"
+	MaintenanceCancelled = "maintenance.cancelled"
+)
+
+// Types lists every type of event.
+var Types = []string{ReportCreated, ReportEdited, ReportSolved, ReportReopened, ReportDeleted, ReportRestored, UpdatePosted,
+	MaintenanceScheduled, MaintenanceEdited, MaintenanceStarted, MaintenanceCompleted, MaintenanceCancelled}
+
+// bufferSize is the number of events a subscriber may fall behind before it's dropped.
+const bufferSize = 32
+
+// Event is a notification about a change.
+type Event struct {
+	// Type names what happened, e.g. ReportCreated.
+	Type string
+	// Data is the changed object, which has to be encodable as JSON.
+	Data any
+	// Public replaces Data on the public event stream when set, for changes whose details only some users may see.
+	Public any
+	// Cause is what brought the change about when it followed from another one, e.g. the update which solved a report.
+	// It's only passed to listeners and subscribers in the process, never sent out.
+	Cause any
+}
+
+// Broker delivers every published event to all subscribers.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	listeners   map[int]func(Event)
+	lastID      int
+	closed      bool
+}
+
+// New creates a broker without subscribers.
+func New() *Broker {
+	return &Broker{subscribers: map[chan Event]struct{}{}, listeners: map[int]func(Event){}}
+}
+
+// Default is the broker used by the whole app.
+var Default = New()
+
+// Subscribe returns a channel receiving the events published from now on, and a function cancelling the subscription.
+// The channel is closed when the subscription is cancelled, when the subscriber falls too far behind
+// and when the broker is closed, so it's always safe to range over it.
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, bufferSize)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(ch)
+	}
+}
+
+// Listen calls f with every event published from now on, until the returned function is called.
+// Unlike subscribers, listeners never miss an event, because Publish calls them right away.
+// That also means f holds up the publisher, so it must be quick.
+func (b *Broker) Listen(f func(Event)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	id := b.lastID
+	b.listeners[id] = f
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.listeners, id)
+	}
+}
+
+// Publish calls the listeners and sends the event to every subscriber without waiting for them.
+// Subscribers whose buffer is full are dropped, so a stuck one can't hold up the others.
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	listeners := make([]func(Event), 0, len(b.listeners))
+	for _, f := range b.listeners {
+		listeners = append(listeners, f)
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			b.remove(ch)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, f := range listeners {
+		f(event)
+	}
+}
+
+// Close ends every subscription. Later subscriptions get a closed channel, while listeners keep being called.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subscribers {
+		b.remove(ch)
+	}
+}
+
+// remove ends the subscription, if it's still active. b.mu must be held.
+func (b *Broker) remove(ch chan Event) {
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Publish sends the event to the subscribers of the Default broker.
+func Publish(eventType string, data any) {
+	Default.Publish(Event{Type: eventType, Data: data})
+}
+
+// Listen adds a listener to the Default broker.
+func Listen(f func(Event)) func() {
+	return Default.Listen(f)
+}
+
+// Subscribe subscribes to the Default broker.
+func Subscribe() (<-chan Event, func()) {
+	return Default.Subscribe()
+}
+
+// Close closes the Default broker.
+func Close() {
+	Default.Close()
+}
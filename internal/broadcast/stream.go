@@ -0,0 +1,83 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// heartbeatInterval is how often a comment is sent on idle streams, so that proxies don't close them.
+const heartbeatInterval = 25 * time.Second
+
+// StreamHandler sends the events published to the Default broker as Server-Sent Events,
+// until the client disconnects or the broker is closed on shutdown.
+//
+// @Summary Stream report changes
+// @Description Streams changes as Server-Sent Events. The event name is the type of the change
+// @Description (report.created, report.edited, report.solved, report.reopened, report.deleted, report.restored or update.posted)
+// @Description and the data is the report or incident update as JSON. Reports moved to or restored from the trash
+// @Description only come with their ID, as in {"id": 1}, since the trash is only visible to admins.
+// @Description Who created reports, updates and maintenances is left out, as on the rest of the public API.
+// @Description A comment is sent every 25 seconds to keep the stream open.
+// @Tags reports
+// @Produce text/event-stream
+// @Success 200
+// @Router /events [get]
+func StreamHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// The stream is kept open for much longer than the write timeout of the server
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Error("Failed to clear write deadline of event stream", "err", err)
+	}
+
+	events, cancel := Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Stop nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case event, ok := <-events:
+			if !ok {
+				// The subscription ended, browsers will reconnect on their own if the server is still up
+				return
+			}
+			payload := event.Data
+			if event.Public != nil {
+				payload = event.Public
+			}
+			var data []byte
+			data, err = json.Marshal(payload)
+			if err != nil {
+				log.Error("Failed to encode event", "type", event.Type, "err", err)
+				continue
+			}
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package broadcast
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStreamSendsPublicPayload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(StreamHandler))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The headers are only sent once the stream is subscribed, so nothing published from now on is missed
+	defer resp.Body.Close()
+
+	type report struct {
+		ID        int    `json:"id"`
+		DeletedBy string `json:"deletedBy"`
+	}
+	Default.Publish(Event{Type: ReportCreated, Data: report{ID: 1}})
+	Default.Publish(Event{Type: ReportDeleted, Data: report{ID: 1, DeletedBy: "admin"}, Public: map[string]int{"id": 1}})
+
+	want := []string{
+		"event: report.created", `data: {"id":1,"deletedBy":""}`, "",
+		"event: report.deleted", `data: {"id":1}`, "",
+	}
+	lines := bufio.NewScanner(resp.Body)
+	for _, line := range want {
+		if !lines.Scan() {
+			t.Fatalf("stream ended before %q: %v", line, lines.Err())
+		}
+		if lines.Text() != line {
+			t.Errorf("got %q, want %q", lines.Text(), line)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Package checker probes configured targets in the background and keeps reports about them up to date:
+// a report is opened after a number of failed probes in a row and solved after a number of successful ones.
+package checker
+
+import (
+	"context"
+	"errors"
+	"example/downdetector/internal/config"
+	"example/downdetector/internal/db"
+	"example/downdetector/internal/utils"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// Checker runs the health checks.
+type Checker struct {
+	checks []*check
+}
+
+// check is a configured check together with its recent results.
+type check struct {
+	config.Check
+	failures  int
+	successes int
+	// reportID is the open report about the check, 0 if there is none.
+	reportID uint
+}
+
+// Actor is the name reports opened and solved by the check are attributed to.
+func Actor(name string) string {
+	return "check:" + name
+}
+
+// New prepares the checks. Reports left open by the checks before a restart are picked up again,
+// so the database has to be connected.
+func New(checks []config.Check) (*Checker, error) {
+	c := &Checker{}
+	for _, cfg := range checks {
+		c.checks = append(c.checks, &check{Check: cfg.WithDefaults()})
+	}
+
+	reports, err := db.DB.OpenReports()
+	if err != nil {
+		return nil, err
+	}
+	for _, ch := range c.checks {
+		for _, report := range reports {
+			if report.CreatedBy == Actor(ch.Name) {
+				ch.reportID = report.ID
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// Run probes every check at its interval until ctx is cancelled.
+func (c *Checker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, ch := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(ch.Interval)
+			defer ticker.Stop()
+
+			for {
+				c.probe(ctx, ch)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// CheckAll probes every check once, one after another, e.g. in tests. It must not be called while Run is running.
+func (c *Checker) CheckAll(ctx context.Context) {
+	for _, ch := range c.checks {
+		c.probe(ctx, ch)
+	}
+}
+
+// probe runs a single attempt of the check and records its result.
+func (c *Checker) probe(ctx context.Context, ch *check) {
+	probeCtx, cancel := context.WithTimeout(ctx, ch.Timeout)
+	err := Probes[ch.Type](probeCtx, ch.Check)
+	cancel()
+
+	// Probes interrupted by a shutdown say nothing about the target
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		ch.successes = 0
+		ch.failures++
+		utils.NoReportLog.Warn("Check failed", "check", ch.Name, "failures", ch.failures, "err", err)
+		if ch.failures >= ch.Failures {
+			c.openReport(ch, err)
+		}
+		return
+	}
+
+	ch.failures = 0
+	if ch.reportID == 0 {
+		return
+	}
+	ch.successes++
+	if ch.successes >= ch.Successes {
+		c.solveReport(ch)
+	}
+}
+
+// openReport opens a report about the failing check, unless one is already open.
+func (c *Checker) openReport(ch *check, cause error) {
+	if ch.reportID != 0 {
+		open, err := reportOpen(ch.reportID)
+		if err != nil {
+			log.Error("Failed to select report", "check", ch.Name, "err", err)
+			return
+		}
+		if open {
+			return
+		}
+		// Someone solved or removed the report while the target is still down
+		ch.reportID = 0
+	}
+
+	services, err := serviceIDs(ch.Service)
+	if err != nil {
+		log.Error("Failed to find service", "check", ch.Name, "err", err)
+		return
+	}
+
+	report, err := db.SubmitReport(db.NewReport{
+		Title:    fmt.Sprintf("%s nie działa", ch.Name),
+		Content:  fmt.Sprintf("Automatyczny test %s (%s) nie powiódł się %d razy z rzędu: %v", ch.Target, ch.Type, ch.failures, cause),
+		Severity: db.SeverityMajor,
+		Services: services,
+	}, Actor(ch.Name))
+	if err != nil {
+		log.Error("Failed to insert report", "check", ch.Name, "err", err)
+		return
+	}
+
+	ch.reportID = report.ID
+	utils.NoReportLog.Infof("check %s opened report %d", ch.Name, report.ID)
+}
+
+// solveReport solves the report about the check which recovered.
+func (c *Checker) solveReport(ch *check) {
+	id := ch.reportID
+	open, err := reportOpen(id)
+	if err == nil && open {
+		_, err = db.ResolveReport(id, Actor(ch.Name))
+	}
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		log.Error("Failed to solve report", "check", ch.Name, "err", err)
+		return
+	}
+
+	ch.reportID, ch.successes = 0, 0
+	if open {
+		utils.NoReportLog.Infof("check %s solved report %d", ch.Name, id)
+	}
+}
+
+// reportOpen reports whether the report still exists and isn't solved.
+func reportOpen(id uint) (bool, error) {
+	report, err := db.DB.Report(id)
+	if errors.Is(err, db.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil && !report.IsSolved, err
+}
+
+// serviceIDs looks up the service reports of a check are attached to.
+func serviceIDs(name string) ([]int64, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	services, err := db.DB.Services()
+	if err != nil {
+		return nil, err
+	}
+	for _, service := range services {
+		if strings.EqualFold(service.Name, name) {
+			return []int64{service.ID}, nil
+		}
+	}
+
+	utils.NoReportLog.Warn("Check refers to an unknown service", "service", name)
+	return nil, nil
+}
@@ -0,0 +1,159 @@
+package checker
+
+import (
+	"context"
+	"example/downdetector/internal/config"
+	"example/downdetector/internal/db"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setupStore connects the checker to an empty in-memory store.
+func setupStore(t *testing.T) {
+	t.Helper()
+	if err := db.Open(config.Config{DBDriver: config.DriverMemory}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DB.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+}
+
+// target is a local stand-in for a checked site, which is healthy until told otherwise.
+type target struct {
+	*httptest.Server
+	down atomic.Bool
+}
+
+func newTarget(t *testing.T) *target {
+	tg := &target{}
+	tg.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tg.down.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(tg.Close)
+	return tg
+}
+
+func newCheck(tg *target) config.Check {
+	return config.Check{Name: "api", Type: config.CheckHTTP, Target: tg.URL, Timeout: time.Second, Failures: 2, Successes: 2, Service: "API"}
+}
+
+// openReports returns the open reports about the check.
+func openReports(t *testing.T) []db.Report {
+	t.Helper()
+	reports, err := db.DB.OpenReports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return slices.DeleteFunc(reports, func(r db.Report) bool { return r.CreatedBy != Actor("api") })
+}
+
+// checkTimes probes every check of c n times.
+func checkTimes(c *Checker, n int) {
+	for range n {
+		c.CheckAll(context.Background())
+	}
+}
+
+func TestReportOpenedAfterFailuresAndSolvedAfterSuccesses(t *testing.T) {
+	setupStore(t)
+	service, err := db.DB.CreateService(db.Service{Name: "API"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg := newTarget(t)
+	c, err := New([]config.Check{newCheck(tg)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkTimes(c, 1)
+	if reports := openReports(t); len(reports) != 0 {
+		t.Fatalf("healthy target got reports: %+v", reports)
+	}
+
+	tg.down.Store(true)
+	checkTimes(c, 1)
+	if reports := openReports(t); len(reports) != 0 {
+		t.Fatalf("report opened after a single failure: %+v", reports)
+	}
+	checkTimes(c, 1)
+	reports := openReports(t)
+	if len(reports) != 1 {
+		t.Fatalf("got %d open reports after 2 failures, want 1", len(reports))
+	}
+	report := reports[0]
+	if report.Severity != db.SeverityMajor || !slices.Equal(report.ServiceIDs, []int64{service.ID}) {
+		t.Errorf("report = %+v, want a major report about service %d", report, service.ID)
+	}
+	// Opened like a report submitted from the dashboard, with its history
+	events, err := db.DB.ReportEvents(report.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Action != db.EventCreated || events[0].Actor != Actor("api") {
+		t.Errorf("events = %+v, want a single creation by the check", events)
+	}
+
+	// Failing on doesn't open another one
+	checkTimes(c, 3)
+	if reports := openReports(t); len(reports) != 1 {
+		t.Fatalf("got %d open reports while still failing, want 1", len(reports))
+	}
+
+	tg.down.Store(false)
+	checkTimes(c, 1)
+	if reports := openReports(t); len(reports) != 1 {
+		t.Fatal("report solved after a single success")
+	}
+	checkTimes(c, 1)
+	if reports := openReports(t); len(reports) != 0 {
+		t.Fatalf("report still open after 2 successes: %+v", reports)
+	}
+	solved, err := db.DB.Report(report.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !solved.IsSolved || solved.ResolvedAt == nil {
+		t.Errorf("report = %+v, want it solved", solved)
+	}
+}
+
+func TestOpenReportPickedUpAfterRestart(t *testing.T) {
+	setupStore(t)
+	tg := newTarget(t)
+	tg.down.Store(true)
+	before, err := New([]config.Check{newCheck(tg)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTimes(before, 2)
+	reports := openReports(t)
+	if len(reports) != 1 {
+		t.Fatalf("got %d open reports, want 1", len(reports))
+	}
+
+	after, err := New([]config.Check{newCheck(tg)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTimes(after, 2)
+	if got := openReports(t); len(got) != 1 || got[0].ID != reports[0].ID {
+		t.Fatalf("open reports after restart = %+v, want only report %d", got, reports[0].ID)
+	}
+
+	tg.down.Store(false)
+	checkTimes(after, 2)
+	if got := openReports(t); len(got) != 0 {
+		t.Fatalf("report left open after recovery: %+v", got)
+	}
+}
@@ -0,0 +1,81 @@
+package checker
+
+import (
+	"context"
+	"example/downdetector/internal/config"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// maxBodySize limits how much of an http response is searched for the expected body.
+const maxBodySize = 1 << 20
+
+// Probe runs a single attempt of a check and returns why it failed, or nil if the target is healthy.
+// The context is cancelled when the check times out.
+type Probe func(ctx context.Context, check config.Check) error
+
+// Probes are the probes used for each type of check.
+var Probes = map[string]Probe{
+	config.CheckHTTP: ProbeHTTP,
+	config.CheckTCP:  ProbeTCP,
+	config.CheckDNS:  ProbeDNS,
+}
+
+// ProbeHTTP requests the target URL and checks the status code and the body of the response.
+func ProbeHTTP(ctx context.Context, check config.Check) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, check.Target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "noticeboard-checker")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if check.ExpectedStatus != 0 && resp.StatusCode != check.ExpectedStatus {
+		return fmt.Errorf("unexpected status %s, expected %d", resp.Status, check.ExpectedStatus)
+	}
+	if check.ExpectedStatus == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	if check.ExpectedBody != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		if !strings.Contains(string(body), check.ExpectedBody) {
+			return fmt.Errorf("response doesn't contain %q", check.ExpectedBody)
+		}
+	}
+
+	return nil
+}
+
+// ProbeTCP opens a connection to the target.
+func ProbeTCP(ctx context.Context, check config.Check) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", check.Target)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// ProbeDNS resolves the target host name.
+func ProbeDNS(ctx context.Context, check config.Check) error {
+	addrs, err := net.DefaultResolver.LookupHost(ctx, check.Target)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("%s has no addresses", check.Target)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package db
+
+import (
+	"encoding/json"
+	"example/downdetector/internal/utils"
+	"net/http"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// NewUser is the payload used by admins to create an account.
+type NewUser struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     Role   `json:"role"`
+}
+
+// UserUpdate is the payload used by admins to change an account.
+// Fields left out of the request are not changed.
+type UserUpdate struct {
+	Username *string `json:"username,omitempty"`
+	Role     *Role   `json:"role,omitempty"`
+	Disabled *bool   `json:"disabled,omitempty"`
+}
+
+// PasswordReset holds the new password of an account after a reset.
+type PasswordReset struct {
+	Password string `json:"password"`
+}
+
+// resetPasswordLength is the length of passwords generated by ResetPasswordHandler.
+const resetPasswordLength = 16
+
+// ListUsersHandler returns all users.
+//
+// @Summary List users
+// @Description Returns all accounts with their roles. Requires the admin role.
+// @Tags admin
+// @Produce json
+// @Success 200 {array} User
+// @Failure 403
+// @Failure 500
+// @Router /users [get]
+func ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := DB.Users()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select users", "err", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, users)
+}
+
+// CreateUserHandler creates a new account.
+//
+// @Summary Create a user
+// @Description Creates a new account with the given role. Requires the admin role.
+// @Tags admin
+// @Accept json
+// @Produce plain
+// @Param user body NewUser true "New user"
+// @Success 201
+// @Failure 400
+// @Failure 403
+// @Failure 409
+// @Failure 500
+// @Router /users [post]
+func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	newUser := NewUser{}
+	if err := json.NewDecoder(r.Body).Decode(&newUser); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newUser.Username = strings.TrimSpace(newUser.Username)
+	if newUser.Username == "" {
+		http.Error(w, "Username can't be empty", http.StatusBadRequest)
+		return
+	}
+	if newUser.Role == "" {
+		newUser.Role = RoleViewer
+	}
+	if !newUser.Role.Valid() {
+		http.Error(w, "Unknown role", http.StatusBadRequest)
+		return
+	}
+	if err := validatePassword(newUser.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if taken, err := DB.UsernameTaken(newUser.Username); err != nil || taken {
+		writeUsernameError(w, err)
+		return
+	}
+
+	hash, err := HashPassword(newUser.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to hash password", "err", err)
+		return
+	}
+
+	created := User{Username: newUser.Username, Role: newUser.Role}
+	err = DB.CreateUser(created, hash)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to insert user", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s created user %s with role %s", ip, newUser.Username, newUser.Role)
+	audit(r, AuditUserCreated, "user", created.Username, nil, created)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// UpdateUserHandler renames, changes the role of, disables or enables an account.
+//
+// @Summary Update a user
+// @Description Renames an account, changes its role or disables it. Requires the admin role.
+// @Description The last enabled admin can't be demoted nor disabled.
+// @Tags admin
+// @Accept json
+// @Produce plain
+// @Param username path string true "Username"
+// @Param user body UserUpdate true "Changed fields"
+// @Success 200
+// @Failure 400
+// @Failure 403
+// @Failure 404
+// @Failure 409
+// @Failure 500
+// @Router /users/{username} [put]
+func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+
+	update := UserUpdate{}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := DB.User(username)
+	if err == errUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select user from DB", "err", err)
+		return
+	}
+
+	updated := user
+	if update.Role != nil {
+		if !update.Role.Valid() {
+			http.Error(w, "Unknown role", http.StatusBadRequest)
+			return
+		}
+		updated.Role = *update.Role
+	}
+	if update.Disabled != nil {
+		updated.Disabled = *update.Disabled
+	}
+	if update.Username != nil && strings.TrimSpace(*update.Username) != user.Username {
+		updated.Username = strings.TrimSpace(*update.Username)
+		if updated.Username == "" {
+			http.Error(w, "Username can't be empty", http.StatusBadRequest)
+			return
+		}
+		if taken, err := DB.UsernameTaken(updated.Username); err != nil || taken {
+			writeUsernameError(w, err)
+			return
+		}
+	}
+
+	// Make sure there is always someone left to manage the users
+	if user.IsAdmin() && !user.Disabled && (!updated.IsAdmin() || updated.Disabled) {
+		admins, err := DB.CountActiveAdmins()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Error("Failed to count admins", "err", err)
+			return
+		}
+		if admins <= 1 {
+			http.Error(w, "Can't demote nor disable the last admin", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = DB.UpdateUser(user.Username, updated)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to update user", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s updated user %s: username=%s role=%s disabled=%t", ip, user.Username, updated.Username, updated.Role, updated.Disabled)
+	audit(r, AuditUserUpdated, "user", user.Username, user, updated)
+	w.WriteHeader(http.StatusOK)
+}
+
+// ResetPasswordHandler sets a new random password for an account.
+//
+// @Summary Reset a user's password
+// @Description Replaces the password of an account with a random one and returns it. Requires the admin role.
+// @Tags admin
+// @Produce json
+// @Param username path string true "Username"
+// @Success 200 {object} PasswordReset
+// @Failure 403
+// @Failure 404
+// @Failure 500
+// @Router /users/{username}/password [post]
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+
+	password := utils.GenerateRandomString(resetPasswordLength)
+	hash, err := HashPassword(password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to hash password", "err", err)
+		return
+	}
+
+	err = DB.SetPassword(username, hash)
+	if err == errUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to reset password", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s reset password of user %s", ip, username)
+	audit(r, AuditPasswordReset, "user", username, nil, nil)
+	utils.WriteJSON(w, http.StatusOK, PasswordReset{Password: password})
+}
+
+// writeUsernameError responds to a failed usernameTaken check.
+func writeUsernameError(w http.ResponseWriter, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to check username", "err", err)
+		return
+	}
+	http.Error(w, "Username already taken", http.StatusConflict)
+}
@@ -0,0 +1,358 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"example/downdetector/internal/utils"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 500
+	// maxAuditText limits the length of what the client sends and ends up in the audit log, like the user agent.
+	maxAuditText = 512
+)
+
+// AuditAction is what was done by the actor of an audit log entry.
+type AuditAction string
+
+const (
+	AuditLogin           AuditAction = "user.login"
+	AuditLoginFailed     AuditAction = "user.login_failed"
+	AuditLogout          AuditAction = "user.logout"
+	AuditPasswordChanged AuditAction = "user.password_changed"
+	AuditUserCreated     AuditAction = "user.created"
+	AuditUserUpdated     AuditAction = "user.updated"
+	AuditPasswordReset   AuditAction = "user.password_reset"
+	AuditLoginBlocked    AuditAction = "user.login_blocked"
+	AuditUserLocked      AuditAction = "user.locked"
+	AuditUserUnlocked    AuditAction = "user.unlocked"
+
+	AuditTwoFactorEnabled       AuditAction = "user.2fa_enabled"
+	AuditTwoFactorDisabled      AuditAction = "user.2fa_disabled"
+	AuditTwoFactorReset         AuditAction = "user.2fa_reset"
+	AuditTwoFactorFailed        AuditAction = "user.2fa_failed"
+	AuditRecoveryCodesGenerated AuditAction = "user.recovery_codes_generated"
+	AuditRecoveryCodeUsed       AuditAction = "user.recovery_code_used"
+
+	AuditReportCreated  AuditAction = "report.created"
+	AuditReportEdited   AuditAction = "report.edited"
+	AuditReportDeleted  AuditAction = "report.deleted"
+	AuditReportRestored AuditAction = "report.restored"
+	AuditUpdatePosted   AuditAction = "update.posted"
+
+	AuditMaintenanceScheduled AuditAction = "maintenance.scheduled"
+	AuditMaintenanceEdited    AuditAction = "maintenance.edited"
+	AuditMaintenanceCancelled AuditAction = "maintenance.cancelled"
+
+	AuditServiceCreated AuditAction = "service.created"
+	AuditServiceUpdated AuditAction = "service.updated"
+	AuditServiceDeleted AuditAction = "service.deleted"
+
+	AuditTokenCreated AuditAction = "token.created"
+	AuditTokenRevoked AuditAction = "token.revoked"
+
+	AuditWebhookCreated     AuditAction = "webhook.created"
+	AuditWebhookUpdated     AuditAction = "webhook.updated"
+	AuditWebhookDeleted     AuditAction = "webhook.deleted"
+	AuditWebhookRedelivered AuditAction = "webhook.redelivered"
+
+	AuditSettingsUpdated AuditAction = "settings.updated"
+)
+
+// AuditActions lists every action recorded in the audit log.
+var AuditActions = []AuditAction{
+	AuditLogin, AuditLoginFailed, AuditLogout, AuditPasswordChanged, AuditUserCreated, AuditUserUpdated, AuditPasswordReset,
+	AuditLoginBlocked, AuditUserLocked, AuditUserUnlocked,
+	AuditTwoFactorEnabled, AuditTwoFactorDisabled, AuditTwoFactorReset, AuditTwoFactorFailed, AuditRecoveryCodesGenerated, AuditRecoveryCodeUsed,
+	AuditReportCreated, AuditReportEdited, AuditReportDeleted, AuditReportRestored, AuditUpdatePosted,
+	AuditMaintenanceScheduled, AuditMaintenanceEdited, AuditMaintenanceCancelled,
+	AuditServiceCreated, AuditServiceUpdated, AuditServiceDeleted,
+	AuditTokenCreated, AuditTokenRevoked,
+	AuditWebhookCreated, AuditWebhookUpdated, AuditWebhookDeleted, AuditWebhookRedelivered,
+	AuditSettingsUpdated,
+}
+
+// AuditTargetTypes lists every kind of target of the actions recorded in the audit log.
+var AuditTargetTypes = []string{"user", "report", "maintenance", "service", "token", "webhook", "settings"}
+
+// AuditChange is the JSON value of a field before and after an action, null when the target didn't exist.
+type AuditChange struct {
+	Before json.RawMessage `json:"before" swaggertype:"object"`
+	After  json.RawMessage `json:"after" swaggertype:"object"`
+}
+
+// AuditEntry records who did what to which target, from where. Entries are never changed nor removed.
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Actor is the username of whoever did it, empty for failed logins.
+	Actor     string      `json:"actor"`
+	IP        string      `json:"ip"`
+	UserAgent string      `json:"userAgent"`
+	Action    AuditAction `json:"action"`
+	// TargetType and TargetID identify what the action was done to, e.g. "report" and "42" or "user" and "alice".
+	TargetType string `json:"targetType"`
+	TargetID   string `json:"targetId"`
+	// Changes holds the fields of the target changed by the action, by field name.
+	Changes map[string]AuditChange `json:"changes"`
+}
+
+// AuditFilter selects the audit log entries returned by AuditEntries. Empty fields match anything.
+type AuditFilter struct {
+	Actor      string
+	Action     AuditAction
+	TargetType string
+	TargetID   string
+	// From and To limit the time of the entries, To is exclusive.
+	From, To *time.Time
+	// Before continues the listing after the entry with this ID, 0 starts with the newest one.
+	Before int64
+	// Limit is the maximum number of entries, 0 means all of them.
+	Limit int
+}
+
+// AuditPage is a single page of the audit log.
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	// NextBefore is passed as the before parameter to get the next, older page, 0 on the last page.
+	NextBefore int64 `json:"nextBefore,omitempty"`
+}
+
+// auditChanges compares the JSON fields of the target before and after the action. Either can be nil,
+// when the target was created or removed.
+func auditChanges(before, after any) (map[string]AuditChange, error) {
+	fields := func(v any) (map[string]json.RawMessage, error) {
+		m := map[string]json.RawMessage{}
+		if v == nil {
+			return m, nil
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return m, json.Unmarshal(b, &m)
+	}
+
+	was, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	is, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	// Missing fields are left nil like null ones, so that a field which is null on both sides isn't a change
+	value := func(m map[string]json.RawMessage, name string) json.RawMessage {
+		if string(m[name]) == "null" {
+			return nil
+		}
+		return m[name]
+	}
+	changes := map[string]AuditChange{}
+	for _, m := range []map[string]json.RawMessage{was, is} {
+		for name := range m {
+			change := AuditChange{Before: value(was, name), After: value(is, name)}
+			if string(change.Before) != string(change.After) {
+				changes[name] = change
+			}
+		}
+	}
+	return changes, nil
+}
+
+// clientIP returns the address the request came from, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// truncate cuts s down to at most n bytes, keeping whole characters.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// audit records an action of the logged-in user in the audit log, see auditAs.
+func audit(r *http.Request, action AuditAction, targetType string, targetID any, before, after any) {
+	user, _ := CurrentUser(r)
+	auditAs(r, user.Username, action, targetType, targetID, before, after)
+}
+
+// auditAs records an action of actor in the audit log, together with the fields of the target it changed.
+// The action has already happened by then, so failing to record it is only logged.
+func auditAs(r *http.Request, actor string, action AuditAction, targetType string, targetID any, before, after any) {
+	changes, err := auditChanges(before, after)
+	if err == nil {
+		_, err = DB.AddAuditEntry(AuditEntry{
+			CreatedAt:  now(),
+			Actor:      truncate(actor, maxAuditText),
+			IP:         clientIP(r),
+			UserAgent:  truncate(r.UserAgent(), maxAuditText),
+			Action:     action,
+			TargetType: targetType,
+			TargetID:   truncate(fmt.Sprint(targetID), maxAuditText),
+			Changes:    changes,
+		})
+	}
+	if err != nil {
+		log.Error("Failed to record audit log entry", "action", action, "actor", actor, "err", err)
+	}
+}
+
+// auditedWebhook replaces the secret of the webhook with a fingerprint, which tells whether it changed
+// without revealing it to whoever reads the audit log.
+func auditedWebhook(webhook Webhook) Webhook {
+	sum := sha256.Sum256([]byte(webhook.Secret))
+	webhook.Secret = "sha256:" + hex.EncodeToString(sum[:4])
+	return webhook
+}
+
+// ParseAuditFilter reads the filter from the query parameters of a request for the audit log.
+func ParseAuditFilter(query url.Values) (AuditFilter, error) {
+	filter := AuditFilter{
+		Actor:      query.Get("actor"),
+		Action:     AuditAction(query.Get("action")),
+		TargetType: query.Get("targetType"),
+		TargetID:   query.Get("targetId"),
+		Limit:      defaultAuditPageSize,
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxAuditPageSize {
+			return AuditFilter{}, fmt.Errorf("limit must be a number between 1 and %d", maxAuditPageSize)
+		}
+		filter.Limit = n
+	}
+
+	if before := query.Get("before"); before != "" {
+		id, err := strconv.ParseInt(before, 10, 64)
+		if err != nil || id < 1 {
+			return AuditFilter{}, errors.New("before must be an entry ID")
+		}
+		filter.Before = id
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(query.Get("from")); err != nil {
+		return AuditFilter{}, fmt.Errorf("from: %w", err)
+	}
+	if filter.To, err = parseTimeParam(query.Get("to")); err != nil {
+		return AuditFilter{}, fmt.Errorf("to: %w", err)
+	}
+
+	return filter, nil
+}
+
+// LoadAuditPage returns a page of the entries matching the filter, newest first.
+func LoadAuditPage(filter AuditFilter) (AuditPage, error) {
+	limit := filter.Limit
+	// Fetch one more entry to know if there is a next page
+	filter.Limit++
+	entries, err := DB.AuditEntries(filter)
+	if err != nil {
+		return AuditPage{}, err
+	}
+
+	page := AuditPage{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.NextBefore = page.Entries[limit-1].ID
+	}
+	return page, nil
+}
+
+// ListAuditHandler returns a filtered page of the audit log.
+//
+// @Summary List the audit log
+// @Description Returns the audit log entries matching the filters, newest first, a page at a time.
+// @Description Pass the returned nextBefore as the before parameter, together with the same filters, to get the next page.
+// @Description Requires the admin role.
+// @Tags audit
+// @Produce json
+// @Param actor query string false "Only entries of the user with this username"
+// @Param action query string false "Only entries of this action, e.g. report.deleted"
+// @Param targetType query string false "Only entries about this kind of target, e.g. report"
+// @Param targetId query string false "Only entries about the target with this ID or username"
+// @Param from query string false "Recorded at or after, RFC 3339 timestamp or YYYY-MM-DD"
+// @Param to query string false "Recorded before, RFC 3339 timestamp or YYYY-MM-DD"
+// @Param before query int false "Only entries older than the one with this ID"
+// @Param limit query int false "Page size" minimum(1) maximum(500) default(100)
+// @Success 200 {object} AuditPage
+// @Failure 400
+// @Failure 403
+// @Failure 500
+// @Router /audit [get]
+func ListAuditHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := ParseAuditFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := LoadAuditPage(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select audit log", "err", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, page)
+}
+
+// ExportAuditHandler downloads the audit log.
+//
+// @Summary Export the audit log
+// @Description Downloads every audit log entry matching the filters, newest first, as a JSON file. Requires the admin role.
+// @Tags audit
+// @Produce json
+// @Param actor query string false "Only entries of the user with this username"
+// @Param action query string false "Only entries of this action, e.g. report.deleted"
+// @Param targetType query string false "Only entries about this kind of target, e.g. report"
+// @Param targetId query string false "Only entries about the target with this ID or username"
+// @Param from query string false "Recorded at or after, RFC 3339 timestamp or YYYY-MM-DD"
+// @Param to query string false "Recorded before, RFC 3339 timestamp or YYYY-MM-DD"
+// @Success 200 {array} AuditEntry
+// @Failure 400
+// @Failure 403
+// @Failure 500
+// @Router /audit/export [get]
+func ExportAuditHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := ParseAuditFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Before, filter.Limit = 0, 0
+
+	entries, err := DB.AuditEntries(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select audit log", "err", err)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-%s.json"`, time.Now().Format("20060102-150405")))
+	utils.WriteJSON(w, http.StatusOK, entries)
+}
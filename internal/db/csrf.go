@@ -0,0 +1,124 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"example/downdetector/internal/utils"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+const (
+	// csrfCookie hands the CSRF token of the session to the scripts of the pages, which send it back in csrfHeader.
+	// The token is checked against the copy kept in the session, so a cookie planted by another site doesn't help forge requests.
+	csrfCookie = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+	// csrfField carries the token in forms submitted without scripts, like the one logging out.
+	csrfField = "csrf_token"
+)
+
+// publicHost is the host of the configured public URL, which requests coming through a proxy are sent from.
+// It is set by SetupSessions.
+var publicHost string
+
+// setCSRFToken gives the session a new CSRF token and sends it to the browser. The session still has to be saved.
+func setCSRFToken(w http.ResponseWriter, r *http.Request, session *sessions.Session) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	session.Values["csrf"] = token
+	sendCSRFToken(w, r, token, session.Options.MaxAge)
+	return nil
+}
+
+// sendCSRFToken sets the cookie the scripts read the CSRF token from, or removes it when maxAge is negative.
+func sendCSRFToken(w http.ResponseWriter, r *http.Request, token string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   secureCookies || r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// CSRFMiddleware rejects the requests changing something which another site made a logged-in browser send.
+// Such requests have to come from the app's own pages, as told by the Sec-Fetch-Site and Origin headers,
+// and carry the CSRF token of the session when they come with a session cookie.
+// Requests authenticated with an API token are let through, as browsers never add one on their own.
+func CSRFMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := bearerToken(r); ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		err := checkOrigin(r)
+		if err == nil {
+			err = checkCSRFToken(r)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			ip := r.RemoteAddr
+			utils.NoReportLog.Infof("%s sent a forged request to %s %s: %v", ip, r.Method, r.URL.Path, err)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// checkOrigin makes sure the request was sent by a page of the app.
+// Browsers which send neither header are old enough to be left to the CSRF token.
+func checkOrigin(r *http.Request) error {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return errors.New("cross-site request")
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" || (!strings.EqualFold(u.Host, r.Host) && !strings.EqualFold(u.Host, publicHost)) {
+		return errors.New("request from another origin")
+	}
+	return nil
+}
+
+// checkCSRFToken makes sure a request acting through a session carries the CSRF token of that session.
+// Requests without a session don't act as anyone, so there is nothing to forge.
+func checkCSRFToken(r *http.Request) error {
+	session, err := store.Get(r, "auth")
+	if err != nil {
+		// The cookie can't be read, so it doesn't authenticate the request either
+		return nil
+	}
+	if authenticated, _ := session.Values["authenticated"].(bool); !authenticated {
+		return nil
+	}
+
+	token := r.Header.Get(csrfHeader)
+	if token == "" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		token = r.PostFormValue(csrfField)
+	}
+	expected, _ := session.Values["csrf"].(string)
+	if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		return errors.New("missing or invalid CSRF token")
+	}
+	return nil
+}
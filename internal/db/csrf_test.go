@@ -0,0 +1,83 @@
+package db
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// loggedInCookies returns the cookies of an authenticated session with the given CSRF token.
+func loggedInCookies(t *testing.T, token string) []*http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	session, err := store.Get(r, "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values["authenticated"] = true
+	session.Values["username"] = "jan"
+	session.Values["csrf"] = token
+	if err := session.Save(r, w); err != nil {
+		t.Fatal(err)
+	}
+	return w.Result().Cookies()
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	setupTestSessions(t)
+	publicHost = "status.example.com"
+	t.Cleanup(func() { publicHost = "" })
+	const token = "token-of-the-session"
+	cookies := loggedInCookies(t, token)
+	form := url.Values{csrfField: {token}}.Encode()
+
+	tests := []struct {
+		name     string
+		method   string
+		loggedIn bool
+		header   map[string]string
+		body     string
+		want     int
+	}{
+		{"GET", http.MethodGet, true, map[string]string{"Sec-Fetch-Site": "cross-site"}, "", http.StatusOK},
+		{"HEAD", http.MethodHead, true, map[string]string{"Sec-Fetch-Site": "cross-site"}, "", http.StatusOK},
+		{"without a session", http.MethodPost, false, nil, "", http.StatusOK},
+		{"token in the header", http.MethodPost, true, map[string]string{csrfHeader: token}, "", http.StatusOK},
+		{"token in a form field", http.MethodPost, true, map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, form, http.StatusOK},
+		{"missing token", http.MethodPost, true, nil, "", http.StatusForbidden},
+		{"wrong token", http.MethodDelete, true, map[string]string{csrfHeader: "another-token"}, "", http.StatusForbidden},
+		{"token field in a JSON body", http.MethodPost, true, map[string]string{"Content-Type": "application/json"}, form, http.StatusForbidden},
+		{"same origin", http.MethodPost, true, map[string]string{csrfHeader: token, "Sec-Fetch-Site": "same-origin", "Origin": "http://example.com"}, "", http.StatusOK},
+		{"public URL", http.MethodPost, true, map[string]string{csrfHeader: token, "Origin": "https://status.example.com"}, "", http.StatusOK},
+		{"cross-site", http.MethodPost, true, map[string]string{csrfHeader: token, "Sec-Fetch-Site": "cross-site"}, "", http.StatusForbidden},
+		{"same site", http.MethodPost, false, map[string]string{"Sec-Fetch-Site": "same-site"}, "", http.StatusForbidden},
+		{"foreign origin", http.MethodPost, true, map[string]string{csrfHeader: token, "Origin": "https://evil.example.org"}, "", http.StatusForbidden},
+		{"null origin", http.MethodPost, true, map[string]string{csrfHeader: token, "Origin": "null"}, "", http.StatusForbidden},
+		{"API token", http.MethodPost, false, map[string]string{"Authorization": "Bearer abc", "Sec-Fetch-Site": "cross-site"}, "", http.StatusOK},
+		{"API token with a session", http.MethodDelete, true, map[string]string{"Authorization": "Bearer abc"}, "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := CSRFMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			r := httptest.NewRequest(tt.method, "/api/reports", strings.NewReader(tt.body))
+			for name, value := range tt.header {
+				r.Header.Set(name, value)
+			}
+			if tt.loggedIn {
+				for _, cookie := range cookies {
+					r.AddCookie(cookie)
+				}
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
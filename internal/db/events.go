@@ -0,0 +1,77 @@
+package db
+
+import (
+	"example/downdetector/internal/utils"
+	"net/http"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// EventAction names what happened to a report.
+type EventAction string
+
+const (
+	EventCreated  EventAction = "created"
+	EventEdited   EventAction = "edited"
+	EventSolved   EventAction = "solved"
+	EventReopened EventAction = "reopened"
+	EventDeleted  EventAction = "deleted"
+	EventRestored EventAction = "restored"
+)
+
+// ReportEvent is a single entry in the history of a report.
+// It keeps a copy of the report as it was right after the change.
+type ReportEvent struct {
+	ID        int64       `json:"id"`
+	ReportID  uint        `json:"reportId"`
+	Action    EventAction `json:"action"`
+	Actor     string      `json:"actor"`
+	Title     string      `json:"title"`
+	Content   string      `json:"content"`
+	IsSolved  bool        `json:"isSolved"`
+	CreatedAt time.Time   `json:"createdAt"`
+}
+
+// GetAllReportEvents retrieves the history of every report, grouped by report ID.
+func GetAllReportEvents() (map[uint][]ReportEvent, error) {
+	events, err := DB.AllReportEvents()
+	if err != nil {
+		return nil, err
+	}
+
+	grouped := map[uint][]ReportEvent{}
+	for _, event := range events {
+		grouped[event.ReportID] = append(grouped[event.ReportID], event)
+	}
+
+	return grouped, nil
+}
+
+// ReportEventsHandler returns the history of a report.
+//
+// @Summary Get report history
+// @Description Returns every change made to a report, oldest first. Also works for deleted reports.
+// @Tags reports
+// @Produce json
+// @Param id path int true "Report ID"
+// @Success 200 {array} ReportEvent
+// @Failure 500
+// @Router /reports/{id}/events [get]
+func ReportEventsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := reportID(r)
+	if err != nil {
+		// Not a valid report ID, so there is no history
+		utils.WriteJSON(w, http.StatusOK, []ReportEvent{})
+		return
+	}
+
+	events, err := DB.ReportEvents(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select report events", "err", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, events)
+}
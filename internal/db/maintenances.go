@@ -0,0 +1,366 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"example/downdetector/internal/broadcast"
+	"example/downdetector/internal/utils"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// MaintenanceStatus is the stage of a maintenance window.
+type MaintenanceStatus string
+
+const (
+	// MaintenanceScheduled hasn't started yet.
+	MaintenanceScheduled  MaintenanceStatus = "scheduled"
+	MaintenanceInProgress MaintenanceStatus = "in_progress"
+	MaintenanceCompleted  MaintenanceStatus = "completed"
+	// MaintenanceCancelled was called off, before or during the window.
+	MaintenanceCancelled MaintenanceStatus = "cancelled"
+)
+
+// MaintenanceStatuses lists the stages of a maintenance window in the order they happen.
+var MaintenanceStatuses = []MaintenanceStatus{MaintenanceScheduled, MaintenanceInProgress, MaintenanceCompleted, MaintenanceCancelled}
+
+// Finished reports whether the maintenance window is over, so it can't be changed anymore.
+func (s MaintenanceStatus) Finished() bool {
+	return s == MaintenanceCompleted || s == MaintenanceCancelled
+}
+
+// Maintenance is planned downtime announced ahead of time.
+// Its status follows the schedule: it's scheduled until StartsAt, in progress until EndsAt and completed afterwards.
+type Maintenance struct {
+	ID          int64             `json:"id"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+	Status      MaintenanceStatus `json:"status"`
+	// CreatedBy is left out of what anyone can read, see Public.
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// UpdatedAt is when the maintenance was last edited or cancelled.
+	UpdatedAt *time.Time `json:"updatedAt"`
+}
+
+// Public returns the maintenance as shown on the public API and event stream, without who scheduled it.
+func (m Maintenance) Public() Maintenance {
+	m.CreatedBy = ""
+	return m
+}
+
+// StatusAt returns the status the maintenance has at the given time according to its schedule.
+// Cancelled maintenances stay cancelled.
+func (m Maintenance) StatusAt(t time.Time) MaintenanceStatus {
+	switch {
+	case m.Status == MaintenanceCancelled:
+		return MaintenanceCancelled
+	case !t.Before(m.EndsAt):
+		return MaintenanceCompleted
+	case !t.Before(m.StartsAt):
+		return MaintenanceInProgress
+	default:
+		return MaintenanceScheduled
+	}
+}
+
+// NewMaintenance is the payload used to schedule or edit a maintenance window.
+type NewMaintenance struct {
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	StartsAt    time.Time `json:"startsAt"`
+	EndsAt      time.Time `json:"endsAt"`
+}
+
+// ErrMaintenanceFinished is returned when changing a maintenance which is already completed or cancelled.
+var ErrMaintenanceFinished = errors.New("maintenance is already completed or cancelled")
+
+// maintenanceEventTypes are the types of events published when the scheduler moves a maintenance to a status.
+var maintenanceEventTypes = map[MaintenanceStatus]string{
+	MaintenanceInProgress: broadcast.MaintenanceStarted,
+	MaintenanceCompleted:  broadcast.MaintenanceCompleted,
+}
+
+// MaintenanceEventType returns the type of the event published when a maintenance moves to the status on schedule.
+func MaintenanceEventType(status MaintenanceStatus) string {
+	return maintenanceEventTypes[status]
+}
+
+// PublishMaintenance lets everyone listening know that the maintenance changed.
+func PublishMaintenance(eventType string, m Maintenance) {
+	broadcast.Default.Publish(broadcast.Event{Type: eventType, Data: m, Public: m.Public()})
+}
+
+// maintenanceID reads the maintenance ID from the request path.
+// IDs which can't be parsed are reported as not found.
+func maintenanceID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return 0, ErrNotFound
+	}
+	return id, nil
+}
+
+// parseMaintenance reads and validates the maintenance in the request body.
+// The window has to end in the future, otherwise it'd be over as soon as it's saved.
+func parseMaintenance(r *http.Request) (Maintenance, error) {
+	newMaintenance := NewMaintenance{}
+	if err := json.NewDecoder(r.Body).Decode(&newMaintenance); err != nil {
+		return Maintenance{}, err
+	}
+
+	maintenance := Maintenance{
+		Title:       strings.TrimSpace(newMaintenance.Title),
+		Description: strings.TrimSpace(newMaintenance.Description),
+		StartsAt:    newMaintenance.StartsAt.UTC().Truncate(time.Second),
+		EndsAt:      newMaintenance.EndsAt.UTC().Truncate(time.Second),
+	}
+	switch {
+	case maintenance.Title == "":
+		return Maintenance{}, errors.New("title can't be empty")
+	case maintenance.StartsAt.IsZero() || maintenance.EndsAt.IsZero():
+		return Maintenance{}, errors.New("startsAt and endsAt are required")
+	case !maintenance.EndsAt.After(maintenance.StartsAt):
+		return Maintenance{}, errors.New("endsAt must be after startsAt")
+	case !maintenance.EndsAt.After(now()):
+		return Maintenance{}, errors.New("endsAt must be in the future")
+	}
+	return maintenance, nil
+}
+
+// parseMaintenanceStatuses reads a comma-separated list of statuses, nil when it's empty.
+func parseMaintenanceStatuses(value string) ([]MaintenanceStatus, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var statuses []MaintenanceStatus
+	for _, part := range strings.Split(value, ",") {
+		status := MaintenanceStatus(strings.TrimSpace(part))
+		if !slices.Contains(MaintenanceStatuses, status) {
+			return nil, fmt.Errorf("status must be some of %v", MaintenanceStatuses)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// ListMaintenancesHandler returns the maintenance windows.
+//
+// @Summary List maintenance windows
+// @Description Returns the maintenance windows ordered by start, only the ones with the given statuses with ?status=,
+// @Description e.g. ?status=scheduled,in_progress for the upcoming and ongoing ones.
+// @Tags maintenances
+// @Produce json
+// @Param status query string false "Comma-separated statuses: scheduled, in_progress, completed, cancelled"
+// @Success 200 {array} Maintenance
+// @Failure 400
+// @Failure 500
+// @Router /maintenances [get]
+func ListMaintenancesHandler(w http.ResponseWriter, r *http.Request) {
+	statuses, err := parseMaintenanceStatuses(r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	maintenances, err := DB.Maintenances()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select maintenances", "err", err)
+		return
+	}
+	if statuses != nil {
+		maintenances = slices.DeleteFunc(maintenances, func(m Maintenance) bool {
+			return !slices.Contains(statuses, m.Status)
+		})
+	}
+	for i, m := range maintenances {
+		maintenances[i] = m.Public()
+	}
+
+	utils.WriteJSON(w, http.StatusOK, maintenances)
+}
+
+// GetMaintenanceHandler returns a single maintenance window.
+//
+// @Summary Get a maintenance window
+// @Description Returns a single maintenance window.
+// @Tags maintenances
+// @Produce json
+// @Param id path int true "Maintenance ID"
+// @Success 200 {object} Maintenance
+// @Failure 404
+// @Failure 500
+// @Router /maintenances/{id} [get]
+func GetMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := maintenanceID(r)
+	var maintenance Maintenance
+	if err == nil {
+		maintenance, err = DB.Maintenance(id)
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Maintenance not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select maintenance", "err", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, maintenance.Public())
+}
+
+// CreateMaintenanceHandler schedules a maintenance window.
+//
+// @Summary Schedule a maintenance window
+// @Description Announces planned downtime. The maintenance is scheduled until it starts, then in progress until it ends
+// @Description and completed afterwards, which the scheduler takes care of. Requires the editor role.
+// @Tags maintenances
+// @Accept json
+// @Produce json
+// @Param maintenance body NewMaintenance true "New maintenance"
+// @Success 201 {object} Maintenance
+// @Failure 400
+// @Failure 403
+// @Failure 500
+// @Router /maintenances [post]
+func CreateMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	maintenance, err := parseMaintenance(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	user, _ := CurrentUser(r)
+	// The scheduler starts maintenances which are already due, so every one begins its life scheduled
+	maintenance.Status = MaintenanceScheduled
+	maintenance.CreatedBy = user.Username
+	maintenance.CreatedAt = now()
+
+	maintenance, err = DB.CreateMaintenance(maintenance)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to insert maintenance", "err", err)
+		return
+	}
+	PublishMaintenance(broadcast.MaintenanceScheduled, maintenance)
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s scheduled maintenance %d", ip, maintenance.ID)
+	audit(r, AuditMaintenanceScheduled, "maintenance", maintenance.ID, nil, maintenance)
+	w.Header().Set("Location", fmt.Sprintf("/api/maintenances/%d", maintenance.ID))
+	utils.WriteJSON(w, http.StatusCreated, maintenance)
+}
+
+// writeMaintenanceError responds to a failed change of a maintenance.
+func writeMaintenanceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, "Maintenance not found", http.StatusNotFound)
+	case errors.Is(err, ErrMaintenanceFinished):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to update maintenance", "err", err)
+	}
+}
+
+// UpdateMaintenanceHandler replaces the title, description and schedule of a maintenance window.
+//
+// @Summary Edit a maintenance window
+// @Description Replaces the title, description and schedule of a maintenance which isn't completed or cancelled yet.
+// @Description Moving the start of one in progress to the future makes it scheduled again. Requires the editor role.
+// @Tags maintenances
+// @Accept json
+// @Produce json
+// @Param id path int true "Maintenance ID"
+// @Param maintenance body NewMaintenance true "Maintenance"
+// @Success 200 {object} Maintenance
+// @Failure 400
+// @Failure 403
+// @Failure 404
+// @Failure 409 "The maintenance is already completed or cancelled"
+// @Failure 500
+// @Router /maintenances/{id} [put]
+func UpdateMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := maintenanceID(r)
+	if err != nil {
+		http.Error(w, "Maintenance not found", http.StatusNotFound)
+		return
+	}
+	edited, err := parseMaintenance(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var before Maintenance
+	maintenance, err := DB.UpdateMaintenance(id, func(m *Maintenance) error {
+		if m.Status.Finished() {
+			return ErrMaintenanceFinished
+		}
+		before = *m
+		m.Title, m.Description, m.StartsAt, m.EndsAt = edited.Title, edited.Description, edited.StartsAt, edited.EndsAt
+		// The scheduler only moves maintenances forward, so one postponed before it started has to go back
+		if m.StartsAt.After(*m.UpdatedAt) {
+			m.Status = MaintenanceScheduled
+		}
+		return nil
+	})
+	if err != nil {
+		writeMaintenanceError(w, err)
+		return
+	}
+	PublishMaintenance(broadcast.MaintenanceEdited, maintenance)
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s edited maintenance %d", ip, id)
+	audit(r, AuditMaintenanceEdited, "maintenance", id, before, maintenance)
+	utils.WriteJSON(w, http.StatusOK, maintenance)
+}
+
+// CancelMaintenanceHandler calls off a maintenance window.
+//
+// @Summary Cancel a maintenance window
+// @Description Calls off a maintenance which is scheduled or in progress. Requires the editor role.
+// @Tags maintenances
+// @Produce json
+// @Param id path int true "Maintenance ID"
+// @Success 200 {object} Maintenance
+// @Failure 403
+// @Failure 404
+// @Failure 409 "The maintenance is already completed or cancelled"
+// @Failure 500
+// @Router /maintenances/{id}/cancel [post]
+func CancelMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := maintenanceID(r)
+	var maintenance, before Maintenance
+	if err == nil {
+		maintenance, err = DB.UpdateMaintenance(id, func(m *Maintenance) error {
+			if m.Status.Finished() {
+				return ErrMaintenanceFinished
+			}
+			before = *m
+			m.Status = MaintenanceCancelled
+			return nil
+		})
+	}
+	if err != nil {
+		writeMaintenanceError(w, err)
+		return
+	}
+	PublishMaintenance(broadcast.MaintenanceCancelled, maintenance)
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s cancelled maintenance %d", ip, id)
+	audit(r, AuditMaintenanceCancelled, "maintenance", id, before, maintenance)
+	utils.WriteJSON(w, http.StatusOK, maintenance)
+}
@@ -0,0 +1,270 @@
+package db
+
+import (
+	"embed"
+	"errors"
+	"example/downdetector/internal/utils"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer version of the app.
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+
+// migration is a single schema change, read from the files
+// migrations/<dialect>/<version>_<name>.up.sql and migrations/<dialect>/<version>_<name>.down.sql.
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState describes a migration and whether it's applied to the database.
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// loadMigrations reads the embedded migrations of the dialect, ordered by version.
+func loadMigrations(d *dialect) ([]migration, error) {
+	files, err := fs.Glob(migrationFiles, d.migrations+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, file := range files {
+		base := path.Base(file)
+		name, direction, ok := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: expected <version>_<name>.up.sql or .down.sql", base)
+		}
+
+		versionPart, name, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(versionPart)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", base, err)
+		}
+
+		content, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// prepareMigrations creates the schema_migrations table if needed and returns the applied versions.
+func (s *sqlStore) prepareMigrations() (map[int]time.Time, error) {
+	var exists int
+	err := s.QueryRow(s.dialect.tableExists, "schema_migrations").Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists == 0 {
+		err = s.inTx(func(tx conn) error {
+			_, err := tx.Exec(s.dialect.migrationsTable)
+			if err != nil || !s.dialect.legacySchema {
+				return err
+			}
+			return adoptLegacySchema(tx)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	applied := map[int]time.Time{}
+	rows, err := s.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// adoptLegacySchema marks the migrations already applied to databases created before schema_migrations existed.
+// Those are SQLite databases which have the initial schema and count their later upgrades in PRAGMA user_version.
+func adoptLegacySchema(tx conn) error {
+	var tables int
+	err := tx.QueryRow(tx.dialect.tableExists, "reports").Scan(&tables)
+	if err != nil || tables == 0 {
+		return err
+	}
+
+	var upgrades int
+	if err := tx.QueryRow("PRAGMA user_version").Scan(&upgrades); err != nil {
+		return err
+	}
+
+	migrations, err := loadMigrations(tx.dialect)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations[:min(upgrades+1, len(migrations))] {
+		_, err := tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, now())
+		if err != nil {
+			return err
+		}
+	}
+
+	utils.NoReportLog.Infof("Adopted existing database at schema version %d", upgrades+1)
+	return nil
+}
+
+func (s *sqlStore) MigrationStatus() ([]MigrationState, error) {
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := s.prepareMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	for _, m := range migrations {
+		state := MigrationState{Version: m.Version, Name: m.Name}
+		if at, ok := applied[m.Version]; ok {
+			state.AppliedAt = &at
+		}
+		states = append(states, state)
+	}
+
+	for version := range applied {
+		if version > len(migrations) {
+			return states, fmt.Errorf("%w: version %d is applied, latest known is %d", ErrSchemaTooNew, version, len(migrations))
+		}
+	}
+
+	return states, nil
+}
+
+// MigrateUp applies every migration missing from the database, each in its own transaction.
+func (s *sqlStore) MigrateUp() error {
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return err
+	}
+
+	applied, err := s.prepareMigrations()
+	if err != nil {
+		return err
+	}
+
+	for version := range applied {
+		if version > len(migrations) {
+			return fmt.Errorf("%w: version %d is applied, latest known is %d", ErrSchemaTooNew, version, len(migrations))
+		}
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		err := s.inTx(func(tx conn) error {
+			if _, err := tx.Exec(m.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, now())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		utils.NoReportLog.Infof("Applied migration %d_%s", m.Version, m.Name)
+	}
+
+	return nil
+}
+
+// MigrateDown reverts migrations, each in its own transaction.
+func (s *sqlStore) MigrateDown(steps int) error {
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return err
+	}
+
+	applied, err := s.prepareMigrations()
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return fmt.Errorf("migration %d_%s can't be reverted", m.Version, m.Name)
+		}
+
+		err := s.inTx(func(tx conn) error {
+			if _, err := tx.Exec(m.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec("DELETE FROM schema_migrations WHERE version=?", m.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		utils.NoReportLog.Infof("Reverted migration %d_%s", m.Version, m.Name)
+		steps--
+	}
+
+	return nil
+}
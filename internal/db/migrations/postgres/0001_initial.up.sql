@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS reports (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  title TEXT,
+  content TEXT,
+  isSolved BOOLEAN
+);
+
+CREATE TABLE IF NOT EXISTS users (
+  username TEXT NOT NULL PRIMARY KEY,
+  password TEXT NOT NULL,
+  salt TEXT NOT NULL
+);
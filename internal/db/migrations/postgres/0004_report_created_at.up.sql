@@ -0,0 +1 @@
+ALTER TABLE reports ADD COLUMN created_at TIMESTAMPTZ;
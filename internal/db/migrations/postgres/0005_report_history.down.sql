@@ -0,0 +1,5 @@
+DROP TABLE report_events;
+
+ALTER TABLE reports DROP COLUMN created_by;
+ALTER TABLE reports DROP COLUMN resolved_at;
+ALTER TABLE reports DROP COLUMN updated_at;
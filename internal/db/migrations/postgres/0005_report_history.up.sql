@@ -0,0 +1,16 @@
+ALTER TABLE reports ADD COLUMN updated_at TIMESTAMPTZ;
+ALTER TABLE reports ADD COLUMN resolved_at TIMESTAMPTZ;
+ALTER TABLE reports ADD COLUMN created_by TEXT;
+
+CREATE TABLE report_events (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  report_id BIGINT NOT NULL,
+  action TEXT NOT NULL,
+  actor TEXT NOT NULL,
+  title TEXT NOT NULL,
+  content TEXT NOT NULL,
+  isSolved BOOLEAN NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX report_events_report_id ON report_events (report_id);
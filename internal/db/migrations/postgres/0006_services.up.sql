@@ -0,0 +1,15 @@
+CREATE TABLE services (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  name TEXT NOT NULL UNIQUE,
+  description TEXT NOT NULL DEFAULT '',
+  group_name TEXT NOT NULL DEFAULT '',
+  owner TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE report_services (
+  report_id BIGINT NOT NULL,
+  service_id BIGINT NOT NULL,
+  PRIMARY KEY (report_id, service_id)
+);
+
+CREATE INDEX report_services_service_id ON report_services (service_id);
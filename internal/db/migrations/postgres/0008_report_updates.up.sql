@@ -0,0 +1,10 @@
+CREATE TABLE report_updates (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  report_id BIGINT NOT NULL,
+  author TEXT NOT NULL,
+  status TEXT NOT NULL,
+  message TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX report_updates_report_id ON report_updates (report_id);
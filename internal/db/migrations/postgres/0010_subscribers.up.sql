@@ -0,0 +1,8 @@
+CREATE TABLE subscribers (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  email TEXT NOT NULL UNIQUE,
+  token TEXT NOT NULL UNIQUE,
+  created_at TIMESTAMPTZ NOT NULL,
+  confirmation_sent_at TIMESTAMPTZ NOT NULL,
+  confirmed_at TIMESTAMPTZ
+);
@@ -0,0 +1,5 @@
+DROP TRIGGER report_search_update_posted ON report_updates;
+DROP TRIGGER report_search_reports ON reports;
+DROP FUNCTION report_search_sync_update();
+DROP FUNCTION report_search_sync_report();
+DROP TABLE report_search;
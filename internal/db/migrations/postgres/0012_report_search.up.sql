@@ -0,0 +1,43 @@
+CREATE TABLE report_search (
+  report_id BIGINT PRIMARY KEY,
+  title TEXT NOT NULL,
+  content TEXT NOT NULL,
+  updates TEXT NOT NULL DEFAULT '',
+  document tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', title), 'A') ||
+    setweight(to_tsvector('simple', content), 'B') ||
+    setweight(to_tsvector('simple', updates), 'C')
+  ) STORED
+);
+
+CREATE INDEX report_search_document ON report_search USING GIN (document);
+
+INSERT INTO report_search (report_id, title, content, updates)
+SELECT id, title, content, COALESCE((SELECT string_agg(message, ' ' ORDER BY id) FROM report_updates WHERE report_id=reports.id), '')
+FROM reports;
+
+CREATE FUNCTION report_search_sync_report() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    INSERT INTO report_search (report_id, title, content) VALUES (NEW.id, NEW.title, NEW.content);
+  ELSIF TG_OP = 'UPDATE' THEN
+    UPDATE report_search SET title=NEW.title, content=NEW.content WHERE report_id=NEW.id;
+  ELSE
+    DELETE FROM report_search WHERE report_id=OLD.id;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER report_search_reports AFTER INSERT OR UPDATE OF title, content OR DELETE ON reports
+FOR EACH ROW EXECUTE FUNCTION report_search_sync_report();
+
+CREATE FUNCTION report_search_sync_update() RETURNS trigger AS $$
+BEGIN
+  UPDATE report_search SET updates=trim(updates || ' ' || NEW.message) WHERE report_id=NEW.report_id;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER report_search_update_posted AFTER INSERT ON report_updates
+FOR EACH ROW EXECUTE FUNCTION report_search_sync_update();
@@ -0,0 +1,4 @@
+-- Reports in the trash come back rather than being lost
+DROP INDEX reports_deleted_at;
+ALTER TABLE reports DROP COLUMN deleted_by;
+ALTER TABLE reports DROP COLUMN deleted_at;
@@ -0,0 +1,7 @@
+-- Two-factor authentication is switched off for everyone, and the recovery codes are lost
+DROP TABLE settings;
+DROP TABLE recovery_codes;
+
+ALTER TABLE users DROP COLUMN totp_last_step;
+ALTER TABLE users DROP COLUMN totp_enabled;
+ALTER TABLE users DROP COLUMN totp_secret;
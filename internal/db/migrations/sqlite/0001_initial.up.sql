@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS reports (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  title TEXT,
+  content TEXT,
+  isSolved BOOLEAN
+);
+
+CREATE TABLE IF NOT EXISTS users (
+  username TEXT NOT NULL PRIMARY KEY,
+  password TEXT NOT NULL,
+  salt TEXT NOT NULL
+);
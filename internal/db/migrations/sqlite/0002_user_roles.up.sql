@@ -0,0 +1,3 @@
+-- Existing users keep full access
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'admin';
+ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1 @@
+ALTER TABLE reports DROP COLUMN created_at;
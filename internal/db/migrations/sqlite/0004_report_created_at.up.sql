@@ -0,0 +1,2 @@
+-- Unknown for the existing reports
+ALTER TABLE reports ADD COLUMN created_at TIMESTAMP;
@@ -0,0 +1,16 @@
+ALTER TABLE reports ADD COLUMN updated_at TIMESTAMP;
+ALTER TABLE reports ADD COLUMN resolved_at TIMESTAMP;
+ALTER TABLE reports ADD COLUMN created_by TEXT;
+
+CREATE TABLE report_events (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  report_id INTEGER NOT NULL,
+  action TEXT NOT NULL,
+  actor TEXT NOT NULL,
+  title TEXT NOT NULL,
+  content TEXT NOT NULL,
+  isSolved BOOLEAN NOT NULL,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX report_events_report_id ON report_events (report_id);
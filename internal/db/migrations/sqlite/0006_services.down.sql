@@ -0,0 +1,2 @@
+DROP TABLE report_services;
+DROP TABLE services;
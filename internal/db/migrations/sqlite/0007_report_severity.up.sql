@@ -0,0 +1,2 @@
+-- Existing reports were all treated the same, so they start as minor
+ALTER TABLE reports ADD COLUMN severity TEXT NOT NULL DEFAULT 'minor';
@@ -0,0 +1,10 @@
+CREATE TABLE report_updates (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  report_id INTEGER NOT NULL,
+  author TEXT NOT NULL,
+  status TEXT NOT NULL,
+  message TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX report_updates_report_id ON report_updates (report_id);
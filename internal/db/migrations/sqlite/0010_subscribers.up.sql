@@ -0,0 +1,8 @@
+CREATE TABLE subscribers (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  email TEXT NOT NULL UNIQUE,
+  token TEXT NOT NULL UNIQUE,
+  created_at TIMESTAMP NOT NULL,
+  confirmation_sent_at TIMESTAMP NOT NULL,
+  confirmed_at TIMESTAMP
+);
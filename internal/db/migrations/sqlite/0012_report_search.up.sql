@@ -0,0 +1,22 @@
+-- FTS5 isn't compiled into go-sqlite3 by default, FTS4 is
+CREATE VIRTUAL TABLE report_search USING fts4(title, content, updates, tokenize=unicode61 "remove_diacritics=1");
+
+INSERT INTO report_search (docid, title, content, updates)
+SELECT id, title, content, COALESCE((SELECT group_concat(message, ' ') FROM report_updates WHERE report_id=reports.id), '')
+FROM reports;
+
+CREATE TRIGGER report_search_insert AFTER INSERT ON reports BEGIN
+  INSERT INTO report_search (docid, title, content, updates) VALUES (new.id, new.title, new.content, '');
+END;
+
+CREATE TRIGGER report_search_update AFTER UPDATE OF title, content ON reports BEGIN
+  UPDATE report_search SET title=new.title, content=new.content WHERE docid=new.id;
+END;
+
+CREATE TRIGGER report_search_delete AFTER DELETE ON reports BEGIN
+  DELETE FROM report_search WHERE docid=old.id;
+END;
+
+CREATE TRIGGER report_search_update_posted AFTER INSERT ON report_updates BEGIN
+  UPDATE report_search SET updates=trim(updates || ' ' || new.message) WHERE docid=new.report_id;
+END;
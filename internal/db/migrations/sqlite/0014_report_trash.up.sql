@@ -0,0 +1,5 @@
+-- Deleted reports stay in the trash until they're restored or purged
+ALTER TABLE reports ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE reports ADD COLUMN deleted_by TEXT;
+
+CREATE INDEX reports_deleted_at ON reports (deleted_at);
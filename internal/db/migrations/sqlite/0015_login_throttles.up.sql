@@ -0,0 +1,10 @@
+-- Failed logins of each client address and username, which slow down and lock out password guessing
+CREATE TABLE login_throttles (
+  kind TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  failures INTEGER NOT NULL,
+  last_failure_at TIMESTAMP NOT NULL,
+  blocked_until TIMESTAMP NOT NULL,
+  locked BOOLEAN NOT NULL DEFAULT false,
+  PRIMARY KEY (kind, subject)
+);
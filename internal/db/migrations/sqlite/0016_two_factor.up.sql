@@ -0,0 +1,21 @@
+-- TOTP two-factor authentication. A new secret only takes effect once it's confirmed with a code,
+-- and the time step of the last accepted code is kept so that no code is accepted twice.
+ALTER TABLE users ADD COLUMN totp_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+-- One-time codes logging in when the authenticator is lost, stored hashed
+CREATE TABLE recovery_codes (
+  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  username TEXT NOT NULL,
+  code_hash TEXT NOT NULL,
+  used_at TIMESTAMP
+);
+
+CREATE INDEX recovery_codes_username ON recovery_codes (username);
+
+-- Settings changed by admins while the app runs
+CREATE TABLE settings (
+  name TEXT NOT NULL PRIMARY KEY,
+  value TEXT NOT NULL
+);
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Parameters of the argon2id hashes created for new passwords.
+const (
+	argonTime    = 1
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	argonKeyLen  = 32
+	argonSaltLen = 16
+)
+
+// minPasswordLength is the shortest password accepted when setting a new one.
+const minPasswordLength = 8
+
+var errInvalidHash = errors.New("invalid password hash format")
+
+// HashPassword hashes the password with argon2id and a random salt.
+// The result is encoded as "$argon2id$v=19$m=65536,t=1,p=4$<salt>$<hash>".
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	hash := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash),
+	), nil
+}
+
+// verifyArgon2 checks the password against an encoded argon2id hash created by HashPassword.
+func verifyArgon2(encoded, password string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, errInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, errInvalidHash
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, errInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, errInvalidHash
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, errInvalidHash
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(hash)))
+	return subtle.ConstantTimeCompare(hash, computed) == 1, nil
+}
+
+// isLegacyHash reports whether the stored hash is an old sha256(password + salt) hash.
+func isLegacyHash(hash string) bool {
+	return !strings.HasPrefix(hash, "$argon2id$")
+}
+
+// verifyLegacy checks the password against a hex encoded sha256(password + salt) hash.
+func verifyLegacy(hash, salt, password string) bool {
+	h := sha256.Sum256([]byte(password + salt))
+	computed := hex.EncodeToString(h[:])
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(computed)) == 1
+}
+
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+// burnPasswordCheck spends the same time as a real password check,
+// so that unknown usernames can't be told apart by response time.
+func burnPasswordCheck(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("dummy password")
+	})
+	verifyArgon2(dummyHash, password)
+}
+
+// checkPassword verifies the password of the given user against the stored hash and salt.
+// Legacy sha256 hashes are replaced with argon2id hashes after a successful check.
+func checkPassword(username, password, hash, salt string) (bool, error) {
+	if !isLegacyHash(hash) {
+		return verifyArgon2(hash, password)
+	}
+
+	if !verifyLegacy(hash, salt, password) {
+		return false, nil
+	}
+
+	newHash, err := HashPassword(password)
+	if err != nil {
+		return false, err
+	}
+
+	err = DB.SetPassword(username, newHash)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// validatePassword checks if a new password is good enough to be set.
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters long", minPasswordLength)
+	}
+	return nil
+}
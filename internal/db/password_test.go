@@ -0,0 +1,110 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestArgon2RoundTrip(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=1,p=4$") {
+		t.Errorf("hash %q isn't in the argon2id format", hash)
+	}
+	if other, _ := HashPassword("correct horse"); other == hash {
+		t.Error("two hashes of the same password are equal, so the salt isn't random")
+	}
+
+	for _, tt := range []struct {
+		password string
+		want     bool
+	}{
+		{"correct horse", true},
+		{"correct horse ", false},
+		{"Correct horse", false},
+		{"", false},
+	} {
+		ok, err := verifyArgon2(hash, tt.password)
+		if err != nil || ok != tt.want {
+			t.Errorf("password %q: got %t, %v, want %t", tt.password, ok, err, tt.want)
+		}
+	}
+}
+
+func TestVerifyArgon2RejectsInvalidHashes(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(hash, "$")
+
+	invalid := []string{
+		"",
+		"$argon2i$" + strings.Join(parts[2:], "$"),
+		"$argon2id$v=16$" + strings.Join(parts[3:], "$"),
+		"$argon2id$" + parts[2] + "$m=65536$" + strings.Join(parts[4:], "$"),
+		"$argon2id$" + strings.Join(parts[2:4], "$") + "$not base64!$" + parts[5],
+		strings.Join(parts[:5], "$"),
+	}
+	for _, encoded := range invalid {
+		if _, err := verifyArgon2(encoded, "correct horse"); !errors.Is(err, errInvalidHash) {
+			t.Errorf("hash %q: got %v, want %v", encoded, err, errInvalidHash)
+		}
+	}
+}
+
+// login sends the credentials to the login endpoint and returns the status code.
+func login(username, password string) int {
+	r := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"username":"`+username+`","password":"`+password+`"}`))
+	w := httptest.NewRecorder()
+	LoginMiddleware(SessionHandler)(w, r)
+	return w.Code
+}
+
+func TestLegacyHashUpgraded(t *testing.T) {
+	setupTestStore(t)
+	setupTestSessions(t)
+
+	// Accounts created before argon2id kept hex encoded sha256(password + salt)
+	const salt = "pepper"
+	sum := sha256.Sum256([]byte("correct horse" + salt))
+	legacy := hex.EncodeToString(sum[:])
+	if err := DB.CreateUser(User{Username: "jan", Role: RoleViewer}, legacy); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DB.(*sqlStore).Exec("UPDATE users SET salt=? WHERE username=?", salt, "jan"); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := login("jan", "wrong horse"); code != http.StatusForbidden {
+		t.Errorf("wrong password answered %d", code)
+	}
+	if creds, err := DB.Credentials("jan"); err != nil || creds.Hash != legacy {
+		t.Fatalf("hash changed by a failed login: %+v, %v", creds, err)
+	}
+
+	if code := login("jan", "correct horse"); code != http.StatusOK {
+		t.Fatalf("login with the legacy hash answered %d", code)
+	}
+	creds, err := DB.Credentials("jan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isLegacyHash(creds.Hash) || creds.Salt != "" {
+		t.Fatalf("hash %q with salt %q left after the login, want argon2id", creds.Hash, creds.Salt)
+	}
+	if ok, err := verifyArgon2(creds.Hash, "correct horse"); !ok || err != nil {
+		t.Errorf("upgraded hash doesn't match the password: %t, %v", ok, err)
+	}
+
+	if code := login("jan", "correct horse"); code != http.StatusOK {
+		t.Errorf("login with the upgraded hash answered %d", code)
+	}
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"example/downdetector/internal/broadcast"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublicAPIHidesUsernames(t *testing.T) {
+	setupTestStore(t)
+	report, err := SubmitReport(NewReport{Title: "Awaria API", Content: "Nie działa logowanie."}, "jan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := DB.AddReportUpdate(ReportUpdate{ReportID: report.ID, Author: "jan", Status: UpdateIdentified, Message: "Szukamy przyczyny."}); err != nil {
+		t.Fatal(err)
+	}
+	at := now()
+	maintenance, err := DB.CreateMaintenance(Maintenance{Title: "Aktualizacja bazy", StartsAt: at.Add(time.Hour), EndsAt: at.Add(2 * time.Hour),
+		Status: MaintenanceScheduled, CreatedBy: "jan", CreatedAt: at})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reportPath := strconv.Itoa(int(report.ID))
+	maintenancePath := strconv.FormatInt(maintenance.ID, 10)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		url, id string
+	}{
+		{"list reports", ListReportsHandler, "/api/reports", ""},
+		{"get report", GetReportHandler, "/api/reports/" + reportPath, reportPath},
+		{"search reports", SearchReportsHandler, "/api/reports/search?q=awaria", ""},
+		{"list updates", ReportUpdatesHandler, "/api/reports/" + reportPath + "/updates", reportPath},
+		{"list maintenances", ListMaintenancesHandler, "/api/maintenances", ""},
+		{"get maintenance", GetMaintenanceHandler, "/api/maintenances/" + maintenancePath, maintenancePath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			r.SetPathValue("id", tt.id)
+			w := httptest.NewRecorder()
+			tt.handler(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("got %d: %s", w.Code, w.Body)
+			}
+			if body := w.Body.String(); strings.Contains(body, "jan") || !strings.Contains(body, `"id"`) {
+				t.Errorf("response names the author or is empty: %s", body)
+			}
+		})
+	}
+}
+
+func TestPublicEventsHideUsernames(t *testing.T) {
+	setupTestStore(t)
+	published, cancel := broadcast.Subscribe()
+	defer cancel()
+
+	report, err := SubmitReport(NewReport{Title: "Awaria API", Content: "Nie działa logowanie."}, "jan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/reports/1/updates", strings.NewReader(`{"status":"resolved","message":"Naprawione."}`))
+	r.SetPathValue("id", strconv.Itoa(int(report.ID)))
+	w := httptest.NewRecorder()
+	AddReportUpdateHandler(w, r.WithContext(context.WithValue(r.Context(), currentUserKey, User{Username: "jan"})))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("posting the update answered %d: %s", w.Code, w.Body)
+	}
+	PublishMaintenance(broadcast.MaintenanceScheduled, Maintenance{ID: 1, CreatedBy: "jan"})
+
+	want := []string{broadcast.ReportCreated, broadcast.UpdatePosted, broadcast.ReportSolved, broadcast.MaintenanceScheduled}
+	for _, eventType := range want {
+		event := <-published
+		if event.Type != eventType {
+			t.Fatalf("got %s, want %s", event.Type, eventType)
+		}
+		data, err := json.Marshal(event.Public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Public == nil || strings.Contains(string(data), "jan") {
+			t.Errorf("public payload of %s = %s", event.Type, data)
+		}
+		if data, _ := json.Marshal(event.Data); !strings.Contains(string(data), "jan") {
+			t.Errorf("%s lost the author for the dashboard: %s", event.Type, data)
+		}
+	}
+}
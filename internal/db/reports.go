@@ -2,69 +2,174 @@ package db
 
 import (
 	"encoding/json"
+	"errors"
+	"example/downdetector/internal/broadcast"
 	"example/downdetector/internal/utils"
+	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/log"
 )
 
 type Report struct {
-	ID       uint   `db:"id"`
-	Title    string `db:"title"`
-	Content  string `db:"content"`
-	IsSolved bool   `db:"isSolved"`
+	ID       uint   `db:"id" json:"id"`
+	Title    string `db:"title" json:"title"`
+	Content  string `db:"content" json:"content"`
+	IsSolved bool   `db:"isSolved" json:"isSolved"`
+	// CreatedAt, UpdatedAt and CreatedBy are unknown for reports created before they were recorded.
+	CreatedAt  *time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt  *time.Time `db:"updated_at" json:"updatedAt"`
+	ResolvedAt *time.Time `db:"resolved_at" json:"resolvedAt"`
+	// CreatedBy is left out of what anyone can read, see Public.
+	CreatedBy string   `db:"created_by" json:"createdBy,omitempty"`
+	Severity  Severity `db:"severity" json:"severity"`
+	// ServiceIDs are the services affected by the problem.
+	ServiceIDs []int64 `json:"services"`
+	// DeletedAt and DeletedBy are only set for reports in the trash.
+	DeletedAt *time.Time `db:"deleted_at" json:"deletedAt,omitempty"`
+	DeletedBy string     `db:"deleted_by" json:"deletedBy,omitempty"`
 }
 
-type ReportList struct {
-	Reports []Report
-	IsEmpty bool
+// Public returns the report as shown on the public API and event stream.
+// Usernames of the dashboard are only shown to logged-in users, as they're also what logging in takes.
+func (r Report) Public() Report {
+	r.CreatedBy = ""
+	return r
+}
+
+// HasService reports whether the report is attached to the service.
+func (r Report) HasService(id int64) bool {
+	return slices.Contains(r.ServiceIDs, id)
 }
 
 type NewReport struct {
 	Title   string `json:"title"`
 	Content string `json:"content"`
+	// Severity is one of maintenance, minor, major or critical, minor when empty.
+	Severity Severity `json:"severity"`
+	// Services are the IDs of the affected services.
+	Services []int64 `json:"services"`
 }
 
-// GetOpenReports retrieves a list of all open reports.
-func GetOpenReports() (ReportList, error) {
-	reports := ReportList{}
-	rows, err := DB.Query("SELECT * FROM reports WHERE isSolved=false")
+// CreatedReport is returned after adding a report.
+type CreatedReport struct {
+	ID uint `json:"id"`
+}
+
+// ErrInvalidReport is returned by SubmitReport for reports which can't be accepted.
+var ErrInvalidReport = errors.New("invalid report")
+
+// checkReportText trims the title and content of a report, which can't be left empty.
+func checkReportText(title, content string) (string, string, error) {
+	title, content = strings.TrimSpace(title), strings.TrimSpace(content)
+	if title == "" || content == "" {
+		return "", "", fmt.Errorf("%w: no title nor content can be empty", ErrInvalidReport)
+	}
+	return title, content, nil
+}
+
+// SubmitReport validates a new report and saves it on behalf of actor.
+// It's used both by the API and by the health checks, so reports are accepted the same way no matter who opens them.
+func SubmitReport(newReport NewReport, actor string) (Report, error) {
+	title, content, err := checkReportText(newReport.Title, newReport.Content)
 	if err != nil {
-		return ReportList{}, err
+		return Report{}, err
 	}
 
-	for rows.Next() {
-		report := Report{}
-		err := rows.Scan(&report.ID, &report.Title, &report.Content, &report.IsSolved)
-		if err != nil {
-			return ReportList{}, err
-		}
-		reports.Reports = append(reports.Reports, report)
+	severity, err := parseSeverity(string(newReport.Severity))
+	if err != nil {
+		return Report{}, err
+	}
+
+	services, err := checkServices(newReport.Services)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report, err := DB.CreateReport(Report{Title: title, Content: content, Severity: severity, ServiceIDs: services}, actor)
+	if err != nil {
+		return Report{}, err
 	}
-	reports.IsEmpty = len(reports.Reports) == 0
 
-	return reports, nil
+	publishReport(EventCreated, report)
+	return report, nil
 }
 
-// GetAllReports retrieves a list of all reports.
-func GetAllReports() ([]Report, error) {
-	var reports []Report
-	rows, err := DB.Query("SELECT * FROM reports")
+// ResolveReport marks the report as solved on behalf of actor, like ticking it on the dashboard would.
+func ResolveReport(id uint, actor string) (Report, error) {
+	var action EventAction
+	report, err := DB.UpdateReport(id, actor, func(report *Report) EventAction {
+		action = report.setSolved(true)
+		return action
+	})
 	if err != nil {
-		return nil, err
+		return Report{}, err
 	}
 
-	for rows.Next() {
-		report := Report{}
-		err := rows.Scan(&report.ID, &report.Title, &report.Content, &report.IsSolved)
-		if err != nil {
-			return nil, err
-		}
-		reports = append(reports, report)
+	publishReport(action, report)
+	return report, nil
+}
+
+// reportEventTypes maps the actions recorded in the history of a report to the broadcast events.
+var reportEventTypes = map[EventAction]string{
+	EventCreated:  broadcast.ReportCreated,
+	EventEdited:   broadcast.ReportEdited,
+	EventSolved:   broadcast.ReportSolved,
+	EventReopened: broadcast.ReportReopened,
+	EventDeleted:  broadcast.ReportDeleted,
+	EventRestored: broadcast.ReportRestored,
+}
+
+// trashedReportID is what the public event stream tells about a report moved to or restored from the trash.
+type trashedReportID struct {
+	ID uint `json:"id"`
+}
+
+// publishReport lets everyone listening know that the report changed.
+func publishReport(action EventAction, report Report) {
+	broadcast.Default.Publish(reportEvent(action, report))
+}
+
+// reportEvent returns the event about the change to the report.
+// The public event stream only gets the ID of reports moved to or restored from the trash,
+// whose content and who deleted them is only shown to admins.
+func reportEvent(action EventAction, report Report) broadcast.Event {
+	event := broadcast.Event{Type: reportEventTypes[action], Data: report, Public: report.Public()}
+	if action == EventDeleted || action == EventRestored {
+		event.Public = trashedReportID{ID: report.ID}
+	}
+	return event
+}
+
+// setSolved changes the state of the report and returns the matching history action.
+// It must be called from within UpdateReport, after UpdatedAt is set.
+func (r *Report) setSolved(isSolved bool) EventAction {
+	action := EventEdited
+	switch {
+	case isSolved && !r.IsSolved:
+		action = EventSolved
+		r.ResolvedAt = r.UpdatedAt
+	case !isSolved && r.IsSolved:
+		action = EventReopened
+		r.ResolvedAt = nil
 	}
+	r.IsSolved = isSolved
+	return action
+}
 
-	return reports, nil
+// reportID reads the report ID from the request path.
+// IDs which can't be parsed are reported as not found.
+func reportID(r *http.Request) (uint, error) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 0)
+	if err != nil {
+		return 0, ErrNotFound
+	}
+	return uint(id), nil
 }
 
 // AddReportHandler adds a new report.
@@ -73,9 +178,9 @@ func GetAllReports() ([]Report, error) {
 // @Description Adds a new report to the system
 // @Tags reports
 // @Accept json
-// @Produce plain
+// @Produce json
 // @Param report body NewReport true "New Report"
-// @Success 201
+// @Success 201 {object} CreatedReport
 // @Failure 400
 // @Failure 500
 // @Router /reports [post]
@@ -100,22 +205,24 @@ func AddReportHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if newReport.Title == "" || newReport.Content == "" {
-		http.Error(w, "No title nor content can be empty", http.StatusBadRequest)
+	user, _ := CurrentUser(r)
+	report, err := SubmitReport(newReport, user.Username)
+	if errors.Is(err, ErrInvalidReport) || errors.Is(err, errUnknownService) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	_, err = DB.Exec("INSERT INTO reports (title, content, isSolved) VALUES (?, ?, ?)", newReport.Title, newReport.Content, false)
-
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		log.Error("Failed to insert report", "err", err)
 		return
 	}
 
+	id := report.ID
 	ip := r.RemoteAddr
-	utils.NoReportLog.Infof("%s created a report", ip)
-	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+	utils.NoReportLog.Infof("%s created report %d", ip, id)
+	audit(r, AuditReportCreated, "report", id, nil, report)
+	w.Header().Set("Location", fmt.Sprintf("/api/reports/%d", id))
+	utils.WriteJSON(w, http.StatusCreated, CreatedReport{ID: id})
 }
 
 // EditReportHandler edits an existing report.
@@ -129,50 +236,124 @@ func AddReportHandler(w http.ResponseWriter, r *http.Request) {
 // @Param title formData string true "Title"
 // @Param content formData string true "Content"
 // @Param isSolved formData bool true "Is Solved"
+// @Param severity formData string false "Severity, left unchanged when missing" Enums(maintenance, minor, major, critical)
+// @Param services formData []int false "IDs of the affected services, left unchanged when the field is missing. An empty value detaches all services." collectionFormat(multi)
+// @Failure 400
 // @Success 200
+// @Failure 404
 // @Failure 500
 // @Router /reports/{id} [put]
 func EditReportHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
+	id, err := reportID(r)
+	if err != nil {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	}
 	r.ParseMultipartForm(4 << 20) // max memory 4MB
-	title := r.Form.Get("title")
-	content := r.Form.Get("content")
+	title, content, err := checkReportText(r.Form.Get("title"), r.Form.Get("content"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	isSolved := r.Form.Get("isSolved") != "" // when submitting a form if a checkbox is unchecked it's not included in the payload instead of being false
 
-	_, err := DB.Exec("UPDATE reports SET title=?, content=?, isSolved=? WHERE id=?", title, content, isSolved, id)
+	var severity Severity
+	if value := r.Form.Get("severity"); value != "" {
+		severity, err = parseSeverity(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Unchecked service checkboxes are left out as well, so forms send an empty value to tell "no services" from "not changed"
+	values, changeServices := r.Form["services"]
+	var services []int64
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		serviceID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid service ID", http.StatusBadRequest)
+			return
+		}
+		services = append(services, serviceID)
+	}
+	services, err = checkServices(services)
+	if err != nil {
+		writeServicesError(w, err)
+		return
+	}
 
+	user, _ := CurrentUser(r)
+	var action EventAction
+	var before Report
+	report, err := DB.UpdateReport(id, user.Username, func(report *Report) EventAction {
+		before = *report
+		action = report.setSolved(isSolved)
+		report.Title, report.Content = title, content
+		if severity != "" {
+			report.Severity = severity
+		}
+		if changeServices {
+			report.ServiceIDs = services
+		}
+		return action
+	})
+
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		log.Error("Failed to update report", "err", err)
 		return
 	}
 
+	publishReport(action, report)
 	ip := r.RemoteAddr
-	utils.NoReportLog.Infof("%s edited report %s", ip, id)
+	utils.NoReportLog.Infof("%s edited report %d", ip, id)
+	audit(r, AuditReportEdited, "report", id, before, report)
 	w.WriteHeader(http.StatusOK)
 }
 
-// DeleteReportHandler deletes an existing report.
+// DeleteReportHandler moves an existing report to the trash.
 //
 // @Summary Delete a report
-// @Description Deletes a report from the system
+// @Description Moves a report to the trash, which hides it everywhere else. It can be restored from there
+// @Description until it's purged for good, trash_retention_days after it was deleted
 // @Tags reports
 // @Param id path int true "Report ID"
 // @Produce plain
 // @Success 200
+// @Failure 404
 // @Failure 500
 // @Router /reports/{id} [delete]
 func DeleteReportHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	_, err := DB.Exec("DELETE FROM reports WHERE id=?", id)
+	id, err := reportID(r)
+	var report Report
+	if err == nil {
+		user, _ := CurrentUser(r)
+		report, err = DB.DeleteReport(id, user.Username)
+	}
 
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-		log.Error("Failed to delete user", "err", err)
+		log.Error("Failed to delete report", "err", err)
 		return
 	}
 
+	publishReport(EventDeleted, report)
 	ip := r.RemoteAddr
-	utils.NoReportLog.Infof("%s deleted report %s", ip, id)
+	utils.NoReportLog.Infof("%s deleted report %d", ip, id)
+	before := report
+	before.DeletedAt, before.DeletedBy = nil, ""
+	audit(r, AuditReportDeleted, "report", id, before, report)
 	w.WriteHeader(http.StatusOK)
 }
@@ -0,0 +1,249 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"example/downdetector/internal/utils"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// reportSortColumns maps the sort options accepted by the API to SQL expressions.
+// Reports are numbered in creation order, so sorting by creation time is sorting by ID,
+// which also works for old reports without a recorded creation time.
+var reportSortColumns = map[string]string{
+	"id":         "id",
+	"created_at": "id",
+	"title":      "COALESCE(title, '')",
+}
+
+// ReportFilter selects and orders the reports returned by QueryReports.
+type ReportFilter struct {
+	// Status is "open", "solved" or empty for all reports.
+	Status string
+	// Query is matched against the title and the content.
+	Query string
+	// Severities limits the reports to the given severities, empty means any.
+	Severities []Severity
+	// Service limits the reports to those attached to the service with the ID, 0 means any.
+	Service int64
+	// From and To limit the creation time, To is exclusive.
+	From, To *time.Time
+	Sort     string
+	Desc     bool
+	Limit    int
+	// After continues the listing after the last report of the previous page.
+	After *reportCursor
+}
+
+// reportCursor points at the last report of a page.
+type reportCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v"`
+	ID    uint   `json:"i"`
+}
+
+func (c reportCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeReportCursor(s string) (*reportCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	c := &reportCursor{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ReportPage is a single page of reports returned by the API.
+type ReportPage struct {
+	Reports []Report `json:"reports"`
+	// NextCursor is passed as the cursor parameter to get the next page, empty on the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// parseReportFilter reads the filter from the query parameters of the API request.
+func parseReportFilter(query url.Values) (ReportFilter, error) {
+	filter := ReportFilter{
+		Status: query.Get("status"),
+		Query:  strings.TrimSpace(query.Get("q")),
+		Sort:   query.Get("sort"),
+		Limit:  defaultPageSize,
+	}
+
+	switch filter.Status {
+	case "", "all":
+		filter.Status = ""
+	case "open", "solved":
+	default:
+		return ReportFilter{}, errors.New("status must be open, solved or all")
+	}
+
+	if filter.Sort == "" {
+		filter.Sort = "id"
+	}
+	if _, ok := reportSortColumns[filter.Sort]; !ok {
+		return ReportFilter{}, errors.New("sort must be id, created_at or title")
+	}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		return ReportFilter{}, errors.New("order must be asc or desc")
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxPageSize {
+			return ReportFilter{}, fmt.Errorf("limit must be a number between 1 and %d", maxPageSize)
+		}
+		filter.Limit = n
+	}
+
+	if severities := query.Get("severity"); severities != "" {
+		for _, value := range strings.Split(severities, ",") {
+			severity := Severity(strings.TrimSpace(value))
+			if !severity.Valid() {
+				return ReportFilter{}, fmt.Errorf("severity must be a comma separated list of %v", Severities)
+			}
+			filter.Severities = append(filter.Severities, severity)
+		}
+	}
+
+	if service := query.Get("service"); service != "" {
+		id, err := strconv.ParseInt(service, 10, 64)
+		if err != nil || id < 1 {
+			return ReportFilter{}, errors.New("service must be a service ID")
+		}
+		filter.Service = id
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(query.Get("from")); err != nil {
+		return ReportFilter{}, fmt.Errorf("from: %w", err)
+	}
+	if filter.To, err = parseTimeParam(query.Get("to")); err != nil {
+		return ReportFilter{}, fmt.Errorf("to: %w", err)
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		filter.After, err = decodeReportCursor(cursor)
+		if err != nil {
+			return ReportFilter{}, errors.New("invalid cursor")
+		}
+		if filter.After.Sort != filter.Sort || filter.After.Desc != filter.Desc {
+			return ReportFilter{}, errors.New("cursor was created with a different sort order")
+		}
+	}
+
+	return filter, nil
+}
+
+// parseTimeParam accepts an RFC 3339 timestamp or a date, empty means no limit.
+func parseTimeParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, errors.New("expected an RFC 3339 timestamp or a YYYY-MM-DD date")
+}
+
+// ListReportsHandler returns a filtered page of reports.
+//
+// @Summary List reports
+// @Description Returns reports matching the filters, a page at a time.
+// @Description Pass the returned nextCursor as the cursor parameter, together with the same filters, to get the next page.
+// @Tags reports
+// @Produce json
+// @Param status query string false "Only open or solved reports" Enums(open, solved, all)
+// @Param q query string false "Text searched for in the title and content"
+// @Param severity query string false "Only reports with one of the comma separated severities, e.g. major,critical"
+// @Param service query int false "Only reports attached to the service with this ID"
+// @Param from query string false "Created at or after, RFC 3339 timestamp or YYYY-MM-DD"
+// @Param to query string false "Created before, RFC 3339 timestamp or YYYY-MM-DD"
+// @Param sort query string false "Sort field" Enums(id, created_at, title) default(id)
+// @Param order query string false "Sort order" Enums(asc, desc) default(asc)
+// @Param limit query int false "Page size" minimum(1) maximum(200) default(50)
+// @Param cursor query string false "Cursor of the next page"
+// @Success 200 {object} ReportPage
+// @Failure 400
+// @Failure 500
+// @Router /reports [get]
+func ListReportsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseReportFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := DB.QueryReports(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select reports", "err", err)
+		return
+	}
+	for i, report := range page.Reports {
+		page.Reports[i] = report.Public()
+	}
+
+	utils.WriteJSON(w, http.StatusOK, page)
+}
+
+// GetReportHandler returns a single report.
+//
+// @Summary Get a report
+// @Description Returns a single report.
+// @Tags reports
+// @Produce json
+// @Param id path int true "Report ID"
+// @Success 200 {object} Report
+// @Failure 404
+// @Failure 500
+// @Router /reports/{id} [get]
+func GetReportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := reportID(r)
+	var report Report
+	if err == nil {
+		report, err = DB.Report(id)
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select report", "err", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, report.Public())
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSubmitReportTrimsText(t *testing.T) {
+	setupTestStore(t)
+
+	report, err := SubmitReport(NewReport{Title: "  Awaria API \n", Content: "\tNie działa logowanie. "}, "jan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Title != "Awaria API" || report.Content != "Nie działa logowanie." {
+		t.Errorf("saved title %q and content %q", report.Title, report.Content)
+	}
+
+	if _, err := SubmitReport(NewReport{Title: "Awaria API", Content: " \n "}, "jan"); !errors.Is(err, ErrInvalidReport) {
+		t.Errorf("blank content: got %v, want %v", err, ErrInvalidReport)
+	}
+}
+
+func TestEditReportRejectsEmptyText(t *testing.T) {
+	setupTestStore(t)
+	setupTestSessions(t)
+	report, err := SubmitReport(NewReport{Title: "Awaria API", Content: "Nie działa logowanie."}, "jan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edit := func(title, content string) int {
+		var body strings.Builder
+		form := multipart.NewWriter(&body)
+		form.WriteField("title", title)
+		form.WriteField("content", content)
+		form.Close()
+		r := httptest.NewRequest(http.MethodPut, "/api/reports/"+strconv.Itoa(int(report.ID)), strings.NewReader(body.String()))
+		r.Header.Set("Content-Type", form.FormDataContentType())
+		r.SetPathValue("id", strconv.Itoa(int(report.ID)))
+		w := httptest.NewRecorder()
+		EditReportHandler(w, r)
+		return w.Code
+	}
+
+	tests := []struct {
+		title, content string
+	}{
+		{"", "Nowa treść"},
+		{"Nowy tytuł", ""},
+		{"  ", "Nowa treść"},
+		{"Nowy tytuł", "\n\t"},
+	}
+	for _, tt := range tests {
+		if code := edit(tt.title, tt.content); code != http.StatusBadRequest {
+			t.Errorf("title %q, content %q: got %d, want %d", tt.title, tt.content, code, http.StatusBadRequest)
+		}
+	}
+	saved, err := DB.Report(report.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Title != report.Title || saved.Content != report.Content {
+		t.Errorf("rejected edits changed the report to %q, %q", saved.Title, saved.Content)
+	}
+
+	if code := edit(" Nowy tytuł ", " Nowa treść "); code != http.StatusOK {
+		t.Fatalf("valid edit: got %d", code)
+	}
+	saved, err = DB.Report(report.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Title != "Nowy tytuł" || saved.Content != "Nowa treść" {
+		t.Errorf("edit saved title %q and content %q", saved.Title, saved.Content)
+	}
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/charmbracelet/log"
+)
+
+// Role decides what a logged-in user is allowed to do.
+type Role string
+
+const (
+	// RoleViewer can only browse the dashboard.
+	RoleViewer Role = "viewer"
+	// RoleEditor can additionally create and edit reports.
+	RoleEditor Role = "editor"
+	// RoleAdmin can additionally delete reports and manage users.
+	RoleAdmin Role = "admin"
+)
+
+// Roles lists all roles from the least to the most privileged.
+var Roles = []Role{RoleViewer, RoleEditor, RoleAdmin}
+
+// roleRank orders roles from the least to the most privileged.
+var roleRank = map[Role]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// Valid reports whether r is one of the known roles.
+func (r Role) Valid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+// Allows reports whether a user with role r may do what requires the given role.
+func (r Role) Allows(required Role) bool {
+	return roleRank[r] >= roleRank[required]
+}
+
+// User is an account as seen by the rest of the app, without its credentials.
+type User struct {
+	Username string `json:"username"`
+	Role     Role   `json:"role"`
+	Disabled bool   `json:"disabled"`
+	// TwoFactor is set when logging in takes a TOTP code after the password.
+	TwoFactor bool `json:"twoFactor"`
+
+	// tokenID is set when the user authenticated with an API token instead of a session.
+	tokenID int64
+}
+
+// ViaToken reports whether the user authenticated with an API token.
+func (u User) ViaToken() bool {
+	return u.tokenID != 0
+}
+
+// CanEdit reports whether the user may create and edit reports.
+func (u User) CanEdit() bool {
+	return u.Role.Allows(RoleEditor)
+}
+
+// IsAdmin reports whether the user may delete reports and manage users.
+func (u User) IsAdmin() bool {
+	return u.Role.Allows(RoleAdmin)
+}
+
+type contextKey int
+
+// currentUserKey stores the authenticated User in the request context.
+const currentUserKey contextKey = iota
+
+// errUserNotFound is returned by a Store when the requested account doesn't exist.
+var errUserNotFound = fmt.Errorf("user %w", ErrNotFound)
+
+// withCurrentUser returns a copy of the request carrying the authenticated user.
+func withCurrentUser(r *http.Request, user User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), currentUserKey, user))
+}
+
+// CurrentUser returns the user authenticated by CheckIfUserLoggedIn.
+func CurrentUser(r *http.Request) (User, bool) {
+	user, ok := r.Context().Value(currentUserKey).(User)
+	return user, ok
+}
+
+// RequireRole middleware lets the request through only if the logged-in user has at least the given role.
+// It has to be wrapped by CheckIfUserLoggedIn.
+func RequireRole(role Role, f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := CurrentUser(r)
+		if !ok {
+			http.Error(w, "User not found in request", http.StatusInternalServerError)
+			log.Error("RequireRole used without CheckIfUserLoggedIn", "path", r.URL.Path)
+			return
+		}
+
+		if !user.Role.Allows(role) {
+			http.Error(w, fmt.Sprintf("This action requires the %s role", role), http.StatusForbidden)
+			return
+		}
+
+		f(w, r)
+	}
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"example/downdetector/internal/utils"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+	// maxSearchTerms keeps a long query from turning into an expensive one.
+	maxSearchTerms = 10
+)
+
+// SearchResult is a report matching a search, with the matching parts of its text.
+// The snippets are HTML with the matches enclosed in <mark>, and empty when nothing matched in that part.
+type SearchResult struct {
+	Report  Report `json:"report"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	Updates string `json:"updates"`
+}
+
+// searchTerms splits the query into lower case words, dropping everything but letters and digits
+// so that nothing in it is taken for the syntax of the search index.
+func searchTerms(query string) []string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > maxSearchTerms {
+		words = words[:maxSearchTerms]
+	}
+	return words
+}
+
+// highlight turns a snippet from the search index, with the matches enclosed in \x02 and \x03, into HTML.
+func highlight(snippet string) string {
+	if !strings.Contains(snippet, "\x02") {
+		return ""
+	}
+	return strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>").Replace(html.EscapeString(snippet))
+}
+
+// SearchReportsHandler searches the reports.
+//
+// @Summary Search reports
+// @Description Returns the reports containing every word of the query, or words starting with them,
+// @Description in the title, content or updates, open ones first and then newest first.
+// @Description Each result comes with HTML snippets of the matching parts, with the matches enclosed in <mark>.
+// @Tags reports
+// @Produce json
+// @Param q query string true "Words to search for"
+// @Param limit query int false "Maximum number of results" minimum(1) maximum(500) default(50)
+// @Success 200 {array} SearchResult
+// @Failure 400
+// @Failure 500
+// @Router /reports/search [get]
+func SearchReportsHandler(w http.ResponseWriter, r *http.Request) {
+	terms := searchTerms(r.URL.Query().Get("q"))
+	if len(terms) == 0 {
+		http.Error(w, "q must contain at least one word", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSearchLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			http.Error(w, fmt.Sprintf("limit must be a number between 1 and %d", maxSearchLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	results, err := DB.SearchReports(terms, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to search reports", "err", err)
+		return
+	}
+	for i, result := range results {
+		results[i].Report = result.Report.Public()
+	}
+
+	utils.WriteJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// searchIDs returns the IDs of the reports found for the query.
+func searchIDs(t *testing.T, query string) []uint {
+	t.Helper()
+	results, err := DB.SearchReports(searchTerms(query), defaultSearchLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []uint
+	for _, result := range results {
+		ids = append(ids, result.Report.ID)
+	}
+	return ids
+}
+
+func TestSearchIndexFollowsReports(t *testing.T) {
+	setupTestStore(t)
+	database, err := SubmitReport(NewReport{Title: "Awaria bazy", Content: "Nie działa zapis."}, "jan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mail, err := SubmitReport(NewReport{Title: "Awaria poczty", Content: "Nie dochodzą maile."}, "jan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(step, query string, want ...uint) {
+		t.Helper()
+		got := searchIDs(t, query)
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: %q found %v, want %v", step, query, got, want)
+		}
+	}
+	check("created", "awar", mail.ID, database.ID)
+	check("created", "awaria zapis", database.ID)
+	check("created", "NIE", mail.ID, database.ID)
+
+	if _, err := DB.UpdateReport(database.ID, "jan", func(report *Report) EventAction {
+		report.Title, report.Content = "Przerwa bazy", "Wolny odczyt."
+		return EventEdited
+	}); err != nil {
+		t.Fatal(err)
+	}
+	check("edited", "zapis")
+	check("edited", "awaria", mail.ID)
+	check("edited", "odczyt", database.ID)
+
+	if _, _, err := DB.AddReportUpdate(ReportUpdate{ReportID: mail.ID, Author: "jan", Status: UpdateIdentified, Message: "Restart serwera."}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := DB.AddReportUpdate(ReportUpdate{ReportID: mail.ID, Author: "jan", Status: UpdateMonitoring, Message: "Kolejka opróżniona."}); err != nil {
+		t.Fatal(err)
+	}
+	check("update posted", "restart", mail.ID)
+	check("update posted", "kolejka restart", mail.ID)
+
+	if _, err := DB.DeleteReport(mail.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	check("trashed", "restart")
+	check("trashed", "awaria")
+	if _, err := DB.RestoreReport(mail.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	check("restored", "restart", mail.ID)
+
+	if _, err := DB.DeleteReport(mail.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DB.PurgeReports(now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	var indexed int
+	if err := DB.(*sqlStore).QueryRow("SELECT COUNT(*) FROM report_search WHERE docid=?", mail.ID).Scan(&indexed); err != nil {
+		t.Fatal(err)
+	}
+	if indexed != 0 {
+		t.Error("purged report left in the search index")
+	}
+	check("purged", "odczyt", database.ID)
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		snippet, want string
+	}{
+		{"", ""},
+		{"no match", ""},
+		{"\x02Awaria\x03 bazy", "<mark>Awaria</mark> bazy"},
+		{"<b>\x02awaria\x03</b> & \"x\"", "&lt;b&gt;<mark>awaria</mark>&lt;/b&gt; &amp; &#34;x&#34;"},
+	}
+	for _, tt := range tests {
+		if got := highlight(tt.snippet); got != tt.want {
+			t.Errorf("highlight(%q) = %q, want %q", tt.snippet, got, tt.want)
+		}
+	}
+}
+
+func TestSearchSnippetsEscapeHTML(t *testing.T) {
+	setupTestStore(t)
+	report, err := SubmitReport(NewReport{Title: `<script>alert("awaria")</script>`, Content: "Awaria <img src=x onerror=alert(1)>"}, "jan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := DB.SearchReports(searchTerms("awaria"), defaultSearchLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Report.ID != report.ID {
+		t.Fatalf("got %+v, want report %d", results, report.ID)
+	}
+	for _, snippet := range []string{results[0].Title, results[0].Content} {
+		if !strings.Contains(snippet, "<mark>") || strings.Contains(snippet, "<script") || strings.Contains(snippet, "<img") {
+			t.Errorf("snippet %q isn't escaped HTML with the match marked", snippet)
+		}
+	}
+}
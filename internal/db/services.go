@@ -0,0 +1,315 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"example/downdetector/internal/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// Service is a system or component that reports can be attached to.
+type Service struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Group collects related services on the public page, e.g. "Network" or "Office".
+	Group string `json:"group"`
+	// Owner is the person or team responsible for the service.
+	Owner string `json:"owner"`
+}
+
+// NewService is the payload used to create or replace a service.
+type NewService struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Group       string `json:"group"`
+	Owner       string `json:"owner"`
+}
+
+var errUnknownService = errors.New("unknown service")
+
+// serviceID reads the service ID from the request path.
+// IDs which can't be parsed are reported as not found.
+func serviceID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return 0, ErrNotFound
+	}
+	return id, nil
+}
+
+// parseService reads and validates the service in the request body.
+func parseService(r *http.Request) (Service, error) {
+	newService := NewService{}
+	if err := json.NewDecoder(r.Body).Decode(&newService); err != nil {
+		return Service{}, err
+	}
+
+	service := Service{
+		Name:        strings.TrimSpace(newService.Name),
+		Description: strings.TrimSpace(newService.Description),
+		Group:       strings.TrimSpace(newService.Group),
+		Owner:       strings.TrimSpace(newService.Owner),
+	}
+	if service.Name == "" {
+		return Service{}, errors.New("name can't be empty")
+	}
+	return service, nil
+}
+
+// serviceNameTaken reports whether a service other than the one with the given ID already has the name.
+func serviceNameTaken(name string, id int64) (bool, error) {
+	services, err := DB.Services()
+	if err != nil {
+		return false, err
+	}
+
+	for _, service := range services {
+		if service.ID != id && strings.EqualFold(service.Name, name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkServices removes duplicates from the service IDs of a report and makes sure they all exist.
+func checkServices(ids []int64) ([]int64, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	services, err := DB.Services()
+	if err != nil {
+		return nil, err
+	}
+	known := map[int64]bool{}
+	for _, service := range services {
+		known[service.ID] = true
+	}
+
+	var checked []int64
+	seen := map[int64]bool{}
+	for _, id := range ids {
+		if !known[id] {
+			return nil, fmt.Errorf("%w %d", errUnknownService, id)
+		}
+		if !seen[id] {
+			seen[id] = true
+			checked = append(checked, id)
+		}
+	}
+	return checked, nil
+}
+
+// writeServicesError responds to a failed checkServices call.
+func writeServicesError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errUnknownService) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+	log.Error("Failed to check services", "err", err)
+}
+
+// ListServicesHandler returns the service catalog.
+//
+// @Summary List services
+// @Description Returns every service reports can be attached to, ordered by group and name.
+// @Tags services
+// @Produce json
+// @Success 200 {array} Service
+// @Failure 500
+// @Router /services [get]
+func ListServicesHandler(w http.ResponseWriter, r *http.Request) {
+	services, err := DB.Services()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select services", "err", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, services)
+}
+
+// GetServiceHandler returns a single service.
+//
+// @Summary Get a service
+// @Description Returns a single service.
+// @Tags services
+// @Produce json
+// @Param id path int true "Service ID"
+// @Success 200 {object} Service
+// @Failure 404
+// @Failure 500
+// @Router /services/{id} [get]
+func GetServiceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := serviceID(r)
+	var service Service
+	if err == nil {
+		service, err = DB.Service(id)
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Service not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select service", "err", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, service)
+}
+
+// CreateServiceHandler adds a service to the catalog.
+//
+// @Summary Create a service
+// @Description Adds a service to the catalog. Requires the admin role.
+// @Tags services
+// @Accept json
+// @Produce json
+// @Param service body NewService true "New service"
+// @Success 201 {object} Service
+// @Failure 400
+// @Failure 403
+// @Failure 409
+// @Failure 500
+// @Router /services [post]
+func CreateServiceHandler(w http.ResponseWriter, r *http.Request) {
+	service, err := parseService(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if taken, err := serviceNameTaken(service.Name, 0); err != nil || taken {
+		writeServiceNameError(w, err)
+		return
+	}
+
+	service, err = DB.CreateService(service)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to insert service", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s created service %d %s", ip, service.ID, service.Name)
+	audit(r, AuditServiceCreated, "service", service.ID, nil, service)
+	w.Header().Set("Location", fmt.Sprintf("/api/services/%d", service.ID))
+	utils.WriteJSON(w, http.StatusCreated, service)
+}
+
+// UpdateServiceHandler replaces the details of a service.
+//
+// @Summary Update a service
+// @Description Replaces the name, description, group and owner of a service. Requires the admin role.
+// @Tags services
+// @Accept json
+// @Produce plain
+// @Param id path int true "Service ID"
+// @Param service body NewService true "Service"
+// @Success 200
+// @Failure 400
+// @Failure 403
+// @Failure 404
+// @Failure 409
+// @Failure 500
+// @Router /services/{id} [put]
+func UpdateServiceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := serviceID(r)
+	var before Service
+	if err == nil {
+		before, err = DB.Service(id)
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Service not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select service", "err", err)
+		return
+	}
+
+	service, err := parseService(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	service.ID = id
+
+	if taken, err := serviceNameTaken(service.Name, id); err != nil || taken {
+		writeServiceNameError(w, err)
+		return
+	}
+
+	err = DB.UpdateService(service)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Service not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to update service", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s updated service %d %s", ip, id, service.Name)
+	audit(r, AuditServiceUpdated, "service", id, before, service)
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteServiceHandler removes a service from the catalog.
+//
+// @Summary Delete a service
+// @Description Removes a service from the catalog and detaches it from its reports. Requires the admin role.
+// @Tags services
+// @Param id path int true "Service ID"
+// @Produce plain
+// @Success 200
+// @Failure 403
+// @Failure 404
+// @Failure 500
+// @Router /services/{id} [delete]
+func DeleteServiceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := serviceID(r)
+	var service Service
+	if err == nil {
+		service, err = DB.Service(id)
+	}
+	if err == nil {
+		err = DB.DeleteService(id)
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Service not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to delete service", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s deleted service %d", ip, id)
+	audit(r, AuditServiceDeleted, "service", id, service, nil)
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeServiceNameError responds to a failed serviceNameTaken check.
+func writeServiceNameError(w http.ResponseWriter, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to check service name", "err", err)
+		return
+	}
+	http.Error(w, "Service name already taken", http.StatusConflict)
+}
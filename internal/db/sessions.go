@@ -0,0 +1,147 @@
+package db
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"example/downdetector/internal/config"
+	"example/downdetector/internal/utils"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// store holds the login sessions. It is created by SetupSessions.
+var store *sessions.CookieStore
+
+// secureCookies is set when the app is reached over HTTPS, directly or through a proxy,
+// so that browsers never send its cookies over plain HTTP.
+var secureCookies bool
+
+// sessionMaxAge is how long the session cookie stays valid after logging in.
+var sessionMaxAge = time.Hour
+
+// SetupSessions creates the session store signed with the configured keys.
+// When no keys are configured they are read from the key file, which is generated on first start.
+func SetupSessions(cfg config.Config) error {
+	keys := cfg.SessionKeys
+	if len(keys) == 0 {
+		var err error
+		keys, err = loadOrCreateKeyFile(cfg.SessionKeyFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	pairs, err := decodeKeyPairs(keys)
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(cfg.PublicURL)
+	if err != nil {
+		u = &url.URL{}
+	}
+	publicHost = u.Host
+	secureCookies = cfg.TLSCertFile != "" || u.Scheme == "https"
+
+	store = sessions.NewCookieStore(pairs...)
+	// Scripts never read the session cookie, and it's sent when following links from other sites,
+	// but not with requests those sites make
+	store.Options.HttpOnly = true
+	store.Options.SameSite = http.SameSiteLaxMode
+	store.Options.Secure = secureCookies
+	sessionMaxAge = cfg.SessionMaxAge
+	return nil
+}
+
+// decodeKeyPairs turns "hashKey:encryptionKey" strings into the key pairs expected by the cookie store.
+// The first pair is used to sign new cookies, all of them are tried when decoding.
+func decodeKeyPairs(keys []string) ([][]byte, error) {
+	var pairs [][]byte
+	for i, key := range keys {
+		hashPart, blockPart, _ := strings.Cut(key, ":")
+
+		hashKey, err := base64.StdEncoding.DecodeString(hashPart)
+		if err != nil {
+			return nil, fmt.Errorf("session key %d: invalid hash key: %w", i+1, err)
+		}
+		if len(hashKey) < 32 {
+			return nil, fmt.Errorf("session key %d: hash key must be at least 32 bytes long", i+1)
+		}
+
+		var blockKey []byte
+		if blockPart != "" {
+			blockKey, err = base64.StdEncoding.DecodeString(blockPart)
+			if err != nil {
+				return nil, fmt.Errorf("session key %d: invalid encryption key: %w", i+1, err)
+			}
+			if n := len(blockKey); n != 16 && n != 24 && n != 32 {
+				return nil, fmt.Errorf("session key %d: encryption key must be 16, 24 or 32 bytes long", i+1)
+			}
+		}
+
+		pairs = append(pairs, hashKey, blockKey)
+	}
+
+	return pairs, nil
+}
+
+// loadOrCreateKeyFile reads the session keys from path, one pair per line.
+// Empty lines and lines starting with # are ignored.
+// If the file doesn't exist, it is created with a newly generated key pair.
+func loadOrCreateKeyFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createKeyFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var keys []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("session key file %s contains no keys", path)
+	}
+
+	return keys, nil
+}
+
+// createKeyFile generates a new key pair and saves it to path, readable only by the owner.
+func createKeyFile(path string) ([]string, error) {
+	key := GenerateSessionKey()
+
+	content := "# Session keys, newest first. Prepend a new line to rotate keys.\n" + key + "\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		return nil, fmt.Errorf("failed to save session key file: %w", err)
+	}
+
+	utils.NoReportLog.Info("Generated new session key", "path", path)
+	return []string{key}, nil
+}
+
+// GenerateSessionKey returns a new random "hashKey:encryptionKey" pair.
+func GenerateSessionKey() string {
+	hashKey := securecookie.GenerateRandomKey(64)
+	blockKey := securecookie.GenerateRandomKey(32)
+	return base64.StdEncoding.EncodeToString(hashKey) + ":" + base64.StdEncoding.EncodeToString(blockKey)
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"example/downdetector/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessionCookieOptions(t *testing.T) {
+	t.Cleanup(func() { publicHost, secureCookies = "", false })
+
+	tests := []struct {
+		name       string
+		cfg        config.Config
+		wantSecure bool
+	}{
+		{"plain HTTP", config.Config{}, false},
+		{"HTTP public URL", config.Config{PublicURL: "http://status.example.com"}, false},
+		{"HTTPS public URL", config.Config{PublicURL: "https://status.example.com"}, true},
+		{"TLS", config.Config{TLSCertFile: "cert.pem", TLSKeyFile: "key.pem"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.SessionKeys = []string{GenerateSessionKey()}
+			tt.cfg.SessionMaxAge = time.Hour
+			if err := SetupSessions(tt.cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+			session, err := store.Get(r, "auth")
+			if err != nil {
+				t.Fatal(err)
+			}
+			session.Values["authenticated"] = true
+			if err := setCSRFToken(w, r, session); err != nil {
+				t.Fatal(err)
+			}
+			if err := session.Save(r, w); err != nil {
+				t.Fatal(err)
+			}
+
+			cookies := w.Result().Cookies()
+			if len(cookies) != 2 {
+				t.Fatalf("got %d cookies, want the CSRF token and the session", len(cookies))
+			}
+			for _, cookie := range cookies {
+				if cookie.Secure != tt.wantSecure || cookie.SameSite == http.SameSiteNoneMode || cookie.SameSite == http.SameSiteDefaultMode {
+					t.Errorf("cookie %s: Secure %t, SameSite %v", cookie.Name, cookie.Secure, cookie.SameSite)
+				}
+			}
+			auth := cookies[1]
+			if auth.Name != "auth" || !auth.HttpOnly || auth.SameSite != http.SameSiteLaxMode || auth.Path != "/" {
+				t.Errorf("session cookie = %+v, want an HttpOnly cookie with SameSite=Lax", auth)
+			}
+		})
+	}
+}
@@ -2,50 +2,201 @@ package db
 
 import (
 	"database/sql"
-	"example/downdetector/internal/utils"
-
-	"github.com/charmbracelet/log"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-var DB *sql.DB
-
-// creates a default user with password 'changeme' if users table is empty
-var schema = `
-CREATE TABLE IF NOT EXISTS reports (
-  id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-  title TEXT,
-  content TEXT,
-  isSolved BOOLEAN
-);
-
-CREATE TABLE IF NOT EXISTS users (
-  username TEXT NOT NULL PRIMARY KEY,
-  password TEXT NOT NULL,
-  salt TEXT NOT NULL
-);
-
-INSERT INTO users (username, password, salt)
-SELECT 'admin', '9ca53ef06fbb9b87ddb126147bf346adbf6e79691073b19c5c07bfec1f384b2d', 'salt' 
-WHERE NOT EXISTS (SELECT 1 FROM users);
-`
-
-// Sets up a connection to the database
-func Connect() error {
-	utils.NoReportLog.Info("Connecting to db...")
-	var err error
-	DB, err = sql.Open("sqlite3", "reports.db")
+// dialect describes how a SQL database differs from the others.
+type dialect struct {
+	// driver is the database/sql driver name.
+	driver string
+	// migrations is the directory of the embedded migrations written for the database.
+	migrations string
+	// numbered placeholders are written as $1, $2... instead of ?.
+	numbered bool
+	// like is the case-insensitive LIKE operator.
+	like string
+	// searchReports selects from the search index the ID of each report matching the search query passed
+	// as the only argument, as search_id, with snippets of its title, content and updates, as hl_title,
+	// hl_content and hl_updates. Matches are enclosed in \x02 and \x03.
+	searchReports string
+	// searchTerm formats a word of the search query matching any word starting with it,
+	// searchAnd joins these so that all of them have to match.
+	searchTerm, searchAnd string
+	// tableExists checks whether the table named by the only argument exists.
+	tableExists string
+	// migrationsTable creates the schema_migrations table.
+	migrationsTable string
+	// legacySchema is set when databases may predate schema_migrations and have to be adopted.
+	legacySchema bool
+}
+
+var sqliteDialect = &dialect{
+	driver:     "sqlite3",
+	migrations: "migrations/sqlite",
+	like:       "LIKE",
+	searchReports: `SELECT docid AS search_id,
+	  snippet(report_search, char(2), char(3), '…', 0, 64) AS hl_title,
+	  snippet(report_search, char(2), char(3), '…', 1, 32) AS hl_content,
+	  snippet(report_search, char(2), char(3), '…', 2, 32) AS hl_updates
+	FROM report_search WHERE report_search MATCH ?`,
+	searchTerm:  "%s*",
+	searchAnd:   " ",
+	tableExists: "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?",
+	migrationsTable: `CREATE TABLE schema_migrations (
+	  version INTEGER NOT NULL PRIMARY KEY,
+	  name TEXT NOT NULL,
+	  applied_at TIMESTAMP NOT NULL
+	)`,
+	legacySchema: true,
+}
+
+var postgresDialect = &dialect{
+	driver:     "postgres",
+	migrations: "migrations/postgres",
+	numbered:   true,
+	like:       "ILIKE",
+	searchReports: `SELECT report_id AS search_id,
+	  ts_headline('simple', title, query, 'HighlightAll=true, StartSel=' || chr(2) || ', StopSel=' || chr(3)) AS hl_title,
+	  ts_headline('simple', content, query, 'MaxWords=32, MinWords=16, StartSel=' || chr(2) || ', StopSel=' || chr(3)) AS hl_content,
+	  ts_headline('simple', updates, query, 'MaxWords=32, MinWords=16, StartSel=' || chr(2) || ', StopSel=' || chr(3)) AS hl_updates
+	FROM report_search, to_tsquery('simple', ?) query WHERE document @@ query`,
+	searchTerm:  "%s:*",
+	searchAnd:   " & ",
+	tableExists: "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema=current_schema() AND table_name=?",
+	migrationsTable: `CREATE TABLE schema_migrations (
+	  version INTEGER NOT NULL PRIMARY KEY,
+	  name TEXT NOT NULL,
+	  applied_at TIMESTAMPTZ NOT NULL
+	)`,
+}
+
+// rebind rewrites the ? placeholders of a query for the dialect.
+// Question marks inside string literals are left alone.
+func (d *dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	quoted := false
+	for _, c := range query {
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// runner is the part of *sql.DB and *sql.Tx used by the store.
+type runner interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// conn runs queries written with ? placeholders on a database of any dialect.
+type conn struct {
+	runner  runner
+	dialect *dialect
+}
+
+func (c conn) Exec(query string, args ...any) (sql.Result, error) {
+	return c.runner.Exec(c.dialect.rebind(query), args...)
+}
+
+func (c conn) Query(query string, args ...any) (*sql.Rows, error) {
+	return c.runner.Query(c.dialect.rebind(query), args...)
+}
+
+func (c conn) QueryRow(query string, args ...any) *sql.Row {
+	return c.runner.QueryRow(c.dialect.rebind(query), args...)
+}
+
+// sqlStore is the Store kept in a SQL database.
+type sqlStore struct {
+	conn
+	db *sql.DB
+}
+
+var _ Store = (*sqlStore)(nil)
+
+// openSQLStore connects to the database described by dsn.
+func openSQLStore(d *dialect, dsn string) (*sqlStore, error) {
+	db, err := sql.Open(d.driver, dsn)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqlStore{conn: conn{runner: db, dialect: d}, db: db}, nil
+}
+
+// openSQLiteStore opens the SQLite database file at path.
+// Transactions take the write lock as they begin, as SQLite can't upgrade the read lock of a transaction
+// which another connection is writing past, and fails at once instead of waiting for it.
+// The write-ahead log lets reads go on meanwhile.
+func openSQLiteStore(path string) (*sqlStore, error) {
+	return openSQLStore(sqliteDialect, path+"?_txlock=immediate&_journal_mode=WAL")
+}
+
+// openMemoryStore creates an empty SQLite database kept in memory, e.g. for tests and demos.
+// Every connection to ":memory:" gets its own database, so the pool is limited to a single connection.
+func openMemoryStore() (*sqlStore, error) {
+	s, err := openSQLStore(sqliteDialect, ":memory:")
+	if err != nil {
+		return nil, err
 	}
+	s.db.SetMaxOpenConns(1)
+	s.db.SetConnMaxLifetime(0)
+	s.db.SetConnMaxIdleTime(0)
+	return s, nil
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
 
-	_, err = DB.Exec(schema)
+// inTx runs f in a transaction, which is committed if f succeeds and rolled back otherwise.
+func (s *sqlStore) inTx(f func(tx conn) error) error {
+	tx, err := s.db.Begin()
 	if err != nil {
-		log.Error("Error executing schema", "err", err)
 		return err
 	}
+	defer tx.Rollback()
+
+	if err := f(conn{runner: tx, dialect: s.dialect}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// notFound turns sql.ErrNoRows into the given not found error.
+func notFound(err, notFoundErr error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFoundErr
+	}
+	return err
+}
 
-	utils.NoReportLog.Info("Connected")
-	return nil
+// now returns the current time as stored in the database.
+// Timestamps are kept in UTC with second precision, so that they sort and compare as text in SQLite.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
 }
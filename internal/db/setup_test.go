@@ -0,0 +1,42 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// setupTestStore points DB at an empty in-memory store with the current schema.
+func setupTestStore(t *testing.T) {
+	t.Helper()
+	s, err := openMemoryStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	DB = s
+	t.Cleanup(func() { s.Close() })
+}
+
+// createTestUser adds an account with the given password.
+func createTestUser(t *testing.T, user User, password string) {
+	t.Helper()
+	hash, err := HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.CreateUser(user, hash); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setupTestSessions signs the session cookies with a random key.
+func setupTestSessions(t *testing.T) {
+	t.Helper()
+	store = sessions.NewCookieStore(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+	sessionMaxAge = time.Hour
+}
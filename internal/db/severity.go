@@ -0,0 +1,78 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Severity tells how badly a report affects its services.
+type Severity string
+
+const (
+	// SeverityMaintenance is planned work rather than a failure.
+	SeverityMaintenance Severity = "maintenance"
+	// SeverityMinor is a degraded but working service.
+	SeverityMinor Severity = "minor"
+	// SeverityMajor is a service which is down for some of its users.
+	SeverityMajor Severity = "major"
+	// SeverityCritical is a service which is down for everyone.
+	SeverityCritical Severity = "critical"
+)
+
+// DefaultSeverity is given to reports created without a severity.
+const DefaultSeverity = SeverityMinor
+
+// Severities lists all severities from the least to the most severe.
+var Severities = []Severity{SeverityMaintenance, SeverityMinor, SeverityMajor, SeverityCritical}
+
+// SeverityNames are the names of the severities shown to the public, e.g. in feeds and emails.
+var SeverityNames = map[Severity]string{
+	SeverityMaintenance: "Prace serwisowe",
+	SeverityMinor:       "Utrudnienia",
+	SeverityMajor:       "Awaria",
+	SeverityCritical:    "Krytyczna awaria",
+}
+
+// severityRank orders severities from the least to the most severe.
+var severityRank = map[Severity]int{
+	SeverityMaintenance: 1,
+	SeverityMinor:       2,
+	SeverityMajor:       3,
+	SeverityCritical:    4,
+}
+
+// Valid reports whether s is one of the known severities.
+func (s Severity) Valid() bool {
+	_, ok := severityRank[s]
+	return ok
+}
+
+// parseSeverity checks a severity sent by a client, empty means the default one.
+func parseSeverity(value string) (Severity, error) {
+	if value == "" {
+		return DefaultSeverity, nil
+	}
+	severity := Severity(value)
+	if !severity.Valid() {
+		return "", fmt.Errorf("%w: severity must be one of %v", ErrInvalidReport, Severities)
+	}
+	return severity, nil
+}
+
+// WorstSeverity returns the highest severity of the open reports, or an empty Severity when there are none.
+func WorstSeverity(reports []Report) Severity {
+	var worst Severity
+	for _, report := range reports {
+		if !report.IsSolved && severityRank[report.Severity] > severityRank[worst] {
+			worst = report.Severity
+		}
+	}
+	return worst
+}
+
+// SortBySeverity orders the reports from the most to the least severe, keeping the order of reports of equal severity.
+func SortBySeverity(reports []Report) {
+	slices.SortStableFunc(reports, func(a, b Report) int {
+		return severityRank[b.Severity] - severityRank[a.Severity]
+	})
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const auditColumns = "id, created_at, actor, ip, user_agent, action, target_type, target_id, changes"
+
+func (s *sqlStore) AddAuditEntry(entry AuditEntry) (AuditEntry, error) {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	err = s.QueryRow(`INSERT INTO audit_log (created_at, actor, ip, user_agent, action, target_type, target_id, changes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		entry.CreatedAt, entry.Actor, entry.IP, entry.UserAgent, entry.Action, entry.TargetType, entry.TargetID, string(changes)).Scan(&entry.ID)
+	return entry, err
+}
+
+func (s *sqlStore) AuditEntries(filter AuditFilter) ([]AuditEntry, error) {
+	var where []string
+	var args []any
+	for column, value := range map[string]string{
+		"actor":       filter.Actor,
+		"action":      string(filter.Action),
+		"target_type": filter.TargetType,
+		"target_id":   filter.TargetID,
+	} {
+		if value != "" {
+			where = append(where, column+"=?")
+			args = append(args, value)
+		}
+	}
+	if filter.From != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if filter.To != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, filter.To.UTC())
+	}
+	if filter.Before != 0 {
+		where = append(where, "id < ?")
+		args = append(args, filter.Before)
+	}
+
+	query := "SELECT " + auditColumns + " FROM audit_log"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		entry := AuditEntry{}
+		var changes string
+		err := rows.Scan(&entry.ID, &entry.CreatedAt, &entry.Actor, &entry.IP, &entry.UserAgent, &entry.Action, &entry.TargetType, &entry.TargetID, &changes)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"time"
+)
+
+const maintenanceColumns = "id, title, description, starts_at, ends_at, status, created_by, created_at, updated_at"
+
+// scanMaintenance reads a row selected with maintenanceColumns.
+func scanMaintenance(row interface{ Scan(...any) error }) (Maintenance, error) {
+	m := Maintenance{}
+	err := row.Scan(&m.ID, &m.Title, &m.Description, &m.StartsAt, &m.EndsAt, &m.Status, &m.CreatedBy, &m.CreatedAt, &m.UpdatedAt)
+	return m, err
+}
+
+// queryMaintenances selects maintenances ordered by start.
+func queryMaintenances(c conn, where string, args ...any) ([]Maintenance, error) {
+	maintenances := []Maintenance{}
+	rows, err := c.Query("SELECT "+maintenanceColumns+" FROM maintenances "+where+" ORDER BY starts_at, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanMaintenance(rows)
+		if err != nil {
+			return nil, err
+		}
+		maintenances = append(maintenances, m)
+	}
+
+	return maintenances, rows.Err()
+}
+
+func (s *sqlStore) Maintenances() ([]Maintenance, error) {
+	return queryMaintenances(s.conn, "")
+}
+
+func (s *sqlStore) Maintenance(id int64) (Maintenance, error) {
+	m, err := scanMaintenance(s.QueryRow("SELECT "+maintenanceColumns+" FROM maintenances WHERE id=?", id))
+	return m, notFound(err, ErrNotFound)
+}
+
+func (s *sqlStore) CreateMaintenance(m Maintenance) (Maintenance, error) {
+	err := s.QueryRow(`INSERT INTO maintenances (title, description, starts_at, ends_at, status, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		m.Title, m.Description, m.StartsAt, m.EndsAt, m.Status, m.CreatedBy, m.CreatedAt).Scan(&m.ID)
+	return m, err
+}
+
+// saveMaintenance writes the changeable fields of the maintenance.
+func saveMaintenance(c conn, m Maintenance) error {
+	_, err := c.Exec("UPDATE maintenances SET title=?, description=?, starts_at=?, ends_at=?, status=?, updated_at=? WHERE id=?",
+		m.Title, m.Description, m.StartsAt, m.EndsAt, m.Status, m.UpdatedAt, m.ID)
+	return err
+}
+
+func (s *sqlStore) UpdateMaintenance(id int64, change func(m *Maintenance) error) (Maintenance, error) {
+	var m Maintenance
+	err := s.inTx(func(tx conn) error {
+		var err error
+		m, err = scanMaintenance(tx.QueryRow("SELECT "+maintenanceColumns+" FROM maintenances WHERE id=?", id))
+		if err != nil {
+			return notFound(err, ErrNotFound)
+		}
+
+		updatedAt := now()
+		m.UpdatedAt = &updatedAt
+		if err := change(&m); err != nil {
+			return err
+		}
+		return saveMaintenance(tx, m)
+	})
+	if err != nil {
+		return Maintenance{}, err
+	}
+	return m, nil
+}
+
+func (s *sqlStore) AdvanceMaintenances(at time.Time) ([]Maintenance, error) {
+	var changed []Maintenance
+	err := s.inTx(func(tx conn) error {
+		due, err := queryMaintenances(tx, "WHERE (status=? AND starts_at<=?) OR (status=? AND ends_at<=?)",
+			MaintenanceScheduled, at, MaintenanceInProgress, at)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range due {
+			m.Status = m.StatusAt(at)
+			if _, err := tx.Exec("UPDATE maintenances SET status=? WHERE id=?", m.Status, m.ID); err != nil {
+				return err
+			}
+			changed = append(changed, m)
+		}
+		return nil
+	})
+	return changed, err
+}
@@ -0,0 +1,376 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// reportColumns are the columns scanned by scanReport, in order.
+const reportColumns = "id, title, content, isSolved, created_at, updated_at, resolved_at, COALESCE(created_by, ''), severity, deleted_at, COALESCE(deleted_by, '')"
+
+// scanReport reads a report selected with reportColumns, followed by the extra columns.
+func scanReport(row interface{ Scan(...any) error }, extra ...any) (Report, error) {
+	report := Report{}
+	dest := []any{&report.ID, &report.Title, &report.Content, &report.IsSolved, &report.CreatedAt, &report.UpdatedAt, &report.ResolvedAt, &report.CreatedBy, &report.Severity, &report.DeletedAt, &report.DeletedBy}
+	err := row.Scan(append(dest, extra...)...)
+	return report, err
+}
+
+// queryReports selects the reports matching the condition, oldest first.
+func queryReports(c conn, where string, args ...any) ([]Report, error) {
+	reports := []Report{}
+	rows, err := c.Query("SELECT "+reportColumns+" FROM reports "+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reports, attachServices(c, reports)
+}
+
+func (s *sqlStore) OpenReports() ([]Report, error) {
+	return queryReports(s.conn, "WHERE isSolved=false AND deleted_at IS NULL")
+}
+
+func (s *sqlStore) AllReports() ([]Report, error) {
+	return queryReports(s.conn, "WHERE deleted_at IS NULL")
+}
+
+func (s *sqlStore) TrashedReports() ([]Report, error) {
+	return queryReports(s.conn, "WHERE deleted_at IS NOT NULL")
+}
+
+func (s *sqlStore) QueryReports(filter ReportFilter) (ReportPage, error) {
+	sortColumn := reportSortColumns[filter.Sort]
+	where := []string{"deleted_at IS NULL"}
+	var args []any
+
+	switch filter.Status {
+	case "open":
+		where = append(where, "isSolved=false")
+	case "solved":
+		where = append(where, "isSolved=true")
+	}
+
+	if filter.Query != "" {
+		pattern := "%" + escapeLike(filter.Query) + "%"
+		where = append(where, fmt.Sprintf(`(title %[1]s ? ESCAPE '\' OR content %[1]s ? ESCAPE '\')`, s.dialect.like))
+		args = append(args, pattern, pattern)
+	}
+	if len(filter.Severities) > 0 {
+		where = append(where, "severity IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(filter.Severities)), ", ")+")")
+		for _, severity := range filter.Severities {
+			args = append(args, severity)
+		}
+	}
+	if filter.Service != 0 {
+		where = append(where, "id IN (SELECT report_id FROM report_services WHERE service_id=?)")
+		args = append(args, filter.Service)
+	}
+	if filter.From != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if filter.To != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, filter.To.UTC())
+	}
+
+	direction, cmp := "ASC", ">"
+	if filter.Desc {
+		direction, cmp = "DESC", "<"
+	}
+
+	if filter.After != nil {
+		if sortColumn == "id" {
+			where = append(where, "id "+cmp+" ?")
+			args = append(args, filter.After.ID)
+		} else {
+			where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", sortColumn, cmp))
+			args = append(args, filter.After.Value, filter.After.Value, filter.After.ID)
+		}
+	}
+
+	query := "SELECT " + reportColumns + ", " + sortColumn + " FROM reports WHERE " + strings.Join(where, " AND ")
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT ?", sortColumn, direction, direction)
+	// Fetch one more report to know if there is a next page
+	args = append(args, filter.Limit+1)
+
+	rows, err := s.Query(query, args...)
+	if err != nil {
+		return ReportPage{}, err
+	}
+	defer rows.Close()
+
+	page := ReportPage{Reports: []Report{}}
+	var sortValues []string
+	for rows.Next() {
+		var sortValue string
+		report, err := scanReport(rows, &sortValue)
+		if err != nil {
+			return ReportPage{}, err
+		}
+		page.Reports = append(page.Reports, report)
+		sortValues = append(sortValues, sortValue)
+	}
+	if err := rows.Err(); err != nil {
+		return ReportPage{}, err
+	}
+
+	if len(page.Reports) > filter.Limit {
+		page.Reports = page.Reports[:filter.Limit]
+		last := page.Reports[filter.Limit-1]
+		page.NextCursor = reportCursor{
+			Sort:  filter.Sort,
+			Desc:  filter.Desc,
+			Value: sortValues[filter.Limit-1],
+			ID:    last.ID,
+		}.encode()
+	}
+
+	return page, attachServices(s.conn, page.Reports)
+}
+
+func (s *sqlStore) Report(id uint) (Report, error) {
+	return getReport(s.conn, id)
+}
+
+// getReport selects a single report together with its services. Reports in the trash aren't found.
+func getReport(c conn, id uint) (Report, error) {
+	return selectReport(c, "WHERE id=? AND deleted_at IS NULL", id)
+}
+
+// selectReport selects the report matching the condition together with its services.
+func selectReport(c conn, where string, args ...any) (Report, error) {
+	report, err := scanReport(c.QueryRow("SELECT "+reportColumns+" FROM reports "+where, args...))
+	if err != nil {
+		return Report{}, notFound(err, ErrNotFound)
+	}
+
+	reports := []Report{report}
+	err = attachServices(c, reports)
+	return reports[0], err
+}
+
+func (s *sqlStore) CreateReport(report Report, actor string) (Report, error) {
+	createdAt := now()
+	report.CreatedAt, report.UpdatedAt, report.CreatedBy = &createdAt, &createdAt, actor
+
+	err := s.inTx(func(tx conn) error {
+		err := tx.QueryRow("INSERT INTO reports (title, content, isSolved, created_at, updated_at, created_by, severity) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id",
+			report.Title, report.Content, report.IsSolved, report.CreatedAt, report.UpdatedAt, report.CreatedBy, report.Severity).Scan(&report.ID)
+		if err != nil {
+			return err
+		}
+
+		if err := setReportServices(tx, report); err != nil {
+			return err
+		}
+
+		return recordEvent(tx, EventCreated, report, actor)
+	})
+
+	return report, err
+}
+
+func (s *sqlStore) UpdateReport(id uint, actor string, change func(report *Report) EventAction) (Report, error) {
+	var report Report
+	err := s.inTx(func(tx conn) error {
+		var err error
+		report, err = getReport(tx, id)
+		if err != nil {
+			return err
+		}
+
+		updatedAt := now()
+		report.UpdatedAt = &updatedAt
+		action := change(&report)
+
+		return saveReport(tx, report, action, actor)
+	})
+
+	return report, err
+}
+
+// saveReport stores the changed report and records the action in its history.
+func saveReport(tx conn, report Report, action EventAction, actor string) error {
+	_, err := tx.Exec("UPDATE reports SET title=?, content=?, isSolved=?, updated_at=?, resolved_at=?, severity=? WHERE id=?",
+		report.Title, report.Content, report.IsSolved, report.UpdatedAt, report.ResolvedAt, report.Severity, report.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := setReportServices(tx, report); err != nil {
+		return err
+	}
+
+	return recordEvent(tx, action, report, actor)
+}
+
+func (s *sqlStore) DeleteReport(id uint, actor string) (Report, error) {
+	var report Report
+	err := s.inTx(func(tx conn) error {
+		var err error
+		report, err = getReport(tx, id)
+		if err != nil {
+			return err
+		}
+
+		deletedAt := now()
+		report.DeletedAt, report.DeletedBy = &deletedAt, actor
+		if _, err := tx.Exec("UPDATE reports SET deleted_at=?, deleted_by=? WHERE id=?", report.DeletedAt, report.DeletedBy, id); err != nil {
+			return err
+		}
+
+		return recordEvent(tx, EventDeleted, report, actor)
+	})
+
+	return report, err
+}
+
+func (s *sqlStore) RestoreReport(id uint, actor string) (Report, error) {
+	var report Report
+	err := s.inTx(func(tx conn) error {
+		var err error
+		report, err = selectReport(tx, "WHERE id=? AND deleted_at IS NOT NULL", id)
+		if err != nil {
+			return err
+		}
+
+		report.DeletedAt, report.DeletedBy = nil, ""
+		if _, err := tx.Exec("UPDATE reports SET deleted_at=NULL, deleted_by=NULL WHERE id=?", id); err != nil {
+			return err
+		}
+
+		return recordEvent(tx, EventRestored, report, actor)
+	})
+
+	return report, err
+}
+
+func (s *sqlStore) PurgeReports(before time.Time) ([]Report, error) {
+	var purged []Report
+	err := s.inTx(func(tx conn) error {
+		var err error
+		purged, err = queryReports(tx, "WHERE deleted_at < ?", before)
+		if err != nil {
+			return err
+		}
+
+		for _, report := range purged {
+			for _, query := range []string{"DELETE FROM report_services WHERE report_id=?", "DELETE FROM report_updates WHERE report_id=?",
+				"DELETE FROM report_events WHERE report_id=?", "DELETE FROM reports WHERE id=?"} {
+				if _, err := tx.Exec(query, report.ID); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+
+	return purged, err
+}
+
+// recordEvent appends an entry to the history of the report.
+func recordEvent(tx conn, action EventAction, report Report, actor string) error {
+	_, err := tx.Exec(`INSERT INTO report_events (report_id, action, actor, title, content, isSolved, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		report.ID, action, actor, report.Title, report.Content, report.IsSolved, now())
+	return err
+}
+
+// queryEvents selects report events, oldest first.
+func (s *sqlStore) queryEvents(where string, args ...any) ([]ReportEvent, error) {
+	events := []ReportEvent{}
+	rows, err := s.Query(`SELECT id, report_id, action, actor, title, content, isSolved, created_at
+		FROM report_events `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event := ReportEvent{}
+		err := rows.Scan(&event.ID, &event.ReportID, &event.Action, &event.Actor, &event.Title, &event.Content, &event.IsSolved, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func (s *sqlStore) ReportEvents(id uint) ([]ReportEvent, error) {
+	return s.queryEvents("WHERE report_id=?", id)
+}
+
+func (s *sqlStore) AllReportEvents() ([]ReportEvent, error) {
+	return s.queryEvents("")
+}
+
+func (s *sqlStore) LastReportChange() (time.Time, error) {
+	var at time.Time
+	err := s.QueryRow("SELECT created_at FROM report_events ORDER BY id DESC LIMIT 1").Scan(&at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return at, err
+}
+
+func (s *sqlStore) SearchReports(terms []string, limit int) ([]SearchResult, error) {
+	words := make([]string, len(terms))
+	for i, term := range terms {
+		words[i] = fmt.Sprintf(s.dialect.searchTerm, term)
+	}
+
+	rows, err := s.Query("SELECT "+reportColumns+", hl_title, hl_content, hl_updates FROM reports JOIN ("+s.dialect.searchReports+
+		") search ON search.search_id=reports.id WHERE reports.deleted_at IS NULL ORDER BY isSolved, id DESC LIMIT ?", strings.Join(words, s.dialect.searchAnd), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []Report
+	var snippets [][3]string
+	for rows.Next() {
+		var snippet [3]string
+		report, err := scanReport(rows, &snippet[0], &snippet[1], &snippet[2])
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+		snippets = append(snippets, snippet)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := attachServices(s.conn, reports); err != nil {
+		return nil, err
+	}
+
+	results := []SearchResult{}
+	for i, report := range reports {
+		results = append(results, SearchResult{
+			Report:  report,
+			Title:   highlight(snippets[i][0]),
+			Content: highlight(snippets[i][1]),
+			Updates: highlight(snippets[i][2]),
+		})
+	}
+	return results, nil
+}
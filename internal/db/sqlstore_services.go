@@ -0,0 +1,116 @@
+package db
+
+import (
+	"strings"
+)
+
+func (s *sqlStore) Services() ([]Service, error) {
+	services := []Service{}
+	rows, err := s.Query("SELECT id, name, description, group_name, owner FROM services ORDER BY group_name, name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		service := Service{}
+		err := rows.Scan(&service.ID, &service.Name, &service.Description, &service.Group, &service.Owner)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, service)
+	}
+
+	return services, rows.Err()
+}
+
+func (s *sqlStore) Service(id int64) (Service, error) {
+	service := Service{}
+	err := s.QueryRow("SELECT id, name, description, group_name, owner FROM services WHERE id=?", id).
+		Scan(&service.ID, &service.Name, &service.Description, &service.Group, &service.Owner)
+	return service, notFound(err, ErrNotFound)
+}
+
+func (s *sqlStore) CreateService(service Service) (Service, error) {
+	err := s.QueryRow("INSERT INTO services (name, description, group_name, owner) VALUES (?, ?, ?, ?) RETURNING id",
+		service.Name, service.Description, service.Group, service.Owner).Scan(&service.ID)
+	return service, err
+}
+
+func (s *sqlStore) UpdateService(service Service) error {
+	res, err := s.Exec("UPDATE services SET name=?, description=?, group_name=?, owner=? WHERE id=?",
+		service.Name, service.Description, service.Group, service.Owner, service.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) DeleteService(id int64) error {
+	return s.inTx(func(tx conn) error {
+		res, err := tx.Exec("DELETE FROM services WHERE id=?", id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+
+		_, err = tx.Exec("DELETE FROM report_services WHERE service_id=?", id)
+		return err
+	})
+}
+
+// attachServices fills in the services of the reports.
+func attachServices(c conn, reports []Report) error {
+	if len(reports) == 0 {
+		return nil
+	}
+
+	byID := map[uint]*Report{}
+	args := make([]any, len(reports))
+	for i := range reports {
+		reports[i].ServiceIDs = []int64{}
+		byID[reports[i].ID] = &reports[i]
+		args[i] = reports[i].ID
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(reports)), ", ")
+	rows, err := c.Query("SELECT report_id, service_id FROM report_services WHERE report_id IN ("+placeholders+") ORDER BY service_id", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reportID uint
+		var serviceID int64
+		if err := rows.Scan(&reportID, &serviceID); err != nil {
+			return err
+		}
+		report := byID[reportID]
+		report.ServiceIDs = append(report.ServiceIDs, serviceID)
+	}
+
+	return rows.Err()
+}
+
+// setReportServices replaces the services the report is attached to.
+func setReportServices(tx conn, report Report) error {
+	_, err := tx.Exec("DELETE FROM report_services WHERE report_id=?", report.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, serviceID := range report.ServiceIDs {
+		_, err := tx.Exec("INSERT INTO report_services (report_id, service_id) VALUES (?, ?)", report.ID, serviceID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"time"
+)
+
+const subscriberColumns = "id, email, token, created_at, confirmation_sent_at, confirmed_at"
+
+// scanSubscriber reads a row selected with subscriberColumns.
+func scanSubscriber(row interface{ Scan(...any) error }) (Subscriber, error) {
+	subscriber := Subscriber{}
+	err := row.Scan(&subscriber.ID, &subscriber.Email, &subscriber.Token, &subscriber.CreatedAt, &subscriber.ConfirmationSentAt, &subscriber.ConfirmedAt)
+	return subscriber, err
+}
+
+func (s *sqlStore) ConfirmedSubscribers() ([]Subscriber, error) {
+	subscribers := []Subscriber{}
+	rows, err := s.Query("SELECT " + subscriberColumns + " FROM subscribers WHERE confirmed_at IS NOT NULL ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		subscriber, err := scanSubscriber(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+
+	return subscribers, rows.Err()
+}
+
+func (s *sqlStore) SubscriberByEmail(email string) (Subscriber, error) {
+	subscriber, err := scanSubscriber(s.QueryRow("SELECT "+subscriberColumns+" FROM subscribers WHERE email=?", email))
+	return subscriber, notFound(err, ErrNotFound)
+}
+
+func (s *sqlStore) SubscriberByToken(token string) (Subscriber, error) {
+	subscriber, err := scanSubscriber(s.QueryRow("SELECT "+subscriberColumns+" FROM subscribers WHERE token=?", token))
+	return subscriber, notFound(err, ErrNotFound)
+}
+
+func (s *sqlStore) CreateSubscriber(subscriber Subscriber) (Subscriber, error) {
+	err := s.QueryRow("INSERT INTO subscribers (email, token, created_at, confirmation_sent_at) VALUES (?, ?, ?, ?) RETURNING id",
+		subscriber.Email, subscriber.Token, subscriber.CreatedAt, subscriber.ConfirmationSentAt).Scan(&subscriber.ID)
+	return subscriber, err
+}
+
+func (s *sqlStore) TouchConfirmationSent(id int64, at time.Time) error {
+	return s.updateSubscriber("UPDATE subscribers SET confirmation_sent_at=? WHERE id=?", at, id)
+}
+
+func (s *sqlStore) ConfirmSubscriber(id int64, at time.Time) error {
+	return s.updateSubscriber("UPDATE subscribers SET confirmed_at=? WHERE id=?", at, id)
+}
+
+func (s *sqlStore) DeleteSubscriber(id int64) error {
+	return s.updateSubscriber("DELETE FROM subscribers WHERE id=?", id)
+}
+
+// updateSubscriber runs a statement changing a single subscriber, reporting ErrNotFound if it doesn't exist.
+func (s *sqlStore) updateSubscriber(query string, args ...any) error {
+	res, err := s.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
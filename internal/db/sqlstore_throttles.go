@@ -0,0 +1,83 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const throttleColumns = "kind, subject, failures, last_failure_at, blocked_until, locked"
+
+// scanThrottle reads a row selected with throttleColumns.
+func scanThrottle(row interface{ Scan(...any) error }) (LoginThrottle, error) {
+	t := LoginThrottle{}
+	err := row.Scan(&t.Kind, &t.Subject, &t.Failures, &t.LastFailureAt, &t.BlockedUntil, &t.Locked)
+	return t, err
+}
+
+// getThrottle selects the failed logins of the subject, a blank throttle when there are none.
+func getThrottle(c conn, kind ThrottleKind, subject string) (LoginThrottle, error) {
+	t, err := scanThrottle(c.QueryRow("SELECT "+throttleColumns+" FROM login_throttles WHERE kind=? AND subject=?", kind, subject))
+	if errors.Is(err, sql.ErrNoRows) {
+		return LoginThrottle{Kind: kind, Subject: subject}, nil
+	}
+	return t, err
+}
+
+func (s *sqlStore) LoginThrottle(kind ThrottleKind, subject string) (LoginThrottle, error) {
+	return getThrottle(s.conn, kind, subject)
+}
+
+func (s *sqlStore) FailLogin(kind ThrottleKind, subject string, change func(t *LoginThrottle)) (LoginThrottle, error) {
+	var t LoginThrottle
+	err := s.inTx(func(tx conn) error {
+		var err error
+		t, err = getThrottle(tx, kind, subject)
+		if err != nil {
+			return err
+		}
+
+		change(&t)
+		_, err = tx.Exec(`INSERT INTO login_throttles (`+throttleColumns+`) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (kind, subject) DO UPDATE SET failures=excluded.failures, last_failure_at=excluded.last_failure_at,
+			blocked_until=excluded.blocked_until, locked=excluded.locked`,
+			t.Kind, t.Subject, t.Failures, t.LastFailureAt, t.BlockedUntil, t.Locked)
+		return err
+	})
+	return t, err
+}
+
+func (s *sqlStore) ClearLoginThrottle(kind ThrottleKind, subject string) error {
+	res, err := s.Exec("DELETE FROM login_throttles WHERE kind=? AND subject=?", kind, subject)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) ForgetLoginFailures(before time.Time) error {
+	_, err := s.Exec("DELETE FROM login_throttles WHERE last_failure_at < ? AND blocked_until < ?", before, before)
+	return err
+}
+
+func (s *sqlStore) LoginLockouts(at time.Time) ([]LoginThrottle, error) {
+	lockouts := []LoginThrottle{}
+	rows, err := s.Query("SELECT "+throttleColumns+" FROM login_throttles WHERE kind=? AND locked=true AND blocked_until > ? ORDER BY subject",
+		ThrottleUser, at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanThrottle(rows)
+		if err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, t)
+	}
+	return lockouts, rows.Err()
+}
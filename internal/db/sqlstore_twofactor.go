@@ -0,0 +1,104 @@
+package db
+
+import "time"
+
+func (s *sqlStore) TOTP(username string) (TOTP, error) {
+	totp := TOTP{}
+	err := s.QueryRow("SELECT totp_secret, totp_enabled FROM users WHERE username=?", username).Scan(&totp.Secret, &totp.Enabled)
+	return totp, notFound(err, errUserNotFound)
+}
+
+func (s *sqlStore) SetTOTPSecret(username, secret string) error {
+	res, err := s.Exec("UPDATE users SET totp_secret=? WHERE username=? AND totp_enabled=false", secret, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) EnableTOTP(username string, step int64, recoveryHashes []string) error {
+	return s.inTx(func(tx conn) error {
+		res, err := tx.Exec("UPDATE users SET totp_enabled=true, totp_last_step=? WHERE username=? AND totp_secret<>''", step, username)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return errUserNotFound
+		}
+		return setRecoveryCodes(tx, username, recoveryHashes)
+	})
+}
+
+func (s *sqlStore) DisableTOTP(username string) error {
+	return s.inTx(func(tx conn) error {
+		res, err := tx.Exec("UPDATE users SET totp_secret='', totp_enabled=false, totp_last_step=0 WHERE username=?", username)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return errUserNotFound
+		}
+		return setRecoveryCodes(tx, username, nil)
+	})
+}
+
+func (s *sqlStore) UseTOTPStep(username string, step int64) error {
+	res, err := s.Exec("UPDATE users SET totp_last_step=? WHERE username=? AND totp_enabled=true AND totp_last_step<?", step, username, step)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// setRecoveryCodes replaces the recovery codes of the user with the given hashes.
+func setRecoveryCodes(tx conn, username string, hashes []string) error {
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE username=?", username); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if _, err := tx.Exec("INSERT INTO recovery_codes (username, code_hash) VALUES (?, ?)", username, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) SetRecoveryCodes(username string, hashes []string) error {
+	return s.inTx(func(tx conn) error {
+		return setRecoveryCodes(tx, username, hashes)
+	})
+}
+
+func (s *sqlStore) UseRecoveryCode(username, hash string, at time.Time) error {
+	res, err := s.Exec("UPDATE recovery_codes SET used_at=? WHERE username=? AND code_hash=? AND used_at IS NULL", at, username, hash)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) RecoveryCodesLeft(username string) (int, error) {
+	var count int
+	err := s.QueryRow("SELECT COUNT(*) FROM recovery_codes WHERE username=? AND used_at IS NULL", username).Scan(&count)
+	return count, err
+}
+
+func (s *sqlStore) Setting(name string) (string, error) {
+	var value string
+	err := s.QueryRow("SELECT value FROM settings WHERE name=?", name).Scan(&value)
+	return value, notFound(err, ErrNotFound)
+}
+
+func (s *sqlStore) SetSetting(name, value string) error {
+	_, err := s.Exec("INSERT INTO settings (name, value) VALUES (?, ?) ON CONFLICT (name) DO UPDATE SET value=excluded.value", name, value)
+	return err
+}
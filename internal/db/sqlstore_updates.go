@@ -0,0 +1,66 @@
+package db
+
+// queryUpdates selects report updates, newest first.
+func (s *sqlStore) queryUpdates(where string, args ...any) ([]ReportUpdate, error) {
+	updates := []ReportUpdate{}
+	rows, err := s.Query(`SELECT id, report_id, author, status, message, created_at
+		FROM report_updates `+where+` ORDER BY id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		update := ReportUpdate{}
+		err := rows.Scan(&update.ID, &update.ReportID, &update.Author, &update.Status, &update.Message, &update.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
+	}
+
+	return updates, rows.Err()
+}
+
+func (s *sqlStore) ReportUpdates(id uint) ([]ReportUpdate, error) {
+	return s.queryUpdates("WHERE report_id=?", id)
+}
+
+func (s *sqlStore) AllReportUpdates() ([]ReportUpdate, error) {
+	return s.queryUpdates("WHERE report_id IN (SELECT id FROM reports WHERE deleted_at IS NULL)")
+}
+
+func (s *sqlStore) OpenReportUpdates() ([]ReportUpdate, error) {
+	return s.queryUpdates("WHERE report_id IN (SELECT id FROM reports WHERE isSolved=false AND deleted_at IS NULL)")
+}
+
+func (s *sqlStore) AddReportUpdate(update ReportUpdate) (ReportUpdate, EventAction, error) {
+	update.CreatedAt = now()
+	var action EventAction
+
+	err := s.inTx(func(tx conn) error {
+		report, err := getReport(tx, update.ReportID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRow("INSERT INTO report_updates (report_id, author, status, message, created_at) VALUES (?, ?, ?, ?, ?) RETURNING id",
+			update.ReportID, update.Author, update.Status, update.Message, update.CreatedAt).Scan(&update.ID)
+		if err != nil {
+			return err
+		}
+
+		isSolved := update.Status == UpdateResolved
+		if isSolved == report.IsSolved {
+			return nil
+		}
+		report.UpdatedAt = &update.CreatedAt
+		action = report.setSolved(isSolved)
+		return saveReport(tx, report, action, update.Author)
+	})
+	if err != nil {
+		return ReportUpdate{}, "", err
+	}
+
+	return update, action, nil
+}
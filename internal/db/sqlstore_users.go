@@ -0,0 +1,151 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+)
+
+func (s *sqlStore) User(username string) (User, error) {
+	user := User{}
+	err := s.QueryRow("SELECT username, role, disabled, totp_enabled FROM users WHERE username=?", username).
+		Scan(&user.Username, &user.Role, &user.Disabled, &user.TwoFactor)
+	return user, notFound(err, errUserNotFound)
+}
+
+func (s *sqlStore) Users() ([]User, error) {
+	var users []User
+	rows, err := s.Query("SELECT username, role, disabled, totp_enabled FROM users ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := User{}
+		err := rows.Scan(&user.Username, &user.Role, &user.Disabled, &user.TwoFactor)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func (s *sqlStore) Credentials(username string) (Credentials, error) {
+	creds := Credentials{}
+	err := s.QueryRow("SELECT username, role, disabled, totp_enabled, password, salt FROM users WHERE username=?", username).
+		Scan(&creds.Username, &creds.Role, &creds.Disabled, &creds.TwoFactor, &creds.Hash, &creds.Salt)
+	return creds, notFound(err, errUserNotFound)
+}
+
+func (s *sqlStore) CreateUser(user User, hash string) error {
+	_, err := s.Exec("INSERT INTO users (username, password, salt, role, disabled) VALUES (?, ?, '', ?, ?)",
+		user.Username, hash, user.Role, user.Disabled)
+	return err
+}
+
+func (s *sqlStore) UpdateUser(username string, updated User) error {
+	return s.inTx(func(tx conn) error {
+		_, err := tx.Exec("UPDATE users SET username=?, role=?, disabled=? WHERE username=?", updated.Username, updated.Role, updated.Disabled, username)
+		if err != nil || updated.Username == username {
+			return err
+		}
+
+		renames := []string{
+			"UPDATE api_tokens SET username=? WHERE username=?",
+			"UPDATE reports SET created_by=? WHERE created_by=?",
+			"UPDATE reports SET deleted_by=? WHERE deleted_by=?",
+			"UPDATE report_events SET actor=? WHERE actor=?",
+			"UPDATE report_updates SET author=? WHERE author=?",
+			"UPDATE maintenances SET created_by=? WHERE created_by=?",
+			"UPDATE recovery_codes SET username=? WHERE username=?",
+		}
+		for _, query := range renames {
+			if _, err := tx.Exec(query, updated.Username, username); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *sqlStore) SetPassword(username, hash string) error {
+	res, err := s.Exec("UPDATE users SET password=?, salt='' WHERE username=?", hash, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) UsernameTaken(username string) (bool, error) {
+	err := s.QueryRow("SELECT 1 FROM users WHERE username=?", username).Scan(new(int))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *sqlStore) CountActiveAdmins() (int, error) {
+	var count int
+	err := s.QueryRow("SELECT COUNT(*) FROM users WHERE role=? AND disabled=false", RoleAdmin).Scan(&count)
+	return count, err
+}
+
+func (s *sqlStore) TokenByHash(hash string) (Token, User, error) {
+	token, user := Token{}, User{}
+	err := s.QueryRow(`SELECT t.id, t.username, t.name, t.scope, t.created_at, t.expires_at, t.last_used_at, u.role, u.disabled
+		FROM api_tokens t JOIN users u ON u.username = t.username
+		WHERE t.token_hash=?`, hash).
+		Scan(&token.ID, &token.Username, &token.Name, &token.Scope, &token.CreatedAt, &token.ExpiresAt, &token.LastUsedAt, &user.Role, &user.Disabled)
+	user.Username = token.Username
+	return token, user, notFound(err, ErrNotFound)
+}
+
+func (s *sqlStore) TouchToken(id int64) error {
+	_, err := s.Exec("UPDATE api_tokens SET last_used_at=? WHERE id=?", now(), id)
+	return err
+}
+
+func (s *sqlStore) Tokens(username string) ([]Token, error) {
+	var tokens []Token
+	rows, err := s.Query(`SELECT id, username, name, scope, created_at, expires_at, last_used_at
+		FROM api_tokens WHERE username=? ORDER BY id`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		token := Token{}
+		err := rows.Scan(&token.ID, &token.Username, &token.Name, &token.Scope, &token.CreatedAt, &token.ExpiresAt, &token.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+func (s *sqlStore) CreateToken(token Token, hash string) (Token, error) {
+	err := s.QueryRow(`INSERT INTO api_tokens (username, name, token_hash, scope, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?) RETURNING id`,
+		token.Username, token.Name, hash, token.Scope, token.CreatedAt, token.ExpiresAt).Scan(&token.ID)
+	return token, err
+}
+
+func (s *sqlStore) DeleteToken(id int64, username string) error {
+	res, err := s.Exec("DELETE FROM api_tokens WHERE id=? AND username=?", id, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"strings"
+	"time"
+)
+
+const webhookColumns = "id, url, secret, events, disabled, created_at"
+
+// scanWebhook reads a row selected with webhookColumns.
+func scanWebhook(row interface{ Scan(...any) error }) (Webhook, error) {
+	webhook := Webhook{}
+	var events string
+	err := row.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, &events, &webhook.Disabled, &webhook.CreatedAt)
+	webhook.Events = []string{}
+	if events != "" {
+		webhook.Events = strings.Split(events, ",")
+	}
+	return webhook, err
+}
+
+func (s *sqlStore) Webhooks() ([]Webhook, error) {
+	webhooks := []Webhook{}
+	rows, err := s.Query("SELECT " + webhookColumns + " FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (s *sqlStore) Webhook(id int64) (Webhook, error) {
+	webhook, err := scanWebhook(s.QueryRow("SELECT "+webhookColumns+" FROM webhooks WHERE id=?", id))
+	return webhook, notFound(err, ErrNotFound)
+}
+
+func (s *sqlStore) CreateWebhook(webhook Webhook) (Webhook, error) {
+	err := s.QueryRow("INSERT INTO webhooks (url, secret, events, disabled, created_at) VALUES (?, ?, ?, ?, ?) RETURNING id",
+		webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","), webhook.Disabled, webhook.CreatedAt).Scan(&webhook.ID)
+	return webhook, err
+}
+
+func (s *sqlStore) UpdateWebhook(webhook Webhook) error {
+	res, err := s.Exec("UPDATE webhooks SET url=?, secret=?, events=?, disabled=? WHERE id=?",
+		webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","), webhook.Disabled, webhook.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) DeleteWebhook(id int64) error {
+	return s.inTx(func(tx conn) error {
+		res, err := tx.Exec("DELETE FROM webhooks WHERE id=?", id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+
+		_, err = tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id=?", id)
+		return err
+	})
+}
+
+const deliveryColumns = "id, webhook_id, event, payload, status, attempts, response_status, error, created_at, next_attempt_at, last_attempt_at"
+
+// queryDeliveries selects webhook deliveries.
+func (s *sqlStore) queryDeliveries(query string, args ...any) ([]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+	rows, err := s.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// scanDelivery reads a row selected with deliveryColumns.
+func scanDelivery(row interface{ Scan(...any) error }) (WebhookDelivery, error) {
+	delivery := WebhookDelivery{}
+	var payload []byte
+	err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &payload, &delivery.Status, &delivery.Attempts,
+		&delivery.ResponseStatus, &delivery.Error, &delivery.CreatedAt, &delivery.NextAttemptAt, &delivery.LastAttemptAt)
+	delivery.Payload = payload
+	return delivery, err
+}
+
+func (s *sqlStore) Deliveries(webhookID int64, limit int) ([]WebhookDelivery, error) {
+	return s.queryDeliveries("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE webhook_id=? ORDER BY id DESC LIMIT ?", webhookID, limit)
+}
+
+func (s *sqlStore) Delivery(id int64) (WebhookDelivery, error) {
+	delivery, err := scanDelivery(s.QueryRow("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE id=?", id))
+	return delivery, notFound(err, ErrNotFound)
+}
+
+func (s *sqlStore) QueueDelivery(delivery WebhookDelivery) (WebhookDelivery, error) {
+	err := s.QueryRow(`INSERT INTO webhook_deliveries (webhook_id, event, payload, status, attempts, created_at, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		delivery.WebhookID, delivery.Event, string(delivery.Payload), delivery.Status, delivery.Attempts, delivery.CreatedAt, delivery.NextAttemptAt).
+		Scan(&delivery.ID)
+	return delivery, err
+}
+
+func (s *sqlStore) DueDeliveries(at time.Time, limit int) ([]WebhookDelivery, error) {
+	return s.queryDeliveries(`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE status=? AND next_attempt_at<=? AND webhook_id IN (SELECT id FROM webhooks WHERE disabled=false)
+		ORDER BY next_attempt_at, id LIMIT ?`, DeliveryPending, at, limit)
+}
+
+func (s *sqlStore) SaveDeliveryAttempt(delivery WebhookDelivery) error {
+	res, err := s.Exec(`UPDATE webhook_deliveries SET status=?, attempts=?, response_status=?, error=?, next_attempt_at=?, last_attempt_at=?
+		WHERE id=?`,
+		delivery.Status, delivery.Attempts, delivery.ResponseStatus, delivery.Error, delivery.NextAttemptAt, delivery.LastAttemptAt, delivery.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package db
+
+import (
+	"errors"
+	"example/downdetector/internal/config"
+	"example/downdetector/internal/utils"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// DB is the store used by the handlers. It is set by Open or Connect.
+var DB Store
+
+// ErrNotFound is returned by a Store when the requested record doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// Store keeps everything the app persists.
+type Store interface {
+	ReportStore
+	ServiceStore
+	UserStore
+	TokenStore
+	WebhookStore
+	SubscriberStore
+	MaintenanceStore
+	AuditStore
+	LoginThrottleStore
+	TwoFactorStore
+	SettingsStore
+	SchemaStore
+
+	Close() error
+}
+
+// ReportStore keeps reports and their history.
+type ReportStore interface {
+	// OpenReports returns the reports which aren't solved yet, oldest first.
+	OpenReports() ([]Report, error)
+	// AllReports returns every report, oldest first.
+	// Like every other method, apart from the ones handling the trash, it leaves out the reports in the trash.
+	AllReports() ([]Report, error)
+	// QueryReports returns a page of reports matching the filter.
+	QueryReports(filter ReportFilter) (ReportPage, error)
+	// SearchReports returns at most limit reports containing words starting with each of the terms
+	// in the title, content or updates, open ones first and then newest first.
+	SearchReports(terms []string, limit int) ([]SearchResult, error)
+	Report(id uint) (Report, error)
+	// CreateReport saves a new report created by actor, attaches its services and records it in its history.
+	CreateReport(report Report, actor string) (Report, error)
+	// UpdateReport lets change modify the report, saves it and records the returned action in its history.
+	// UpdatedAt is already set to the time of the change when change is called.
+	UpdateReport(id uint, actor string, change func(report *Report) EventAction) (Report, error)
+	// DeleteReport moves the report to the trash and records it in its history.
+	DeleteReport(id uint, actor string) (Report, error)
+
+	// TrashedReports returns the reports in the trash, oldest first.
+	TrashedReports() ([]Report, error)
+	// RestoreReport brings the report back from the trash and records it in its history.
+	RestoreReport(id uint, actor string) (Report, error)
+	// PurgeReports removes the reports which were moved to the trash before the given time, together with
+	// their updates and history. Only the audit log keeps what was done to them.
+	PurgeReports(before time.Time) ([]Report, error)
+
+	// ReportEvents returns the history of a report, oldest first.
+	ReportEvents(id uint) ([]ReportEvent, error)
+	// AllReportEvents returns the history of every report, oldest first.
+	AllReportEvents() ([]ReportEvent, error)
+	// LastReportChange returns when a report was last created, changed or deleted, zero if that never happened.
+	LastReportChange() (time.Time, error)
+
+	// ReportUpdates returns the updates posted about a report, newest first.
+	ReportUpdates(id uint) ([]ReportUpdate, error)
+	// AllReportUpdates returns the updates of every report, newest first.
+	AllReportUpdates() ([]ReportUpdate, error)
+	// OpenReportUpdates returns the updates of the reports which aren't solved yet, newest first.
+	OpenReportUpdates() ([]ReportUpdate, error)
+	// AddReportUpdate appends the update to its report. An update with the resolved status solves the report
+	// and any other status reopens it, which is recorded in the history of the report.
+	// The returned action is what happened to the report, empty if it was left alone.
+	AddReportUpdate(update ReportUpdate) (ReportUpdate, EventAction, error)
+}
+
+// ServiceStore keeps the catalog of services reports are attached to.
+type ServiceStore interface {
+	// Services returns every service ordered by group and name.
+	Services() ([]Service, error)
+	Service(id int64) (Service, error)
+	CreateService(service Service) (Service, error)
+	UpdateService(service Service) error
+	// DeleteService removes the service and detaches it from its reports.
+	DeleteService(id int64) error
+}
+
+// UserStore keeps the accounts.
+type UserStore interface {
+	User(username string) (User, error)
+	// Users returns every account ordered by username.
+	Users() ([]User, error)
+	// Credentials returns the account together with its password hash.
+	Credentials(username string) (Credentials, error)
+	CreateUser(user User, hash string) error
+	// UpdateUser saves the changed account, moving everything owned by it when it's renamed.
+	UpdateUser(username string, updated User) error
+	// SetPassword replaces the password hash of the account and clears its legacy salt.
+	SetPassword(username, hash string) error
+	UsernameTaken(username string) (bool, error)
+	// CountActiveAdmins returns the number of enabled accounts with the admin role.
+	CountActiveAdmins() (int, error)
+}
+
+// TokenStore keeps personal API tokens. Tokens are looked up by their hash, the tokens themselves are never stored.
+type TokenStore interface {
+	// TokenByHash returns the token with the given hash and its owner.
+	TokenByHash(hash string) (Token, User, error)
+	// TouchToken records that the token was just used.
+	TouchToken(id int64) error
+	// Tokens returns the tokens owned by the user.
+	Tokens(username string) ([]Token, error)
+	CreateToken(token Token, hash string) (Token, error)
+	// DeleteToken removes a token, as long as it's owned by the user.
+	DeleteToken(id int64, username string) error
+}
+
+// WebhookStore keeps webhooks and the log of their deliveries.
+type WebhookStore interface {
+	// Webhooks returns every webhook, oldest first.
+	Webhooks() ([]Webhook, error)
+	Webhook(id int64) (Webhook, error)
+	CreateWebhook(webhook Webhook) (Webhook, error)
+	UpdateWebhook(webhook Webhook) error
+	// DeleteWebhook removes the webhook together with its deliveries.
+	DeleteWebhook(id int64) error
+
+	// Deliveries returns the most recent deliveries to the webhook, newest first.
+	Deliveries(webhookID int64, limit int) ([]WebhookDelivery, error)
+	Delivery(id int64) (WebhookDelivery, error)
+	// QueueDelivery saves a new delivery, to be attempted at its NextAttemptAt.
+	QueueDelivery(delivery WebhookDelivery) (WebhookDelivery, error)
+	// DueDeliveries returns the pending deliveries to enabled webhooks whose next attempt is due at the given time,
+	// most overdue first.
+	DueDeliveries(at time.Time, limit int) ([]WebhookDelivery, error)
+	// SaveDeliveryAttempt records the outcome of an attempt: the status, attempts, response, error and next attempt.
+	SaveDeliveryAttempt(delivery WebhookDelivery) error
+}
+
+// SubscriberStore keeps the email addresses notified about reports.
+type SubscriberStore interface {
+	// ConfirmedSubscribers returns the subscribers who confirmed their address, oldest first.
+	ConfirmedSubscribers() ([]Subscriber, error)
+	SubscriberByEmail(email string) (Subscriber, error)
+	SubscriberByToken(token string) (Subscriber, error)
+	CreateSubscriber(subscriber Subscriber) (Subscriber, error)
+	// TouchConfirmationSent records that the confirmation link was sent again.
+	TouchConfirmationSent(id int64, at time.Time) error
+	ConfirmSubscriber(id int64, at time.Time) error
+	DeleteSubscriber(id int64) error
+}
+
+// MaintenanceStore keeps the announced maintenance windows.
+type MaintenanceStore interface {
+	// Maintenances returns every maintenance window ordered by start.
+	Maintenances() ([]Maintenance, error)
+	Maintenance(id int64) (Maintenance, error)
+	CreateMaintenance(maintenance Maintenance) (Maintenance, error)
+	// UpdateMaintenance lets change modify the maintenance and saves it, unless change returns an error.
+	// UpdatedAt is already set to the time of the change when change is called.
+	UpdateMaintenance(id int64, change func(maintenance *Maintenance) error) (Maintenance, error)
+	// AdvanceMaintenances moves the scheduled and in progress maintenances which are due at the given time
+	// to their next status and returns them.
+	AdvanceMaintenances(at time.Time) ([]Maintenance, error)
+}
+
+// AuditStore keeps the audit log. Entries are only ever added.
+type AuditStore interface {
+	AddAuditEntry(entry AuditEntry) (AuditEntry, error)
+	// AuditEntries returns the entries matching the filter, newest first.
+	AuditEntries(filter AuditFilter) ([]AuditEntry, error)
+}
+
+// LoginThrottleStore keeps the failed logins of each client address and username.
+type LoginThrottleStore interface {
+	// LoginThrottle returns the failed logins of the subject, with no failures when there are none.
+	LoginThrottle(kind ThrottleKind, subject string) (LoginThrottle, error)
+	// FailLogin lets change record another failed login in the throttle of the subject and saves it.
+	FailLogin(kind ThrottleKind, subject string, change func(t *LoginThrottle)) (LoginThrottle, error)
+	// ClearLoginThrottle forgets the failed logins of the subject, ErrNotFound when there were none.
+	ClearLoginThrottle(kind ThrottleKind, subject string) error
+	// ForgetLoginFailures removes the throttles which last failed and stopped blocking before the given time.
+	ForgetLoginFailures(before time.Time) error
+	// LoginLockouts returns the usernames locked out at the given time, by username.
+	LoginLockouts(at time.Time) ([]LoginThrottle, error)
+}
+
+// TwoFactorStore keeps the TOTP secrets of the accounts and their recovery codes.
+// Recovery codes are looked up by their hash, the codes themselves are never stored.
+type TwoFactorStore interface {
+	TOTP(username string) (TOTP, error)
+	// SetTOTPSecret saves the secret of a two-factor setup which isn't confirmed yet.
+	// It leaves an account with two-factor authentication already enabled alone and returns ErrNotFound.
+	SetTOTPSecret(username, secret string) error
+	// EnableTOTP turns on two-factor authentication with the saved secret, remembering the step of the code which
+	// confirmed it, and replaces the recovery codes of the account.
+	EnableTOTP(username string, step int64, recoveryHashes []string) error
+	// DisableTOTP turns off two-factor authentication, forgetting the secret and the recovery codes.
+	DisableTOTP(username string) error
+	// UseTOTPStep records that the code of the given time step was used, ErrNotFound when a code of the same
+	// or a later step was used already.
+	UseTOTPStep(username string, step int64) error
+	// SetRecoveryCodes replaces the recovery codes of the account.
+	SetRecoveryCodes(username string, hashes []string) error
+	// UseRecoveryCode marks the unused recovery code with the given hash as used, ErrNotFound when there is none.
+	UseRecoveryCode(username, hash string, at time.Time) error
+	// RecoveryCodesLeft returns the number of unused recovery codes of the account.
+	RecoveryCodesLeft(username string) (int, error)
+}
+
+// SettingsStore keeps the settings changed by admins while the app is running.
+type SettingsStore interface {
+	// Setting returns the value of the setting, ErrNotFound when it was never set.
+	Setting(name string) (string, error)
+	SetSetting(name, value string) error
+}
+
+// SchemaStore manages the versioned schema of the store.
+type SchemaStore interface {
+	// MigrateUp applies every missing migration. It refuses to touch a store migrated by a newer version of the app.
+	MigrateUp() error
+	// MigrateDown reverts the given number of most recently applied migrations.
+	MigrateDown(steps int) error
+	// MigrationStatus lists every known migration and when it was applied.
+	MigrationStatus() ([]MigrationState, error)
+}
+
+// Credentials is an account together with what's needed to check its password.
+type Credentials struct {
+	User
+	Hash string
+	// Salt is only set for legacy sha256 hashes.
+	Salt string
+}
+
+// Open opens the store selected by the configuration without touching its schema.
+func Open(cfg config.Config) error {
+	var err error
+	switch cfg.DBDriver {
+	case config.DriverPostgres:
+		DB, err = openSQLStore(postgresDialect, cfg.DBURL)
+	case config.DriverMemory:
+		DB, err = openMemoryStore()
+	default:
+		DB, err = openSQLiteStore(cfg.DBPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s database: %w", cfg.DBDriver, err)
+	}
+	return nil
+}
+
+// Connect opens the store selected by the configuration.
+// With AutoMigrate the schema is brought up to date, otherwise pending migrations are an error.
+func Connect(cfg config.Config) error {
+	utils.NoReportLog.Info("Connecting to db...", "driver", cfg.DBDriver)
+	err := Open(cfg)
+	if err != nil {
+		return err
+	}
+
+	if cfg.AutoMigrate {
+		err = DB.MigrateUp()
+	} else {
+		err = checkMigrated()
+	}
+	if err != nil {
+		log.Error("Error migrating schema", "err", err)
+		return err
+	}
+
+	err = seedAdmin()
+	if err != nil {
+		log.Error("Error creating default user", "err", err)
+		return err
+	}
+
+	utils.NoReportLog.Info("Connected")
+	return nil
+}
+
+// checkMigrated returns an error if any migration is missing from the store.
+func checkMigrated() error {
+	states, err := DB.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			return fmt.Errorf("migration %d_%s is not applied, run the migrate up command", state.Version, state.Name)
+		}
+	}
+
+	return nil
+}
+
+// seedAdmin creates a default user with password 'changeme' if there are no users
+func seedAdmin() error {
+	users, err := DB.Users()
+	if err != nil || len(users) > 0 {
+		return err
+	}
+
+	hash, err := HashPassword("changeme")
+	if err != nil {
+		return err
+	}
+
+	err = DB.CreateUser(User{Username: "admin", Role: RoleAdmin}, hash)
+	if err != nil {
+		return err
+	}
+
+	utils.NoReportLog.Warn("Created default user admin with password 'changeme', change it after logging in")
+	return nil
+}
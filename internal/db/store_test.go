@@ -0,0 +1,58 @@
+package db
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentWritesToSQLiteFile(t *testing.T) {
+	s, err := openSQLiteStore(filepath.Join(t.TempDir(), "reports.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if err := s.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	DB = s
+	report, err := SubmitReport(NewReport{Title: "Awaria API", Content: "Nie działa logowanie."}, "jan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both read the report before changing it, like the handlers posting updates and editing reports
+	const writers = 30
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*writers)
+	for i := range writers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, _, err := s.AddReportUpdate(ReportUpdate{ReportID: report.ID, Author: "jan", Status: UpdateIdentified, Message: "Szukamy przyczyny."})
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := s.UpdateReport(report.ID, "jan", func(report *Report) EventAction {
+				return report.setSolved(i%2 == 0)
+			})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("concurrent write failed: %v", err)
+		}
+	}
+
+	updates, err := s.ReportUpdates(report.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != writers {
+		t.Errorf("got %d updates, want %d", len(updates), writers)
+	}
+}
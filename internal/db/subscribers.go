@@ -0,0 +1,21 @@
+package db
+
+import (
+	"time"
+)
+
+// Subscriber is an email address notified about reports. Nothing is sent to it before the address is confirmed.
+type Subscriber struct {
+	ID    int64
+	Email string
+	// Token is sent in the confirmation and unsubscribe links, so that only the owner of the address can use them.
+	Token              string
+	CreatedAt          time.Time
+	ConfirmationSentAt time.Time
+	ConfirmedAt        *time.Time
+}
+
+// Confirmed reports whether the owner of the address confirmed the subscription.
+func (s Subscriber) Confirmed() bool {
+	return s.ConfirmedAt != nil
+}
@@ -0,0 +1,257 @@
+package db
+
+import (
+	"errors"
+	"example/downdetector/internal/utils"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// ThrottleKind is what the failed logins of a throttle are counted by.
+type ThrottleKind string
+
+const (
+	ThrottleIP   ThrottleKind = "ip"
+	ThrottleUser ThrottleKind = "user"
+)
+
+// LoginThrottle counts the recent failed logins of a client address or a username, which delay the next attempt.
+// Failures are counted for every username tried, whether the account exists or not, so that being throttled
+// doesn't tell which usernames are real.
+type LoginThrottle struct {
+	Kind          ThrottleKind `json:"kind"`
+	Subject       string       `json:"subject"`
+	Failures      int          `json:"failures"`
+	LastFailureAt time.Time    `json:"lastFailureAt"`
+	// BlockedUntil is when the next attempt is let through.
+	BlockedUntil time.Time `json:"blockedUntil"`
+	// Locked is set once a username failed lockoutFailures times. It stays locked out until BlockedUntil,
+	// unless an admin unlocks it earlier.
+	Locked bool `json:"locked"`
+}
+
+const (
+	// freeUserFailures and freeIPFailures are the failed logins allowed before the next attempt is delayed.
+	// An address gets more of them, since many users can share it.
+	freeUserFailures = 3
+	freeIPFailures   = 10
+	// minLoginDelay is the delay after the first failure which isn't free, doubled after every further one
+	// up to maxLoginDelay.
+	minLoginDelay = time.Second
+	maxLoginDelay = 5 * time.Minute
+	// lockoutFailures failed logins as the same username lock it out for lockoutDuration.
+	lockoutFailures = 10
+	lockoutDuration = time.Hour
+	// failureMemory is how long a failed login is remembered.
+	failureMemory = 24 * time.Hour
+)
+
+// loginDelay returns how long the given number of failures makes the next attempt wait.
+func loginDelay(failures, free int) time.Duration {
+	n := failures - free - 1
+	switch {
+	case n < 0:
+		return 0
+	case n >= 20:
+		// Long past the maximum, shifting further would overflow
+		return maxLoginDelay
+	default:
+		return min(minLoginDelay<<n, maxLoginDelay)
+	}
+}
+
+// countFailure adds a failed login at the given time to the throttle, starting over when the last one is forgotten.
+func countFailure(t *LoginThrottle, at time.Time, free int) {
+	if at.Sub(t.LastFailureAt) > failureMemory {
+		t.Failures, t.Locked = 0, false
+	}
+	t.Failures++
+	t.LastFailureAt = at
+	t.BlockedUntil = at.Add(loginDelay(t.Failures, free))
+}
+
+// loginLocks serializes the logins from each client address and as each username, from checking the throttle
+// until the outcome is recorded, so that a burst of parallel guesses can't all get past the throttle before the
+// first of them is counted. The app runs as a single process, so locking within it is enough.
+var loginLocks = struct {
+	sync.Mutex
+	held map[string]*loginLock
+}{held: map[string]*loginLock{}}
+
+// loginLock is held by the login in progress for a key, and waited for by the others.
+type loginLock struct {
+	sync.Mutex
+	// waiting counts the logins holding or waiting for the lock, so that it's forgotten once there are none.
+	waiting int
+}
+
+// lockKey waits for the logins in progress for the key to finish and returns the function letting the next one in.
+func lockKey(key string) func() {
+	loginLocks.Lock()
+	l := loginLocks.held[key]
+	if l == nil {
+		l = &loginLock{}
+		loginLocks.held[key] = l
+	}
+	l.waiting++
+	loginLocks.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		loginLocks.Lock()
+		l.waiting--
+		if l.waiting == 0 {
+			delete(loginLocks.held, key)
+		}
+		loginLocks.Unlock()
+	}
+}
+
+// lockLogin waits for the other logins from ip or as username to finish, see loginLocks.
+// The address is always locked first, so that two logins never wait for each other.
+func lockLogin(ip, username string) func() {
+	unlockIP := lockKey(string(ThrottleIP) + ":" + ip)
+	unlockUser := lockKey(string(ThrottleUser) + ":" + truncate(username, maxAuditText))
+	return func() {
+		unlockUser()
+		unlockIP()
+	}
+}
+
+// loginWait returns how long the client at ip has to wait before trying to log in as username, 0 if it can try now.
+func loginWait(ip, username string, at time.Time) (time.Duration, error) {
+	username = truncate(username, maxAuditText)
+	ipThrottle, err := DB.LoginThrottle(ThrottleIP, ip)
+	if err != nil {
+		return 0, err
+	}
+	userThrottle, err := DB.LoginThrottle(ThrottleUser, username)
+	if err != nil {
+		return 0, err
+	}
+	return max(ipThrottle.BlockedUntil.Sub(at), userThrottle.BlockedUntil.Sub(at), 0), nil
+}
+
+// loginFailed records a failed login of the client at ip as username, and reports whether it locked the username out.
+func loginFailed(ip, username string, at time.Time) (bool, error) {
+	username = truncate(username, maxAuditText)
+	if err := DB.ForgetLoginFailures(at.Add(-failureMemory)); err != nil {
+		return false, err
+	}
+
+	_, err := DB.FailLogin(ThrottleIP, ip, func(t *LoginThrottle) {
+		countFailure(t, at, freeIPFailures)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	locked := false
+	_, err = DB.FailLogin(ThrottleUser, username, func(t *LoginThrottle) {
+		countFailure(t, at, freeUserFailures)
+		if t.Failures >= lockoutFailures {
+			locked = !t.Locked
+			t.Locked, t.BlockedUntil = true, at.Add(lockoutDuration)
+		}
+	})
+	return locked, err
+}
+
+// rejectLogin answers a failed login the same way whatever the reason, and counts it against the client and username.
+// Wrong codes of the second step count the same as wrong passwords, they're only audited as the given action.
+func rejectLogin(w http.ResponseWriter, r *http.Request, username string, at time.Time, action AuditAction) {
+	ip := clientIP(r)
+	auditAs(r, "", action, "user", username, nil, nil)
+
+	locked, err := loginFailed(ip, username, at)
+	if err != nil {
+		log.Error("Failed to record failed login", "err", err)
+	}
+	if locked {
+		utils.NoReportLog.Infof("%s locked out user %s after %d failed logins", r.RemoteAddr, username, lockoutFailures)
+		auditAs(r, "", AuditUserLocked, "user", username, nil, nil)
+	}
+
+	w.WriteHeader(http.StatusForbidden)
+}
+
+// throttleLogin refuses the login when the client or the username failed too many times recently,
+// telling how long to wait in the Retry-After header. It returns false when the login was refused.
+func throttleLogin(w http.ResponseWriter, r *http.Request, username string, at time.Time) bool {
+	wait, err := loginWait(clientIP(r), username, at)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to check failed logins", "err", err)
+		return false
+	}
+	if wait <= 0 {
+		return true
+	}
+
+	auditAs(r, "", AuditLoginBlocked, "user", username, nil, nil)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many failed logins, try again later", http.StatusTooManyRequests)
+	return false
+}
+
+// ListLockoutsHandler returns the usernames locked out after too many failed logins.
+//
+// @Summary List locked out usernames
+// @Description Returns the usernames locked out after too many failed logins in a row, with when the lockout ends.
+// @Description Usernames which don't belong to any account are locked out too, so that lockouts don't reveal which ones exist.
+// @Description Requires the admin role.
+// @Tags admin
+// @Produce json
+// @Success 200 {array} LoginThrottle
+// @Failure 403
+// @Failure 500
+// @Router /users/lockouts [get]
+func ListLockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := DB.LoginLockouts(now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select lockouts", "err", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, lockouts)
+}
+
+// UnlockUserHandler lifts the lockout of a username and forgets its failed logins.
+//
+// @Summary Unlock a username
+// @Description Lifts the lockout of a username after too many failed logins and forgets its failed logins.
+// @Description Failed logins counted against client addresses are left alone. Requires the admin role.
+// @Tags admin
+// @Produce plain
+// @Param username path string true "Username"
+// @Success 200
+// @Failure 403
+// @Failure 404 "No failed logins are recorded for the username"
+// @Failure 500
+// @Router /users/{username}/lockout [delete]
+func UnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+
+	err := DB.ClearLoginThrottle(ThrottleUser, username)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "No failed logins recorded for this username", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to unlock user", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s unlocked user %s", ip, username)
+	audit(r, AuditUserUnlocked, "user", username, nil, nil)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoginDelay(t *testing.T) {
+	tests := []struct {
+		failures, free int
+		want           time.Duration
+	}{
+		{0, freeUserFailures, 0},
+		{3, freeUserFailures, 0},
+		{4, freeUserFailures, time.Second},
+		{5, freeUserFailures, 2 * time.Second},
+		{6, freeUserFailures, 4 * time.Second},
+		{12, freeUserFailures, 256 * time.Second},
+		{13, freeUserFailures, maxLoginDelay},
+		{1000, freeUserFailures, maxLoginDelay},
+		{10, freeIPFailures, 0},
+		{11, freeIPFailures, time.Second},
+	}
+	for _, tt := range tests {
+		if got := loginDelay(tt.failures, tt.free); got != tt.want {
+			t.Errorf("loginDelay(%d, %d) = %s, want %s", tt.failures, tt.free, got, tt.want)
+		}
+	}
+}
+
+func TestFailuresForgotten(t *testing.T) {
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	throttle := LoginThrottle{Failures: 9, LastFailureAt: at, Locked: true}
+
+	countFailure(&throttle, at.Add(failureMemory+time.Second), freeUserFailures)
+	if throttle.Failures != 1 || throttle.Locked {
+		t.Errorf("throttle = %+v, want a single failure after the old ones were forgotten", throttle)
+	}
+}
+
+func TestLoginWaitGrows(t *testing.T) {
+	setupTestStore(t)
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= 6; i++ {
+		if _, err := loginFailed("192.0.2.1", "admin", at); err != nil {
+			t.Fatal(err)
+		}
+		wait, err := loginWait("192.0.2.1", "admin", at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := loginDelay(i, freeUserFailures); wait != want {
+			t.Errorf("after %d failures wait = %s, want %s", i, wait, want)
+		}
+	}
+	// Another username from another address isn't affected
+	if wait, _ := loginWait("192.0.2.2", "editor", at); wait != 0 {
+		t.Errorf("unrelated login has to wait %s", wait)
+	}
+}
+
+func TestLockoutAndUnlock(t *testing.T) {
+	setupTestStore(t)
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= lockoutFailures; i++ {
+		// Each from another address, so that only the username is throttled
+		locked, err := loginFailed(fmt.Sprintf("192.0.2.%d", i), "admin", at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if locked != (i == lockoutFailures) {
+			t.Errorf("failure %d locked = %t", i, locked)
+		}
+	}
+
+	lockouts, err := DB.LoginLockouts(at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lockouts) != 1 || lockouts[0].Subject != "admin" || !lockouts[0].BlockedUntil.Equal(at.Add(lockoutDuration)) {
+		t.Fatalf("lockouts = %+v, want admin until %s", lockouts, at.Add(lockoutDuration))
+	}
+	if wait, _ := loginWait("192.0.2.100", "admin", at); wait != lockoutDuration {
+		t.Errorf("locked out username has to wait %s, want %s", wait, lockoutDuration)
+	}
+
+	unlock := func() int {
+		r := httptest.NewRequest(http.MethodDelete, "/api/users/admin/lockout", nil)
+		r.SetPathValue("username", "admin")
+		w := httptest.NewRecorder()
+		UnlockUserHandler(w, r)
+		return w.Code
+	}
+	if code := unlock(); code != http.StatusOK {
+		t.Fatalf("unlock answered %d", code)
+	}
+	if wait, _ := loginWait("192.0.2.100", "admin", at); wait != 0 {
+		t.Errorf("unlocked username has to wait %s", wait)
+	}
+	if lockouts, _ := DB.LoginLockouts(at); len(lockouts) != 0 {
+		t.Errorf("lockouts after unlock = %+v", lockouts)
+	}
+	if code := unlock(); code != http.StatusNotFound {
+		t.Errorf("second unlock answered %d, want 404", code)
+	}
+}
+
+func TestParallelGuessesThrottled(t *testing.T) {
+	setupTestStore(t)
+	createTestUser(t, User{Username: "admin", Role: RoleAdmin}, "changeme")
+	// The next failure delays further attempts long enough for the test
+	at := now()
+	_, err := DB.FailLogin(ThrottleUser, "admin", func(t *LoginThrottle) {
+		t.Failures, t.LastFailureAt, t.BlockedUntil = 8, at, at
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login := LoginMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	const guesses = 8
+	codes := make(chan int, guesses)
+	var wg sync.WaitGroup
+	for i := range guesses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"username":"admin","password":"guess%d"}`, i)
+			w := httptest.NewRecorder()
+			login(w, httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body)))
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	count := map[int]int{}
+	for code := range codes {
+		count[code]++
+	}
+	if count[http.StatusForbidden] != 1 || count[http.StatusTooManyRequests] != guesses-1 {
+		t.Errorf("answers = %v, want a single checked guess and the rest throttled", count)
+	}
+	throttle, err := DB.LoginThrottle(ThrottleUser, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if throttle.Failures != 9 || throttle.Locked {
+		t.Errorf("throttle = %+v, want 9 failures and no lockout", throttle)
+	}
+}
@@ -0,0 +1,223 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"example/downdetector/internal/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// tokenPrefix marks personal API tokens, so they are easy to recognise e.g. by secret scanners.
+const tokenPrefix = "nb_"
+
+// tokenLength is the number of random characters in a token after the prefix.
+const tokenLength = 40
+
+// Token is a personal API token as shown to its owner. The token itself is only stored hashed.
+type Token struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	// Scope is the highest role the token can act as, it's never higher than the role of its owner.
+	Scope      Role       `json:"scope"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// Expired reports whether the token can't be used anymore.
+func (t Token) Expired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
+
+// NewToken is the payload used to create a token.
+type NewToken struct {
+	Name  string `json:"name"`
+	Scope Role   `json:"scope"`
+	// ExpiresInDays sets the lifetime of the token, 0 means the token never expires.
+	ExpiresInDays int `json:"expiresInDays"`
+}
+
+// CreatedToken is returned once after creating a token. The token can't be retrieved later.
+type CreatedToken struct {
+	Token
+	Secret string `json:"token"`
+}
+
+// hashToken returns the form a token is stored in. Tokens are long and random, so a plain sha256 is enough.
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// bearerToken returns the token from the Authorization header, if there is one.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// authenticateToken returns the user acting through the given token.
+// The role of the returned user is limited to the scope of the token.
+func authenticateToken(token string) (User, error) {
+	t, user, err := DB.TokenByHash(hashToken(token))
+	if errors.Is(err, ErrNotFound) {
+		return User{}, errUserNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	if user.Disabled || t.Expired() {
+		return User{}, errUserNotFound
+	}
+
+	if !t.Scope.Allows(user.Role) {
+		user.Role = t.Scope
+	}
+	user.tokenID = t.ID
+
+	err = DB.TouchToken(t.ID)
+	if err != nil {
+		log.Error("Failed to update token usage", "err", err)
+	}
+
+	return user, nil
+}
+
+// ListTokensHandler returns the tokens of the logged-in user.
+//
+// @Summary List API tokens
+// @Description Returns the personal API tokens of the logged-in user, without the tokens themselves.
+// @Tags tokens
+// @Produce json
+// @Success 200 {array} Token
+// @Failure 500
+// @Router /tokens [get]
+func ListTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := CurrentUser(r)
+
+	tokens, err := DB.Tokens(user.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select tokens", "err", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, tokens)
+}
+
+// CreateTokenHandler creates a personal API token for the logged-in user.
+//
+// @Summary Create an API token
+// @Description Creates a personal API token. The token is only returned in this response.
+// @Description Send it as "Authorization: Bearer <token>" to call the API without a session.
+// @Description The scope is the highest role the token can act as and defaults to the role of the user.
+// @Tags tokens
+// @Accept json
+// @Produce json
+// @Param token body NewToken true "New token"
+// @Success 201 {object} CreatedToken
+// @Failure 400
+// @Failure 403
+// @Failure 500
+// @Router /tokens [post]
+func CreateTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := CurrentUser(r)
+	if user.ViaToken() {
+		http.Error(w, "Tokens can't be created with an API token", http.StatusForbidden)
+		return
+	}
+
+	newToken := NewToken{}
+	if err := json.NewDecoder(r.Body).Decode(&newToken); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newToken.Name = strings.TrimSpace(newToken.Name)
+	if newToken.Name == "" {
+		http.Error(w, "Name can't be empty", http.StatusBadRequest)
+		return
+	}
+	if newToken.Scope == "" {
+		newToken.Scope = user.Role
+	}
+	if !newToken.Scope.Valid() || !user.Role.Allows(newToken.Scope) {
+		http.Error(w, "Scope must be a role not higher than yours", http.StatusBadRequest)
+		return
+	}
+	if newToken.ExpiresInDays < 0 {
+		http.Error(w, "Expiry can't be negative", http.StatusBadRequest)
+		return
+	}
+
+	token := Token{
+		Username:  user.Username,
+		Name:      newToken.Name,
+		Scope:     newToken.Scope,
+		CreatedAt: now(),
+	}
+	if newToken.ExpiresInDays > 0 {
+		expiresAt := token.CreatedAt.AddDate(0, 0, newToken.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	secret := tokenPrefix + utils.GenerateRandomString(tokenLength)
+	token, err := DB.CreateToken(token, hashToken(secret))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to insert token", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s created API token %d for %s", ip, token.ID, user.Username)
+	audit(r, AuditTokenCreated, "token", token.ID, nil, token)
+	utils.WriteJSON(w, http.StatusCreated, CreatedToken{Token: token, Secret: secret})
+}
+
+// DeleteTokenHandler revokes a token of the logged-in user.
+//
+// @Summary Revoke an API token
+// @Description Revokes one of the personal API tokens of the logged-in user.
+// @Tags tokens
+// @Param id path int true "Token ID"
+// @Produce plain
+// @Success 200
+// @Failure 404
+// @Failure 500
+// @Router /tokens/{id} [delete]
+func DeleteTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := CurrentUser(r)
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err == nil {
+		err = DB.DeleteToken(id, user.Username)
+	} else {
+		err = ErrNotFound
+	}
+
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to delete token", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s revoked API token %d of %s", ip, id, user.Username)
+	audit(r, AuditTokenRevoked, "token", id, nil, nil)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parameters of the TOTP codes (RFC 6238). They are the defaults of authenticator apps, some of which ignore
+// any others given in the provisioning URI.
+const (
+	totpIssuer     = "Noticeboard"
+	totpSecretSize = 20
+	totpPeriod     = 30 * time.Second
+	totpDigits     = 6
+	// totpSkew is the number of steps a code is accepted before and after its own, so that the clock of the phone
+	// doesn't have to match the server exactly.
+	totpSkew = 1
+)
+
+const (
+	// recoveryCodeCount is the number of recovery codes given when setting up two-factor authentication.
+	recoveryCodeCount = 10
+	// recoveryCodeLength is the number of characters of a recovery code, shown split in two halves.
+	recoveryCodeLength = 10
+	// recoveryCodeChars leaves out the characters easily mistaken for each other when typed from a printout.
+	recoveryCodeChars = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTP is the two-factor setup of an account.
+type TOTP struct {
+	// Secret is shared with the authenticator app. It's set before the setup is confirmed with a code.
+	Secret  string
+	Enabled bool
+}
+
+// newTOTPSecret returns a random secret encoded in base32, as authenticator apps expect it.
+func newTOTPSecret() (string, error) {
+	b := make([]byte, totpSecretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// totpURI returns the provisioning URI authenticator apps read from a QR code.
+func totpURI(secret, username string) string {
+	label := url.PathEscape(totpIssuer + ":" + username)
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {totpIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(int(totpPeriod.Seconds()))},
+	}
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// totpStep returns the time step the given time falls into.
+func totpStep(at time.Time) int64 {
+	return at.Unix() / int64(totpPeriod.Seconds())
+}
+
+// totpCode returns the code of the given time step (RFC 4226 with the step as the counter).
+func totpCode(key []byte, step int64) string {
+	mac := hmac.New(sha1.New, key)
+	binary.Write(mac, binary.BigEndian, step)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	mod := uint32(1)
+	for range totpDigits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// checkTOTP returns the time step of the code if it's valid around the given time.
+func checkTOTP(secret, code string, at time.Time) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := totpStep(at)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// newRecoveryCodes returns fresh recovery codes to be shown to the user, and the hashes they are stored as.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		for j := range b {
+			// 256 isn't a multiple of the alphabet size, the slight bias doesn't matter with 10 characters
+			b[j] = recoveryCodeChars[int(b[j])%len(recoveryCodeChars)]
+		}
+		code := string(b)
+		codes[i] = code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode returns the form a recovery code is stored in, ignoring how it was typed.
+// Recovery codes are random enough for a plain sha256, like API tokens.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hashToken(code)
+}
@@ -0,0 +1,239 @@
+package db
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// The SHA1 test vectors of RFC 6238, cut down to 6 digits
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(key, totpStep(time.Unix(tt.unix, 0))); got != tt.want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestCheckTOTPSkew(t *testing.T) {
+	key := []byte("12345678901234567890")
+	secret := totpEncoding.EncodeToString(key)
+	at := time.Unix(1234567890, 0)
+	step := totpStep(at)
+
+	for offset := int64(-3); offset <= 3; offset++ {
+		code := totpCode(key, step+offset)
+		got, ok := checkTOTP(strings.ToLower(secret), code[:3]+" "+code[3:], at)
+		want := offset >= -totpSkew && offset <= totpSkew
+		if ok != want || (ok && got != step+offset) {
+			t.Errorf("code of step %+d: step %d, ok %t", offset, got, ok)
+		}
+	}
+	if _, ok := checkTOTP(secret, "", at); ok {
+		t.Error("empty code accepted")
+	}
+}
+
+// enableTestTOTP turns on two-factor authentication for the user and returns the key and the recovery codes.
+func enableTestTOTP(t *testing.T, username string) ([]byte, []string) {
+	t.Helper()
+	secret, err := newTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.SetTOTPSecret(username, secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.EnableTOTP(username, 0, hashes); err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, codes
+}
+
+func TestTOTPStepNotReplayed(t *testing.T) {
+	setupTestStore(t)
+	createTestUser(t, User{Username: "jan", Role: RoleViewer}, "password1")
+	key, _ := enableTestTOTP(t, "jan")
+	totp, err := DB.TOTP("jan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := now()
+	step := totpStep(at)
+
+	for i, want := range []bool{true, false} {
+		ok, recovery, err := checkSecondFactor("jan", totp.Secret, totpCode(key, step), at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != want || recovery {
+			t.Errorf("attempt %d: ok %t, recovery %t, want ok %t", i+1, ok, recovery, want)
+		}
+	}
+	// Nor is an older code, even within the skew
+	if ok, _, _ := checkSecondFactor("jan", totp.Secret, totpCode(key, step-1), at); ok {
+		t.Error("code of an earlier step accepted after a later one")
+	}
+	if ok, _, _ := checkSecondFactor("jan", totp.Secret, totpCode(key, step+1), at); !ok {
+		t.Error("code of the next step refused")
+	}
+}
+
+func TestRecoveryCodeWorksOnce(t *testing.T) {
+	setupTestStore(t)
+	createTestUser(t, User{Username: "jan", Role: RoleViewer}, "password1")
+	_, codes := enableTestTOTP(t, "jan")
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+	totp, err := DB.TOTP("jan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Typed the way people copy them
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	for i, want := range []bool{true, false} {
+		ok, recovery, err := checkSecondFactor("jan", totp.Secret, typed, now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != want || recovery != want {
+			t.Errorf("attempt %d: ok %t, recovery %t, want %t", i+1, ok, recovery, want)
+		}
+	}
+	if left, _ := DB.RecoveryCodesLeft("jan"); left != recoveryCodeCount-1 {
+		t.Errorf("%d recovery codes left, want %d", left, recoveryCodeCount-1)
+	}
+}
+
+func TestPendingLoginExpires(t *testing.T) {
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	session := sessions.NewSession(nil, "auth")
+	session.Values["pendingUser"] = "jan"
+
+	session.Values["pendingSince"] = at.Add(-pendingLoginTimeout + time.Second).Unix()
+	if username, ok := pendingLogin(session, at); !ok || username != "jan" {
+		t.Errorf("recent pending login = %q, %t", username, ok)
+	}
+	session.Values["pendingSince"] = at.Add(-pendingLoginTimeout - time.Second).Unix()
+	if _, ok := pendingLogin(session, at); ok {
+		t.Error("expired pending login accepted")
+	}
+	if _, ok := pendingLogin(sessions.NewSession(nil, "auth"), at); ok {
+		t.Error("session without a pending login accepted")
+	}
+}
+
+func TestLoginWithSecondFactor(t *testing.T) {
+	setupTestStore(t)
+	setupTestSessions(t)
+	createTestUser(t, User{Username: "jan", Role: RoleViewer}, "password1")
+	key, _ := enableTestTOTP(t, "jan")
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"username":"jan","password":"password1"}`))
+	r.Header.Set("Referer", "http://localhost/login?ref=/tokens")
+	LoginMiddleware(SessionHandler)(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Location") != "/login/twofactor?ref=%2Ftokens" {
+		t.Fatalf("password step answered %d, Location %q", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+
+	secondStep := func(code string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/login/twofactor", strings.NewReader(`{"code":"`+code+`"}`))
+		r.Header.Set("Referer", "http://localhost/login/twofactor?ref=%2Ftokens")
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		TwoFactorLoginHandler(w, r)
+		return w
+	}
+	if w := secondStep("000000"); w.Code != http.StatusForbidden {
+		t.Errorf("wrong code answered %d", w.Code)
+	}
+	w = secondStep(totpCode(key, totpStep(now())))
+	if w.Code != http.StatusOK || w.Header().Get("Location") != "/tokens" {
+		t.Fatalf("second step answered %d, Location %q", w.Code, w.Header().Get("Location"))
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/tokens", nil)
+	for _, cookie := range w.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+	session, err := store.Get(r, "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Values["authenticated"] != true || session.Values["username"] != "jan" || session.Values["pendingUser"] != nil {
+		t.Errorf("session after login = %v", session.Values)
+	}
+}
+
+func TestEnforceTwoFactor(t *testing.T) {
+	setupTestStore(t)
+	without := User{Username: "jan", Role: RoleViewer}
+	with := User{Username: "ola", Role: RoleViewer, TwoFactor: true}
+
+	tests := []struct {
+		required bool
+		user     User
+		method   string
+		path     string
+		// want is the status answered by enforceTwoFactor, 0 when it lets the request through.
+		want int
+	}{
+		{false, without, http.MethodGet, "/dashboard", 0},
+		{true, with, http.MethodGet, "/dashboard", 0},
+		{true, without, http.MethodGet, "/dashboard", http.StatusSeeOther},
+		{true, without, http.MethodPost, "/api/reports", http.StatusForbidden},
+		{true, without, http.MethodGet, "/twofactor", 0},
+		{true, without, http.MethodPost, "/api/twofactor/setup", 0},
+		{true, without, http.MethodPost, "/api/twofactor/enable", 0},
+		{true, without, http.MethodPost, "/api/logout", 0},
+	}
+	for _, tt := range tests {
+		if err := DB.SetSetting(requireTwoFactorSetting, strconv.FormatBool(tt.required)); err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		passed := enforceTwoFactor(w, httptest.NewRequest(tt.method, tt.path, nil), tt.user)
+
+		got := 0
+		if !passed {
+			got = w.Code
+		}
+		if got != tt.want {
+			t.Errorf("required %t, 2FA %t, %s %s: got %d, want %d", tt.required, tt.user.TwoFactor, tt.method, tt.path, got, tt.want)
+		}
+		if got == http.StatusSeeOther && w.Header().Get("Location") != "/twofactor" {
+			t.Errorf("redirected to %q, want /twofactor", w.Header().Get("Location"))
+		}
+	}
+}
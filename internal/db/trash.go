@@ -0,0 +1,86 @@
+package db
+
+import (
+	"errors"
+	"example/downdetector/internal/utils"
+	"net/http"
+
+	"github.com/charmbracelet/log"
+)
+
+// ListTrashHandler lists the reports in the trash.
+//
+// @Summary List the reports in the trash
+// @Description Returns the deleted reports which haven't been purged yet, oldest first.
+// @Description Requires the admin role.
+// @Tags reports
+// @Produce json
+// @Success 200 {array} Report
+// @Failure 403
+// @Failure 500
+// @Router /reports/trash [get]
+func ListTrashHandler(w http.ResponseWriter, r *http.Request) {
+	reports, err := DB.TrashedReports()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select reports in the trash", "err", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, reports)
+}
+
+// trashedReport finds the report with the given ID in the trash, so that its restoration can be audited.
+func trashedReport(id uint) (Report, error) {
+	reports, err := DB.TrashedReports()
+	if err != nil {
+		return Report{}, err
+	}
+	for _, report := range reports {
+		if report.ID == id {
+			return report, nil
+		}
+	}
+	return Report{}, ErrNotFound
+}
+
+// RestoreReportHandler brings a report back from the trash.
+//
+// @Summary Restore a deleted report
+// @Description Brings a report back from the trash, as it was when it was deleted.
+// @Description Requires the admin role.
+// @Tags reports
+// @Param id path int true "Report ID"
+// @Produce json
+// @Success 200 {object} Report
+// @Failure 403
+// @Failure 404 "The report isn't in the trash"
+// @Failure 500
+// @Router /reports/{id}/restore [post]
+func RestoreReportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := reportID(r)
+	var before, report Report
+	if err == nil {
+		before, err = trashedReport(id)
+	}
+	if err == nil {
+		user, _ := CurrentUser(r)
+		report, err = DB.RestoreReport(id, user.Username)
+	}
+
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Report not found in the trash", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to restore report", "err", err)
+		return
+	}
+
+	publishReport(EventRestored, report)
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s restored report %d", ip, id)
+	audit(r, AuditReportRestored, "report", id, before, report)
+	utils.WriteJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPurgedReportLeavesOnlyAuditLog(t *testing.T) {
+	setupTestStore(t)
+	service, err := DB.CreateService(Service{Name: "API"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := SubmitReport(NewReport{Title: "Awaria API", Content: "Nie działa logowanie.", Services: []int64{service.ID}}, "jan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := SubmitReport(NewReport{Title: "Awaria poczty", Content: "Nie dochodzą maile."}, "jan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := DB.AddReportUpdate(ReportUpdate{ReportID: report.ID, Author: "jan", Status: UpdateIdentified, Message: "Szukamy przyczyny."}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodDelete, "/api/reports/"+strconv.Itoa(int(report.ID)), nil)
+	r.SetPathValue("id", strconv.Itoa(int(report.ID)))
+	w := httptest.NewRecorder()
+	DeleteReportHandler(w, r.WithContext(context.WithValue(r.Context(), currentUserKey, User{Username: "admin", Role: RoleAdmin})))
+	if w.Code != http.StatusOK {
+		t.Fatalf("deleting the report answered %d: %s", w.Code, w.Body)
+	}
+
+	purged, err := DB.PurgeReports(now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged) != 1 || purged[0].ID != report.ID {
+		t.Fatalf("purged %+v, want only report %d", purged, report.ID)
+	}
+
+	if _, err := DB.Report(report.ID); err != ErrNotFound {
+		t.Errorf("purged report: got %v, want %v", err, ErrNotFound)
+	}
+	events, err := DB.AllReportEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range events {
+		if event.ReportID == report.ID {
+			t.Errorf("history of the purged report left behind: %+v", event)
+		}
+	}
+	if len(events) != 1 || events[0].ReportID != kept.ID {
+		t.Errorf("history = %+v, want only the creation of report %d", events, kept.ID)
+	}
+	s := DB.(*sqlStore)
+	for _, table := range []string{"report_services", "report_updates", "report_events"} {
+		var n int
+		if err := s.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE report_id=?", report.ID).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Errorf("%d rows of the purged report left in %s", n, table)
+		}
+	}
+
+	entries, err := DB.AuditEntries(AuditFilter{TargetType: "report", TargetID: strconv.Itoa(int(report.ID))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != AuditReportDeleted {
+		t.Errorf("audit log of the purged report = %+v, want its deletion", entries)
+	}
+}
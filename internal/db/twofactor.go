@@ -0,0 +1,554 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"example/downdetector/internal/utils"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gorilla/sessions"
+)
+
+// requireTwoFactorSetting is the setting which makes every user set up two-factor authentication.
+const requireTwoFactorSetting = "require_two_factor"
+
+// pendingLoginTimeout is how long the second step of a login can wait after the password was accepted.
+const pendingLoginTimeout = 5 * time.Minute
+
+// TwoFactorCode is the payload carrying a code from the authenticator app, or a recovery code where accepted.
+type TwoFactorCode struct {
+	Code string `json:"code"`
+}
+
+// TwoFactorSetup is returned when starting to set up two-factor authentication.
+type TwoFactorSetup struct {
+	// Secret is shown for typing into the authenticator app when the QR code can't be scanned.
+	Secret string `json:"secret"`
+	// URI is the provisioning URI encoded in the QR code.
+	URI string `json:"uri"`
+}
+
+// RecoveryCodes are returned once after they're generated. They can't be retrieved later.
+type RecoveryCodes struct {
+	Codes []string `json:"codes"`
+}
+
+// TwoFactorPolicy tells whether every user has to set up two-factor authentication.
+type TwoFactorPolicy struct {
+	Required bool `json:"required"`
+}
+
+// TwoFactorRequired reports whether the admins made two-factor authentication mandatory.
+func TwoFactorRequired() (bool, error) {
+	value, err := DB.Setting(requireTwoFactorSetting)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(value)
+}
+
+// twoFactorSetupPaths are what a user who has to set up two-factor authentication can still reach.
+var twoFactorSetupPaths = map[string]bool{
+	"/twofactor":            true,
+	"/api/twofactor/setup":  true,
+	"/api/twofactor/enable": true,
+	"/api/logout":           true,
+}
+
+// enforceTwoFactor sends a user without two-factor authentication to set it up when the admins require it.
+// It returns false when the request was answered.
+func enforceTwoFactor(w http.ResponseWriter, r *http.Request, user User) bool {
+	if user.TwoFactor || twoFactorSetupPaths[r.URL.Path] {
+		return true
+	}
+	required, err := TwoFactorRequired()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to check the two-factor policy", "err", err)
+		return false
+	}
+	if !required {
+		return true
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		http.Error(w, "Two-factor authentication has to be set up first", http.StatusForbidden)
+	} else {
+		http.Redirect(w, r, "/twofactor", http.StatusSeeOther)
+	}
+	return false
+}
+
+// checkSecondFactor checks a code from the authenticator app or an unused recovery code of the user, and uses it up,
+// so that neither works twice. It also reports whether it was a recovery code.
+func checkSecondFactor(username, secret, code string, at time.Time) (ok, recovery bool, err error) {
+	if step, valid := checkTOTP(secret, code, at); valid {
+		err = DB.UseTOTPStep(username, step)
+		if errors.Is(err, ErrNotFound) {
+			// The code was used already
+			return false, false, nil
+		}
+		return err == nil, false, err
+	}
+
+	err = DB.UseRecoveryCode(username, hashRecoveryCode(code), at)
+	if errors.Is(err, ErrNotFound) {
+		return false, false, nil
+	}
+	return err == nil, true, err
+}
+
+// decodeTwoFactorCode reads the code sent with a request, answering it if it can't.
+func decodeTwoFactorCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	payload := TwoFactorCode{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return payload.Code, true
+}
+
+// sessionUser returns the user changing their own two-factor setup, refusing API tokens,
+// so that a leaked token can't turn it off.
+func sessionUser(w http.ResponseWriter, r *http.Request) (User, bool) {
+	user, _ := CurrentUser(r)
+	if user.ViaToken() {
+		http.Error(w, "Two-factor authentication can't be changed with an API token", http.StatusForbidden)
+		return User{}, false
+	}
+	return user, true
+}
+
+// setPendingLogin remembers in the session that the password of username was accepted, without logging in yet,
+// and asks for the second step.
+func setPendingLogin(w http.ResponseWriter, r *http.Request, session *sessions.Session, username string) {
+	session.Options.MaxAge = int(pendingLoginTimeout.Seconds())
+	session.Values["pendingUser"] = username
+	session.Values["pendingSince"] = now().Unix()
+
+	err := session.Save(r, w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to save to session", "err", err)
+		return
+	}
+
+	w.Header().Add("Location", "/login/twofactor?ref="+url.QueryEscape(loginTarget(r)))
+	w.WriteHeader(http.StatusOK)
+}
+
+// pendingLogin returns the user whose password was accepted by the session less than pendingLoginTimeout ago.
+func pendingLogin(session *sessions.Session, at time.Time) (string, bool) {
+	username, _ := session.Values["pendingUser"].(string)
+	since, _ := session.Values["pendingSince"].(int64)
+	if username == "" || at.Sub(time.Unix(since, 0)) > pendingLoginTimeout {
+		return "", false
+	}
+	return username, true
+}
+
+// TwoFactorLoginHandler finishes a login with a code from the authenticator app or a recovery code.
+//
+// @Summary Finish a login with two-factor authentication
+// @Description The second step of logging in as a user with two-factor authentication, within 5 minutes after /login
+// @Description accepted the password and pointed to the page asking for the code.
+// @Description Takes a code from the authenticator app or one of the recovery codes, each of which works only once.
+// @Description Wrong codes count as failed logins, see /login.
+// @Tags user
+// @Accept json
+// @Produce plain
+// @Param code body TwoFactorCode true "Code from the authenticator app or a recovery code"
+// @Success 200
+// @Failure 401 "The password wasn't accepted in the last 5 minutes, log in again"
+// @Failure 403 "Wrong code, or a disabled account"
+// @Failure 429 "Too many failed logins, retry after the number of seconds in the Retry-After header"
+// @Failure 500
+// @Router /login/twofactor [post]
+func TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	code, ok := decodeTwoFactorCode(w, r)
+	if !ok {
+		return
+	}
+
+	session, err := store.Get(r, "auth")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to get session", "err", err)
+		return
+	}
+
+	at := now()
+	username, ok := pendingLogin(session, at)
+	if !ok {
+		http.Error(w, "No login waiting for a second factor, log in again", http.StatusUnauthorized)
+		return
+	}
+	unlock := lockLogin(clientIP(r), username)
+	defer unlock()
+	at = now()
+	if !throttleLogin(w, r, username, at) {
+		return
+	}
+
+	// The account could have been disabled or lost its two-factor setup since the password was accepted
+	user, err := DB.User(username)
+	if err != nil && err != errUserNotFound {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select user from DB", "err", err)
+		return
+	}
+	if err == errUserNotFound || user.Disabled || !user.TwoFactor {
+		rejectLogin(w, r, username, at, AuditLoginFailed)
+		return
+	}
+
+	totp, err := DB.TOTP(username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select two-factor setup", "err", err)
+		return
+	}
+	ok, recovery, err := checkSecondFactor(username, totp.Secret, code, at)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to check second factor", "err", err)
+		return
+	}
+	if !ok {
+		rejectLogin(w, r, username, at, AuditTwoFactorFailed)
+		return
+	}
+
+	if recovery {
+		ip := r.RemoteAddr
+		utils.NoReportLog.Infof("%s used a recovery code of user %s", ip, username)
+		auditAs(r, username, AuditRecoveryCodeUsed, "user", username, nil, nil)
+	}
+	startSession(w, r, session, username)
+}
+
+// SetupTwoFactorHandler starts setting up two-factor authentication for the current user.
+//
+// @Summary Start setting up two-factor authentication
+// @Description Generates a new TOTP secret for the current user and returns it with the provisioning URI to show as a QR code.
+// @Description Two-factor authentication is only turned on by /twofactor/enable, once a code from the authenticator app confirms the setup.
+// @Description Not available with an API token.
+// @Tags user
+// @Produce json
+// @Success 200 {object} TwoFactorSetup
+// @Failure 403
+// @Failure 409 "Two-factor authentication is already enabled"
+// @Failure 500
+// @Router /twofactor/setup [post]
+func SetupTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	if user.TwoFactor {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to generate TOTP secret", "err", err)
+		return
+	}
+	if err := DB.SetTOTPSecret(user.Username, secret); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to save TOTP secret", "err", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, TwoFactorSetup{Secret: secret, URI: totpURI(secret, user.Username)})
+}
+
+// EnableTwoFactorHandler turns on two-factor authentication for the current user.
+//
+// @Summary Enable two-factor authentication
+// @Description Turns on two-factor authentication with the secret from /twofactor/setup, once a code from the authenticator app
+// @Description confirms it was set up right, and returns the recovery codes. They are shown only once.
+// @Description Not available with an API token.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param code body TwoFactorCode true "Code from the authenticator app"
+// @Success 200 {object} RecoveryCodes
+// @Failure 400 "Wrong code, or the setup wasn't started"
+// @Failure 403
+// @Failure 409 "Two-factor authentication is already enabled"
+// @Failure 500
+// @Router /twofactor/enable [post]
+func EnableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	code, ok := decodeTwoFactorCode(w, r)
+	if !ok {
+		return
+	}
+
+	totp, err := DB.TOTP(user.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select two-factor setup", "err", err)
+		return
+	}
+	if totp.Enabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if totp.Secret == "" {
+		http.Error(w, "Two-factor authentication has to be set up first", http.StatusBadRequest)
+		return
+	}
+	step, valid := checkTOTP(totp.Secret, code, now())
+	if !valid {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to generate recovery codes", "err", err)
+		return
+	}
+	if err := DB.EnableTOTP(user.Username, step, hashes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to enable two-factor authentication", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s enabled two-factor authentication", ip)
+	audit(r, AuditTwoFactorEnabled, "user", user.Username, nil, nil)
+	utils.WriteJSON(w, http.StatusOK, RecoveryCodes{Codes: codes})
+}
+
+// DisableTwoFactorHandler turns off two-factor authentication for the current user.
+//
+// @Summary Disable two-factor authentication
+// @Description Turns off two-factor authentication for the current user and forgets the secret and the recovery codes.
+// @Description Takes a code from the authenticator app or a recovery code, so that an unattended session can't do it.
+// @Description Refused while the admins require two-factor authentication. Not available with an API token.
+// @Tags user
+// @Accept json
+// @Produce plain
+// @Param code body TwoFactorCode true "Code from the authenticator app or a recovery code"
+// @Success 200
+// @Failure 400 "Wrong code"
+// @Failure 403
+// @Failure 409 "Two-factor authentication isn't enabled"
+// @Failure 500
+// @Router /twofactor/disable [post]
+func DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	code, ok := decodeTwoFactorCode(w, r)
+	if !ok {
+		return
+	}
+
+	required, err := TwoFactorRequired()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to check the two-factor policy", "err", err)
+		return
+	}
+	if required {
+		http.Error(w, "Two-factor authentication is required for all users", http.StatusForbidden)
+		return
+	}
+
+	if !verifyOwnSecondFactor(w, user, code) {
+		return
+	}
+	if err := DB.DisableTOTP(user.Username); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to disable two-factor authentication", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s disabled two-factor authentication", ip)
+	audit(r, AuditTwoFactorDisabled, "user", user.Username, nil, nil)
+	w.WriteHeader(http.StatusOK)
+}
+
+// RegenerateRecoveryCodesHandler replaces the recovery codes of the current user.
+//
+// @Summary Generate new recovery codes
+// @Description Replaces the recovery codes of the current user with new ones, which are shown only once.
+// @Description Takes a code from the authenticator app or a recovery code. Not available with an API token.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param code body TwoFactorCode true "Code from the authenticator app or a recovery code"
+// @Success 200 {object} RecoveryCodes
+// @Failure 400 "Wrong code"
+// @Failure 403
+// @Failure 409 "Two-factor authentication isn't enabled"
+// @Failure 500
+// @Router /twofactor/recovery-codes [post]
+func RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+	code, ok := decodeTwoFactorCode(w, r)
+	if !ok {
+		return
+	}
+	if !verifyOwnSecondFactor(w, user, code) {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to generate recovery codes", "err", err)
+		return
+	}
+	if err := DB.SetRecoveryCodes(user.Username, hashes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to save recovery codes", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s generated new recovery codes", ip)
+	audit(r, AuditRecoveryCodesGenerated, "user", user.Username, nil, nil)
+	utils.WriteJSON(w, http.StatusOK, RecoveryCodes{Codes: codes})
+}
+
+// verifyOwnSecondFactor checks the code a logged-in user confirms a change of their two-factor setup with.
+// It returns false when the request was answered.
+func verifyOwnSecondFactor(w http.ResponseWriter, user User, code string) bool {
+	if !user.TwoFactor {
+		http.Error(w, "Two-factor authentication isn't enabled", http.StatusConflict)
+		return false
+	}
+
+	totp, err := DB.TOTP(user.Username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select two-factor setup", "err", err)
+		return false
+	}
+	ok, _, err := checkSecondFactor(user.Username, totp.Secret, code, now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to check second factor", "err", err)
+		return false
+	}
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// ResetTwoFactorHandler turns off two-factor authentication of another user, e.g. after they lost their phone.
+//
+// @Summary Reset a user's two-factor authentication
+// @Description Turns off two-factor authentication of an account and forgets its secret and recovery codes,
+// @Description so that the user can log in with the password alone and set it up again. Requires the admin role.
+// @Tags admin
+// @Produce plain
+// @Param username path string true "Username"
+// @Success 200
+// @Failure 403
+// @Failure 404
+// @Failure 500
+// @Router /users/{username}/twofactor [delete]
+func ResetTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+
+	err := DB.DisableTOTP(username)
+	if err == errUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to reset two-factor authentication", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s reset two-factor authentication of user %s", ip, username)
+	audit(r, AuditTwoFactorReset, "user", username, nil, nil)
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetTwoFactorPolicyHandler tells whether two-factor authentication is required.
+//
+// @Summary Get the two-factor policy
+// @Description Tells whether every user has to set up two-factor authentication. Requires the admin role.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} TwoFactorPolicy
+// @Failure 403
+// @Failure 500
+// @Router /twofactor/policy [get]
+func GetTwoFactorPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	required, err := TwoFactorRequired()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to check the two-factor policy", "err", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, TwoFactorPolicy{Required: required})
+}
+
+// UpdateTwoFactorPolicyHandler makes two-factor authentication required or optional.
+//
+// @Summary Change the two-factor policy
+// @Description Makes two-factor authentication required for every user or optional. Requires the admin role.
+// @Description While it's required, users without it can only set it up or log out, and nobody can turn it off for themselves.
+// @Tags admin
+// @Accept json
+// @Produce plain
+// @Param policy body TwoFactorPolicy true "Policy"
+// @Success 200
+// @Failure 400
+// @Failure 403
+// @Failure 500
+// @Router /twofactor/policy [put]
+func UpdateTwoFactorPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	policy := TwoFactorPolicy{}
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	required, err := TwoFactorRequired()
+	if err == nil {
+		err = DB.SetSetting(requireTwoFactorSetting, strconv.FormatBool(policy.Required))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to change the two-factor policy", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s set two-factor authentication required=%t", ip, policy.Required)
+	audit(r, AuditSettingsUpdated, "settings", requireTwoFactorSetting, TwoFactorPolicy{Required: required}, policy)
+	w.WriteHeader(http.StatusOK)
+}
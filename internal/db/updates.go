@@ -0,0 +1,191 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"example/downdetector/internal/broadcast"
+	"example/downdetector/internal/utils"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// UpdateStatus is the stage of an incident announced by an update.
+type UpdateStatus string
+
+const (
+	UpdateInvestigating UpdateStatus = "investigating"
+	UpdateIdentified    UpdateStatus = "identified"
+	UpdateMonitoring    UpdateStatus = "monitoring"
+	// UpdateResolved solves the report, every other status reopens it.
+	UpdateResolved UpdateStatus = "resolved"
+)
+
+// UpdateStatuses lists the stages of an incident in the order they usually happen.
+var UpdateStatuses = []UpdateStatus{UpdateInvestigating, UpdateIdentified, UpdateMonitoring, UpdateResolved}
+
+// UpdateStatusNames are the names of the statuses shown to the public, e.g. in emails.
+var UpdateStatusNames = map[UpdateStatus]string{
+	UpdateInvestigating: "Badanie przyczyny",
+	UpdateIdentified:    "Przyczyna ustalona",
+	UpdateMonitoring:    "Monitorowanie",
+	UpdateResolved:      "Rozwiązane",
+}
+
+// Valid reports whether s is one of the known statuses.
+func (s UpdateStatus) Valid() bool {
+	return slices.Contains(UpdateStatuses, s)
+}
+
+// ReportUpdate is a message posted about the progress of a report. Updates are never changed once posted.
+type ReportUpdate struct {
+	ID       int64 `json:"id"`
+	ReportID uint  `json:"reportId"`
+	// Author is left out of what anyone can read, see Public.
+	Author    string       `json:"author,omitempty"`
+	Status    UpdateStatus `json:"status"`
+	Message   string       `json:"message"`
+	CreatedAt time.Time    `json:"createdAt"`
+}
+
+// Public returns the update as shown on the public API and event stream, without its author.
+func (u ReportUpdate) Public() ReportUpdate {
+	u.Author = ""
+	return u
+}
+
+// NewReportUpdate is the payload used to post an update.
+type NewReportUpdate struct {
+	Status  UpdateStatus `json:"status"`
+	Message string       `json:"message"`
+}
+
+// groupUpdates groups the updates by report ID, keeping their order.
+func groupUpdates(updates []ReportUpdate) map[uint][]ReportUpdate {
+	grouped := map[uint][]ReportUpdate{}
+	for _, update := range updates {
+		grouped[update.ReportID] = append(grouped[update.ReportID], update)
+	}
+	return grouped
+}
+
+// GetAllReportUpdates retrieves the updates of every report, grouped by report ID.
+func GetAllReportUpdates() (map[uint][]ReportUpdate, error) {
+	updates, err := DB.AllReportUpdates()
+	if err != nil {
+		return nil, err
+	}
+	return groupUpdates(updates), nil
+}
+
+// GetOpenReportUpdates retrieves the updates of the reports which aren't solved yet, grouped by report ID.
+func GetOpenReportUpdates() (map[uint][]ReportUpdate, error) {
+	updates, err := DB.OpenReportUpdates()
+	if err != nil {
+		return nil, err
+	}
+	return groupUpdates(updates), nil
+}
+
+// ReportUpdatesHandler returns the updates posted about a report.
+//
+// @Summary List report updates
+// @Description Returns the updates posted about a report, newest first.
+// @Tags reports
+// @Produce json
+// @Param id path int true "Report ID"
+// @Success 200 {array} ReportUpdate
+// @Failure 404
+// @Failure 500
+// @Router /reports/{id}/updates [get]
+func ReportUpdatesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := reportID(r)
+	var updates []ReportUpdate
+	if err == nil {
+		_, err = DB.Report(id)
+	}
+	if err == nil {
+		updates, err = DB.ReportUpdates(id)
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select report updates", "err", err)
+		return
+	}
+	for i, update := range updates {
+		updates[i] = update.Public()
+	}
+
+	utils.WriteJSON(w, http.StatusOK, updates)
+}
+
+// AddReportUpdateHandler posts an update about a report.
+//
+// @Summary Post a report update
+// @Description Appends an update to a report. The resolved status also solves the report, while any other status reopens a solved one.
+// @Tags reports
+// @Accept json
+// @Produce json
+// @Param id path int true "Report ID"
+// @Param update body NewReportUpdate true "Update"
+// @Success 201 {object} ReportUpdate
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /reports/{id}/updates [post]
+func AddReportUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := reportID(r)
+	if err != nil {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	}
+
+	newUpdate := NewReportUpdate{}
+	if err := json.NewDecoder(r.Body).Decode(&newUpdate); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	newUpdate.Message = strings.TrimSpace(newUpdate.Message)
+	if !newUpdate.Status.Valid() {
+		http.Error(w, fmt.Sprintf("status must be one of %v", UpdateStatuses), http.StatusBadRequest)
+		return
+	}
+	if newUpdate.Message == "" {
+		http.Error(w, "message can't be empty", http.StatusBadRequest)
+		return
+	}
+
+	user, _ := CurrentUser(r)
+	update, action, err := DB.AddReportUpdate(ReportUpdate{ReportID: id, Author: user.Username, Status: newUpdate.Status, Message: newUpdate.Message})
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to insert report update", "err", err)
+		return
+	}
+
+	broadcast.Default.Publish(broadcast.Event{Type: broadcast.UpdatePosted, Data: update, Public: update.Public()})
+	if action != "" {
+		if report, err := DB.Report(id); err == nil {
+			event := reportEvent(action, report)
+			event.Cause = update
+			broadcast.Default.Publish(event)
+		}
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s posted update %d to report %d", ip, update.ID, id)
+	audit(r, AuditUpdatePosted, "report", id, nil, update)
+	utils.WriteJSON(w, http.StatusCreated, update)
+}
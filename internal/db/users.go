@@ -4,13 +4,12 @@ import (
 	"example/downdetector/internal/utils"
 
 	"context"
-	"crypto/sha256"
-	"database/sql"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/charmbracelet/log"
@@ -27,22 +26,25 @@ type UserDB struct {
 type UserJSON struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
-	Pepper   string `json:"pepper"` //
 }
 
-var store = sessions.NewCookieStore([]byte(utils.GenerateRandomString(20)))
-
 // @LoginMiddleware authenticates a user using the provided login credentials.
 //
 // @Summary Authenticate user
 // @Description Authenticate a user using their login credentials.
-// @Description Password: sha256(sha256(password + salt) + pepper)
+// @Description The password is sent in plain text, so the app has to be served over TLS.
+// @Description After a few failed logins from the same address or as the same username the next attempt is delayed,
+// @Description twice as long after every further failure, and after 10 failures in a row the username is locked out
+// @Description for an hour unless an admin unlocks it. Unknown usernames are treated the same way as real ones.
+// @Description For users with two-factor authentication the password only starts the login: the Location header points
+// @Description to the page asking for the code, which is sent to /login/twofactor.
 // @Tags user
 // @Accept json
 // @Produce plain
 // @Param user body UserJSON true "User credentials"
 // @Success 200
-// @Failure 403
+// @Failure 403 "Wrong username or password, or a disabled account"
+// @Failure 429 "Too many failed logins, retry after the number of seconds in the Retry-After header"
 // @Failure 500
 // @Router /login [post]
 func LoginMiddleware(f http.HandlerFunc) http.HandlerFunc {
@@ -59,13 +61,19 @@ func LoginMiddleware(f http.HandlerFunc) http.HandlerFunc {
 		req := r.WithContext(context.WithValue(ctx, "user", user))
 		*r = *req
 
-		res := DB.QueryRow("SELECT password FROM users WHERE username=?", user.Username)
-		var hash string
+		// Throttled before the password is checked, so that guessing doesn't go on while blocked
+		unlock := lockLogin(clientIP(r), user.Username)
+		defer unlock()
+		at := now()
+		if !throttleLogin(w, r, user.Username, at) {
+			return
+		}
 
-		err = res.Scan(&hash)
+		creds, err := DB.Credentials(user.Username)
 		if err != nil {
-			if err == sql.ErrNoRows {
-				w.WriteHeader(http.StatusForbidden)
+			if err == errUserNotFound {
+				burnPasswordCheck(user.Password)
+				rejectLogin(w, r, user.Username, at, AuditLoginFailed)
 				return
 			}
 
@@ -74,13 +82,15 @@ func LoginMiddleware(f http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		h := sha256.New()
-		h.Write([]byte(hash + user.Pepper))
-		hashedWithPepper := hex.EncodeToString(h.Sum(nil))
+		ok, err := checkPassword(user.Username, user.Password, creds.Hash, creds.Salt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Error("Failed to check password", "err", err)
+			return
+		}
 
-		// Check if the provided password + salt matches the stored hash + salt
-		if string(hashedWithPepper) != user.Password {
-			w.WriteHeader(http.StatusForbidden)
+		if !ok || creds.Disabled {
+			rejectLogin(w, r, user.Username, at, AuditLoginFailed)
 			return
 		}
 
@@ -89,6 +99,7 @@ func LoginMiddleware(f http.HandlerFunc) http.HandlerFunc {
 }
 
 // SessionHandler creates a session for an authenticated user and redirects them to the referrer URL.
+// Users with two-factor authentication are sent to enter their code first.
 func SessionHandler(w http.ResponseWriter, r *http.Request) {
 	session, err := store.Get(r, "auth")
 	if err != nil {
@@ -96,12 +107,37 @@ func SessionHandler(w http.ResponseWriter, r *http.Request) {
 		log.Error("Failed to get session", "err", err)
 		return
 	}
-	session.Options.MaxAge = 60 * 60 // cookie valid for 1 hour
 
+	username := r.Context().Value("user").(UserJSON).Username
+	user, err := DB.User(username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select user from DB", "err", err)
+		return
+	}
+	if user.TwoFactor {
+		setPendingLogin(w, r, session, username)
+		return
+	}
+
+	startSession(w, r, session, username)
+}
+
+// startSession logs the session in as username once every step of the login succeeded.
+func startSession(w http.ResponseWriter, r *http.Request, session *sessions.Session, username string) {
+	session.Options.MaxAge = int(sessionMaxAge.Seconds())
 	session.Values["authenticated"] = true
-	session.Values["username"] = r.Context().Value("user").(UserJSON).Username
+	session.Values["username"] = username
+	delete(session.Values, "pendingUser")
+	delete(session.Values, "pendingSince")
+	// A new token on every login, so that one seen before logging in is of no use
+	if err := setCSRFToken(w, r, session); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to create CSRF token", "err", err)
+		return
+	}
 
-	err = session.Save(r, w)
+	err := session.Save(r, w)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 
@@ -111,17 +147,51 @@ func SessionHandler(w http.ResponseWriter, r *http.Request) {
 
 	ip := r.RemoteAddr
 	utils.NoReportLog.Infof("New login from %s", ip)
+	auditAs(r, username, AuditLogin, "user", username, nil, nil)
 
-	// Get location from URL, e.g., "/dashboard" from "localhost?ref=/dashboard"
-	referer := strings.Split(strings.Split(r.Referer(), "?")[1], "=")[1]
+	if err := DB.ClearLoginThrottle(ThrottleUser, username); err != nil && !errors.Is(err, ErrNotFound) {
+		log.Error("Failed to clear failed logins", "err", err)
+	}
 
-	w.Header().Add("Location", referer)
+	w.Header().Add("Location", loginTarget(r))
 	w.WriteHeader(http.StatusOK)
 }
 
+// loginTarget returns where to go after logging in, e.g., "/dashboard" from "localhost/login?ref=/dashboard".
+// Only paths of the app are followed, so that a crafted link can't send the user to another site.
+func loginTarget(r *http.Request) string {
+	referer, err := url.Parse(r.Referer())
+	if err != nil {
+		return "/dashboard"
+	}
+	ref := referer.Query().Get("ref")
+	if !strings.HasPrefix(ref, "/") || strings.HasPrefix(ref, "//") || strings.HasPrefix(ref, "/\\") {
+		return "/dashboard"
+	}
+	return ref
+}
+
 // CheckIfUserLoggedIn middleware checks if a user is logged in.
+// Instead of a session cookie the request can carry a personal API token in the "Authorization: Bearer" header.
 func CheckIfUserLoggedIn(f http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := bearerToken(r); ok {
+			user, err := authenticateToken(token)
+			if err == errUserNotFound {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				log.Error("Failed to authenticate token", "err", err)
+				return
+			}
+
+			f(w, withCurrentUser(r, user))
+			return
+		}
+
 		session, err := store.Get(r, "auth")
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -137,13 +207,52 @@ func CheckIfUserLoggedIn(f http.HandlerFunc) http.HandlerFunc {
 		}
 
 		// User is authenticated, proceed with displaying profile
-		_, ok = session.Values["username"].(string)
+		username, ok := session.Values["username"].(string)
 		if !ok {
 			http.Error(w, "Username not found in session", http.StatusInternalServerError)
 			log.Error("User not found in session", "err", err)
 			return
 		}
-		f(w, r)
+
+		// The account could have been renamed or disabled since logging in
+		user, err := DB.User(username)
+		if err != nil && err != errUserNotFound {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Error("Failed to select user from DB", "err", err)
+			return
+		}
+		if err == errUserNotFound || user.Disabled {
+			session.Options.MaxAge = -1
+			session.Save(r, w)
+			sendCSRFToken(w, r, "", -1)
+
+			url := fmt.Sprintf("/login?ref=%s", r.URL)
+			http.Redirect(w, r, url, http.StatusSeeOther)
+			return
+		}
+
+		// Sessions from before CSRF tokens were introduced get one now, and the cookie handing it
+		// to the scripts is sent again in case the browser lost it
+		token, _ := session.Values["csrf"].(string)
+		if token == "" {
+			err = setCSRFToken(w, r, session)
+			if err == nil {
+				err = session.Save(r, w)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				log.Error("Failed to create CSRF token", "err", err)
+				return
+			}
+		} else if cookie, err := r.Cookie(csrfCookie); err != nil || cookie.Value != token {
+			sendCSRFToken(w, r, token, int(sessionMaxAge.Seconds()))
+		}
+
+		if !enforceTwoFactor(w, r, user) {
+			return
+		}
+
+		f(w, withCurrentUser(r, user))
 	}
 }
 
@@ -154,8 +263,9 @@ func CheckIfUserLoggedIn(f http.HandlerFunc) http.HandlerFunc {
 // @Tags user
 // @Produce plain
 // @Success 303
+// @Failure 403
 // @Failure 500
-// @Router /logout [get]
+// @Router /logout [post]
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	session, err := store.Get(r, "auth")
 	if err != nil {
@@ -173,9 +283,12 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 		log.Error("Failed to save to session", "err", err)
 		return
 	}
+	sendCSRFToken(w, r, "", -1)
 
 	ip := r.RemoteAddr
 	utils.NoReportLog.Infof("Logged out from %s", ip)
+	user, _ := CurrentUser(r)
+	audit(r, AuditLogout, "user", user.Username, nil, nil)
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -184,17 +297,19 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 //
 // @Summary Change user password
 // @Description Allows an authenticated user to change their password.
+// @Description The new password is sent in plain text in the password field and hashed by the server.
 // @Tags user
 // @Accept json
 // @Produce plain
-// @Success 303
+// @Param user body UserJSON true "New password"
+// @Success 200
+// @Failure 400
 // @Failure 500
-// @Router /change-password [post]
+// @Router /changepassword [put]
 func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
-	session, err := store.Get(r, "auth")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		log.Error("Failed to get session", "err", err)
+	current, _ := CurrentUser(r)
+	if current.ViaToken() {
+		http.Error(w, "Password can't be changed with an API token", http.StatusForbidden)
 		return
 	}
 
@@ -205,71 +320,32 @@ func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	username := session.Values["username"].(string)
-	newPassword := user.Password
+	if err := validatePassword(user.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	_, err = DB.Exec("UPDATE users set password=? WHERE username=?", newPassword, username)
+	username := current.Username
+	newHash, err := HashPassword(user.Password)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-		log.Error("Failed to marshall user", "err", err)
+		log.Error("Failed to hash password", "err", err)
 		return
 	}
 
-	ip := r.RemoteAddr
-	utils.NoReportLog.Infof("%s changed password", ip)
-
-	w.Header().Add("Location", "/dashboard")
-	w.WriteHeader(http.StatusOK)
-}
-
-// @GetSaltHandler generates and returns a salt.
-//
-// @Summary Get user salt
-// @Description Generates and returns a salt assigned to the user.
-// @Tags user
-// @Produce plain
-// @Success 200 {string} body salt
-// @Router /salt [get]
-func GetSaltHandler(w http.ResponseWriter, r *http.Request) {
-	username := r.Header.Get("username")
-	if username == "" {
-		session, err := store.Get(r, "auth")
-		authenticated, ok := session.Values["authenticated"].(bool)
-
-		if !ok || !authenticated || err != nil {
-			http.Error(w, "No username provided", http.StatusForbidden)
-			return
-		}
-		username = session.Values["username"].(string)
-	}
-	res := DB.QueryRow("SELECT salt FROM users WHERE username=?", username)
-
-	var salt string
-
-	err := res.Scan(&salt)
+	err = DB.SetPassword(username, newHash)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-		log.Error(fmt.Sprintf("Failed to select salt for user %s", username), "err", err)
+		log.Error("Failed to marshall user", "err", err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(salt))
-}
-
-// @GetPepperHandler generates and returns a salt.
-//
-// @Summary Get one time salt
-// @Description Generates and returns a one time salt used to login.
-// @Tags user
-// @Produce plain
-// @Success 200 {string} body pepper
-// @Router /pepper [get]
-func GetPepperHandler(w http.ResponseWriter, r *http.Request) {
-	pepper := utils.GenerateRandomString(5)
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s changed password", ip)
+	audit(r, AuditPasswordChanged, "user", username, nil, nil)
 
+	w.Header().Add("Location", "/dashboard")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(pepper))
 }
 
 // unmarshallUser reads the request body and unmarshals it into a UserJSON string.
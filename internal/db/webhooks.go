@@ -0,0 +1,365 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"example/downdetector/internal/broadcast"
+	"example/downdetector/internal/utils"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// Webhook is a URL the report events are sent to.
+type Webhook struct {
+	ID  int64  `json:"id"`
+	URL string `json:"url"`
+	// Secret signs the payloads, so the receiver can tell they come from us.
+	Secret string `json:"secret"`
+	// Events are the types of events sent to the webhook, every type when empty.
+	Events    []string  `json:"events"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Wants reports whether events of the given type are sent to the webhook.
+func (w Webhook) Wants(eventType string) bool {
+	return !w.Disabled && (len(w.Events) == 0 || slices.Contains(w.Events, eventType))
+}
+
+// NewWebhook is the payload used to create or replace a webhook.
+type NewWebhook struct {
+	URL string `json:"url"`
+	// Secret is generated when a webhook is created without one, and left alone when it's updated without one.
+	Secret   string   `json:"secret"`
+	Events   []string `json:"events"`
+	Disabled bool     `json:"disabled"`
+}
+
+// DeliveryStatus is the state of a webhook delivery.
+type DeliveryStatus string
+
+const (
+	// DeliveryPending is waiting for its next attempt.
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryFailed ran out of attempts.
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// WebhookDelivery is an event sent, or to be sent, to a webhook.
+type WebhookDelivery struct {
+	ID        int64  `json:"id"`
+	WebhookID int64  `json:"webhookId"`
+	Event     string `json:"event"`
+	// Payload is the exact body sent to the webhook.
+	Payload  json.RawMessage `json:"payload" swaggertype:"object"`
+	Status   DeliveryStatus  `json:"status"`
+	Attempts int             `json:"attempts"`
+	// ResponseStatus is the HTTP status of the last attempt, 0 if no response was received.
+	ResponseStatus int `json:"responseStatus"`
+	// Error describes why the last attempt failed.
+	Error         string     `json:"error"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt"`
+	LastAttemptAt *time.Time `json:"lastAttemptAt"`
+}
+
+// deliveriesShown is the number of recent deliveries listed per webhook.
+const deliveriesShown = 50
+
+// webhookSecretLength is the length of generated webhook secrets.
+const webhookSecretLength = 32
+
+// webhookID reads the webhook ID from the request path.
+// IDs which can't be parsed are reported as not found.
+func webhookID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return 0, ErrNotFound
+	}
+	return id, nil
+}
+
+// parseWebhook reads and validates the webhook in the request body.
+func parseWebhook(r *http.Request) (Webhook, error) {
+	newWebhook := NewWebhook{}
+	if err := json.NewDecoder(r.Body).Decode(&newWebhook); err != nil {
+		return Webhook{}, err
+	}
+
+	webhook := Webhook{
+		URL:      strings.TrimSpace(newWebhook.URL),
+		Secret:   strings.TrimSpace(newWebhook.Secret),
+		Events:   []string{},
+		Disabled: newWebhook.Disabled,
+	}
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, errors.New("url must be an absolute http or https URL")
+	}
+	for _, event := range newWebhook.Events {
+		if !slices.Contains(broadcast.Types, event) {
+			return Webhook{}, fmt.Errorf("events must be some of %v", broadcast.Types)
+		}
+		if !slices.Contains(webhook.Events, event) {
+			webhook.Events = append(webhook.Events, event)
+		}
+	}
+	return webhook, nil
+}
+
+// ListWebhooksHandler returns every webhook.
+//
+// @Summary List webhooks
+// @Description Returns every webhook together with its secret. Requires the admin role.
+// @Tags webhooks
+// @Produce json
+// @Success 200 {array} Webhook
+// @Failure 403
+// @Failure 500
+// @Router /webhooks [get]
+func ListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := DB.Webhooks()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select webhooks", "err", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, webhooks)
+}
+
+// CreateWebhookHandler adds a webhook.
+//
+// @Summary Create a webhook
+// @Description Adds a webhook receiving the given types of events, or every type when none are given.
+// @Description Each delivery is a POST with a JSON body signed in the X-Noticeboard-Signature header
+// @Description as "sha256=" followed by the hex HMAC-SHA256 of the body keyed with the secret.
+// @Description A secret is generated when none is given. Requires the admin role.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body NewWebhook true "New webhook"
+// @Success 201 {object} Webhook
+// @Failure 400
+// @Failure 403
+// @Failure 500
+// @Router /webhooks [post]
+func CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, err := parseWebhook(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if webhook.Secret == "" {
+		webhook.Secret = utils.GenerateRandomString(webhookSecretLength)
+	}
+	webhook.CreatedAt = now()
+
+	webhook, err = DB.CreateWebhook(webhook)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to insert webhook", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s created webhook %d %s", ip, webhook.ID, webhook.URL)
+	audit(r, AuditWebhookCreated, "webhook", webhook.ID, nil, auditedWebhook(webhook))
+	w.Header().Set("Location", fmt.Sprintf("/api/webhooks/%d", webhook.ID))
+	utils.WriteJSON(w, http.StatusCreated, webhook)
+}
+
+// UpdateWebhookHandler replaces the settings of a webhook.
+//
+// @Summary Update a webhook
+// @Description Replaces the URL, events and state of a webhook, and its secret if one is given. Requires the admin role.
+// @Tags webhooks
+// @Accept json
+// @Produce plain
+// @Param id path int true "Webhook ID"
+// @Param webhook body NewWebhook true "Webhook"
+// @Success 200
+// @Failure 400
+// @Failure 403
+// @Failure 404
+// @Failure 500
+// @Router /webhooks/{id} [put]
+func UpdateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := webhookID(r)
+	var current Webhook
+	if err == nil {
+		current, err = DB.Webhook(id)
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select webhook", "err", err)
+		return
+	}
+
+	webhook, err := parseWebhook(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	webhook.ID, webhook.CreatedAt = id, current.CreatedAt
+	if webhook.Secret == "" {
+		webhook.Secret = current.Secret
+	}
+
+	err = DB.UpdateWebhook(webhook)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to update webhook", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s updated webhook %d %s", ip, id, webhook.URL)
+	audit(r, AuditWebhookUpdated, "webhook", id, auditedWebhook(current), auditedWebhook(webhook))
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteWebhookHandler removes a webhook.
+//
+// @Summary Delete a webhook
+// @Description Removes a webhook together with its deliveries, including the pending ones. Requires the admin role.
+// @Tags webhooks
+// @Param id path int true "Webhook ID"
+// @Produce plain
+// @Success 200
+// @Failure 403
+// @Failure 404
+// @Failure 500
+// @Router /webhooks/{id} [delete]
+func DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := webhookID(r)
+	var webhook Webhook
+	if err == nil {
+		webhook, err = DB.Webhook(id)
+	}
+	if err == nil {
+		err = DB.DeleteWebhook(id)
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to delete webhook", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s deleted webhook %d", ip, id)
+	audit(r, AuditWebhookDeleted, "webhook", id, auditedWebhook(webhook), nil)
+	w.WriteHeader(http.StatusOK)
+}
+
+// WebhookDeliveriesHandler returns the delivery log of a webhook.
+//
+// @Summary List webhook deliveries
+// @Description Returns the 50 most recent deliveries to a webhook, newest first. Requires the admin role.
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {array} WebhookDelivery
+// @Failure 403
+// @Failure 404
+// @Failure 500
+// @Router /webhooks/{id}/deliveries [get]
+func WebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := webhookID(r)
+	var deliveries []WebhookDelivery
+	if err == nil {
+		_, err = DB.Webhook(id)
+	}
+	if err == nil {
+		deliveries, err = DB.Deliveries(id, deliveriesShown)
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select webhook deliveries", "err", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, deliveries)
+}
+
+// RedeliverHandler sends a past delivery again.
+//
+// @Summary Redeliver a webhook delivery
+// @Description Queues a new delivery with the same event and payload as a past one. It's sent within a few seconds
+// @Description and retried like any other delivery. Requires the admin role.
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param delivery path int true "Delivery ID"
+// @Success 201 {object} WebhookDelivery
+// @Failure 403
+// @Failure 404
+// @Failure 500
+// @Router /webhooks/{id}/deliveries/{delivery}/redeliver [post]
+func RedeliverHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := webhookID(r)
+	deliveryID, parseErr := strconv.ParseInt(r.PathValue("delivery"), 10, 64)
+	if parseErr != nil {
+		err = ErrNotFound
+	}
+	var delivery WebhookDelivery
+	if err == nil {
+		delivery, err = DB.Delivery(deliveryID)
+	}
+	if err == nil && delivery.WebhookID != id {
+		err = ErrNotFound
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to select webhook delivery", "err", err)
+		return
+	}
+
+	createdAt := now()
+	redelivery, err := DB.QueueDelivery(WebhookDelivery{
+		WebhookID:     id,
+		Event:         delivery.Event,
+		Payload:       delivery.Payload,
+		Status:        DeliveryPending,
+		CreatedAt:     createdAt,
+		NextAttemptAt: &createdAt,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to insert webhook delivery", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s redelivered delivery %d of webhook %d as %d", ip, deliveryID, id, redelivery.ID)
+	audit(r, AuditWebhookRedelivered, "webhook", id, nil, nil)
+	utils.WriteJSON(w, http.StatusCreated, redelivery)
+}
@@ -0,0 +1,284 @@
+// Package mail sends emails through an SMTP relay. Messages are queued in memory and sent in the background,
+// failed ones are retried with exponential backoff, and whatever is still queued on shutdown is sent before exiting.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"example/downdetector/internal/config"
+	"example/downdetector/internal/utils"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	// queueSize is the number of messages which can wait to be sent.
+	queueSize = 1000
+	// MaxAttempts is the number of attempts after which a message is given up on.
+	MaxAttempts = 5
+	// firstRetry is the delay before the second attempt, which doubles with every further attempt.
+	firstRetry = 10 * time.Second
+	// retryInterval is how often the messages waiting for a retry are checked.
+	retryInterval = time.Second
+	// timeout limits a whole conversation with the relay.
+	timeout = 30 * time.Second
+)
+
+// ErrQueueFull is returned by Send when too many messages are waiting to be sent.
+var ErrQueueFull = errors.New("mail queue is full")
+
+// Message is a plain text email to a single recipient.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	// Headers are added to the standard ones, e.g. List-Unsubscribe.
+	Headers map[string]string
+}
+
+// pending is a message waiting for its next attempt.
+type pending struct {
+	Message
+	attempts int
+	next     time.Time
+}
+
+// Sender sends messages through the configured relay.
+type Sender struct {
+	addr     string
+	host     string
+	from     *mail.Address
+	auth     smtp.Auth
+	queue    chan Message
+	retries  []pending
+	drainFor time.Duration
+}
+
+// New prepares a sender for the SMTP settings of the configuration, which have to be valid.
+// On shutdown the sender keeps sending the queued messages for at most the shutdown timeout.
+func New(cfg config.Config) (*Sender, error) {
+	host, _, err := net.SplitHostPort(cfg.SMTPAddr)
+	if err != nil {
+		return nil, err
+	}
+	from, err := mail.ParseAddress(cfg.SMTPFrom)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sender{
+		addr:     cfg.SMTPAddr,
+		host:     host,
+		from:     from,
+		queue:    make(chan Message, queueSize),
+		drainFor: cfg.ShutdownTimeout,
+	}
+	if cfg.SMTPUsername != "" {
+		// PlainAuth refuses to send the password unless the connection is encrypted or goes to localhost
+		s.auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, host)
+	}
+	return s, nil
+}
+
+// Send queues the message without waiting for it to be sent.
+func (s *Sender) Send(msg Message) error {
+	select {
+	case s.queue <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Run sends the queued messages until ctx is cancelled, then keeps going until the queue is empty
+// or the shutdown timeout passes.
+func (s *Sender) Run(ctx context.Context) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.drain()
+			return
+		case msg := <-s.queue:
+			s.attempt(pending{Message: msg})
+		case <-ticker.C:
+			s.retryDue(time.Now())
+		}
+	}
+}
+
+// drain sends whatever is still queued, waiting for the retries to be due, until the shutdown timeout passes.
+func (s *Sender) drain() {
+	deadline := time.Now().Add(s.drainFor)
+	for time.Now().Before(deadline) {
+		select {
+		case msg := <-s.queue:
+			s.attempt(pending{Message: msg})
+			continue
+		default:
+		}
+		if len(s.retries) == 0 {
+			return
+		}
+
+		next := deadline
+		for _, p := range s.retries {
+			if p.next.Before(next) {
+				next = p.next
+			}
+		}
+		time.Sleep(time.Until(next))
+		s.retryDue(time.Now())
+	}
+
+	if lost := len(s.queue) + len(s.retries); lost > 0 {
+		log.Error("Failed to send emails before shutdown", "count", lost)
+	}
+}
+
+// retryDue attempts the messages whose retry is due at the given time.
+func (s *Sender) retryDue(at time.Time) {
+	var due []pending
+	s.retries = slices.DeleteFunc(s.retries, func(p pending) bool {
+		if p.next.After(at) {
+			return false
+		}
+		due = append(due, p)
+		return true
+	})
+	for _, p := range due {
+		s.attempt(p)
+	}
+}
+
+// attempt sends the message once and schedules a retry if that fails.
+func (s *Sender) attempt(p pending) {
+	err := s.send(p.Message)
+	if err == nil {
+		return
+	}
+
+	p.attempts++
+	var smtpErr *textproto.Error
+	// 5xx replies are permanent, e.g. an unknown recipient, so retrying wouldn't help
+	if (errors.As(err, &smtpErr) && smtpErr.Code >= 500) || p.attempts >= MaxAttempts {
+		log.Error("Failed to send email", "to", p.To, "attempts", p.attempts, "err", err)
+		return
+	}
+
+	delay := firstRetry << (p.attempts - 1)
+	p.next = time.Now().Add(delay)
+	s.retries = append(s.retries, p)
+	utils.NoReportLog.Warn("Sending email failed, retrying", "to", p.To, "attempts", p.attempts, "in", delay, "err", err)
+}
+
+// send delivers the message to the relay.
+func (s *Sender) send(msg Message) error {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return &textproto.Error{Code: 501, Msg: err.Error()}
+	}
+	data, err := s.compose(msg, to)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", s.addr, timeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return err
+		}
+	}
+	if s.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp relay doesn't support authentication")
+		}
+		if err := c.Auth(s.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// compose renders the message with its headers, encoding the body as quoted-printable UTF-8.
+func (s *Sender) compose(msg Message, to *mail.Address) ([]byte, error) {
+	_, domain, _ := strings.Cut(s.from.Address, "@")
+	headers := map[string]string{
+		"From":                      s.from.String(),
+		"To":                        to.String(),
+		"Subject":                   mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date":                      time.Now().Format(time.RFC1123Z),
+		"Message-ID":                fmt.Sprintf("<%s@%s>", utils.GenerateRandomString(24), domain),
+		"MIME-Version":              "1.0",
+		"Content-Type":              "text/plain; charset=utf-8",
+		"Content-Transfer-Encoding": "quoted-printable",
+	}
+	for name, value := range msg.Headers {
+		headers[name] = value
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, headers[name])
+	}
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	// Line breaks are turned into CRLF by the writer
+	if _, err := qp.Write([]byte(msg.Body)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
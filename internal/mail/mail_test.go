@@ -0,0 +1,211 @@
+package mail
+
+import (
+	"context"
+	"example/downdetector/internal/config"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRelay is a local SMTP server which answers RCPT with the queued replies, accepting once they run out,
+// and keeps the messages it accepted.
+type fakeRelay struct {
+	ln net.Listener
+
+	mu        sync.Mutex
+	replies   []string
+	attempts  int
+	delivered []string
+}
+
+func newFakeRelay(t *testing.T, replies ...string) *fakeRelay {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRelay{ln: ln, replies: replies}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRelay) serve(conn net.Conn) {
+	defer conn.Close()
+	c := textproto.NewConn(conn)
+	c.PrintfLine("220 fake relay")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, _, _ := strings.Cut(strings.ToUpper(line), " ")
+		switch verb {
+		case "EHLO", "HELO":
+			c.PrintfLine("250-fake relay")
+			c.PrintfLine("250 8BITMIME")
+		case "MAIL":
+			c.PrintfLine("250 OK")
+		case "RCPT":
+			c.PrintfLine("%s", r.rcptReply())
+		case "DATA":
+			c.PrintfLine("354 Go ahead")
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			r.mu.Lock()
+			r.delivered = append(r.delivered, string(data))
+			r.mu.Unlock()
+			c.PrintfLine("250 Queued")
+		case "QUIT":
+			c.PrintfLine("221 Bye")
+			return
+		default:
+			c.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+// rcptReply counts the attempt and returns the reply to it.
+func (r *fakeRelay) rcptReply() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts++
+	if len(r.replies) == 0 {
+		return "250 OK"
+	}
+	reply := r.replies[0]
+	r.replies = r.replies[1:]
+	return reply
+}
+
+// results returns the number of attempts and the delivered messages.
+func (r *fakeRelay) results() (int, []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.attempts, append([]string(nil), r.delivered...)
+}
+
+func newTestSender(t *testing.T, relay *fakeRelay) *Sender {
+	s, err := New(config.Config{
+		SMTPAddr:        relay.ln.Addr().String(),
+		SMTPFrom:        "Noticeboard <noreply@example.com>",
+		ShutdownTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+var testMessage = Message{To: "jan@example.com", Subject: "Awaria poczty", Body: "Poczta nie działa."}
+
+func TestMessageDelivered(t *testing.T) {
+	relay := newFakeRelay(t)
+	s := newTestSender(t, relay)
+
+	s.attempt(pending{Message: testMessage})
+
+	attempts, delivered := relay.results()
+	if attempts != 1 || len(delivered) != 1 {
+		t.Fatalf("got %d attempts and %d messages, want 1 of each", attempts, len(delivered))
+	}
+	for _, want := range []string{"To: <jan@example.com>", "Subject: Awaria poczty", "Poczta nie dzia=C5=82a."} {
+		if !strings.Contains(delivered[0], want) {
+			t.Errorf("message doesn't contain %q:\n%s", want, delivered[0])
+		}
+	}
+	if len(s.retries) != 0 {
+		t.Errorf("delivered message scheduled for a retry: %+v", s.retries)
+	}
+}
+
+func TestTemporaryFailureRetried(t *testing.T) {
+	relay := newFakeRelay(t, "451 Try again later")
+	s := newTestSender(t, relay)
+
+	start := time.Now()
+	s.attempt(pending{Message: testMessage})
+	if len(s.retries) != 1 {
+		t.Fatalf("got %d retries, want 1", len(s.retries))
+	}
+	retry := s.retries[0]
+	if retry.attempts != 1 || retry.next.Before(start.Add(firstRetry)) {
+		t.Errorf("retry = %+v, want the second attempt after %s", retry, firstRetry)
+	}
+
+	s.retryDue(retry.next.Add(-time.Second))
+	if attempts, _ := relay.results(); attempts != 1 {
+		t.Fatalf("retried before it was due")
+	}
+
+	s.retryDue(retry.next)
+	attempts, delivered := relay.results()
+	if attempts != 2 || len(delivered) != 1 {
+		t.Fatalf("got %d attempts and %d messages, want 2 attempts delivering 1", attempts, len(delivered))
+	}
+	if len(s.retries) != 0 {
+		t.Errorf("delivered message left for a retry: %+v", s.retries)
+	}
+}
+
+func TestPermanentFailureDropped(t *testing.T) {
+	relay := newFakeRelay(t, "550 No such user")
+	s := newTestSender(t, relay)
+
+	s.attempt(pending{Message: testMessage})
+
+	attempts, delivered := relay.results()
+	if attempts != 1 || len(delivered) != 0 {
+		t.Fatalf("got %d attempts and %d messages, want 1 attempt delivering nothing", attempts, len(delivered))
+	}
+	if len(s.retries) != 0 {
+		t.Errorf("permanently failed message scheduled for a retry: %+v", s.retries)
+	}
+}
+
+func TestQueueDrainedOnShutdown(t *testing.T) {
+	relay := newFakeRelay(t)
+	s := newTestSender(t, relay)
+
+	for range 3 {
+		if err := s.Send(testMessage); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A message which failed before and is due for another attempt
+	s.retries = []pending{{Message: testMessage, attempts: 1, next: time.Now()}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return after the shutdown")
+	}
+
+	if _, delivered := relay.results(); len(delivered) != 4 {
+		t.Errorf("got %d messages delivered on shutdown, want 4", len(delivered))
+	}
+	if len(s.queue) != 0 || len(s.retries) != 0 {
+		t.Errorf("left %d queued and %d retries", len(s.queue), len(s.retries))
+	}
+}
@@ -0,0 +1,92 @@
+// Package maintenance moves the announced maintenance windows along their schedule in the background:
+// a window starts at its start time and completes at its end time, and each change is published like any other event.
+package maintenance
+
+import (
+	"context"
+	"example/downdetector/internal/broadcast"
+	"example/downdetector/internal/db"
+	"example/downdetector/internal/utils"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	// maxSleep limits how long the scheduler waits between checks, in case a change slipped by unnoticed,
+	// e.g. one made by another instance sharing the database.
+	maxSleep = time.Minute
+	// minSleep keeps the scheduler from spinning when a maintenance is due but couldn't be advanced.
+	minSleep = time.Second
+)
+
+// Scheduler starts and completes the maintenance windows on time.
+type Scheduler struct {
+	// wake interrupts the wait when a maintenance is scheduled or edited.
+	wake chan struct{}
+}
+
+// New creates a scheduler.
+func New() *Scheduler {
+	return &Scheduler{wake: make(chan struct{}, 1)}
+}
+
+// Run keeps the maintenance windows up to date until ctx is cancelled.
+// Windows which should have started or completed while the app was down are caught up with right away.
+func (s *Scheduler) Run(ctx context.Context) {
+	stopListening := broadcast.Listen(func(event broadcast.Event) {
+		if event.Type == broadcast.MaintenanceScheduled || event.Type == broadcast.MaintenanceEdited {
+			select {
+			case s.wake <- struct{}{}:
+			default:
+			}
+		}
+	})
+	defer stopListening()
+
+	for {
+		timer := time.NewTimer(s.advance(time.Now().UTC()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		case <-s.wake:
+			timer.Stop()
+		}
+	}
+}
+
+// advance moves the maintenances which are due at the given time to their next status,
+// and returns how long to wait before the next one is due.
+func (s *Scheduler) advance(at time.Time) time.Duration {
+	changed, err := db.DB.AdvanceMaintenances(at)
+	if err != nil {
+		log.Error("Failed to advance maintenances", "err", err)
+		return maxSleep
+	}
+	for _, m := range changed {
+		db.PublishMaintenance(db.MaintenanceEventType(m.Status), m)
+		utils.NoReportLog.Infof("maintenance %d is %s", m.ID, m.Status)
+	}
+
+	maintenances, err := db.DB.Maintenances()
+	if err != nil {
+		log.Error("Failed to select maintenances", "err", err)
+		return maxSleep
+	}
+	sleep := maxSleep
+	for _, m := range maintenances {
+		var next time.Time
+		switch m.Status {
+		case db.MaintenanceScheduled:
+			next = m.StartsAt
+		case db.MaintenanceInProgress:
+			next = m.EndsAt
+		default:
+			continue
+		}
+		sleep = min(sleep, max(next.Sub(at), minSleep))
+	}
+	return sleep
+}
@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"example/downdetector/internal/broadcast"
+	"example/downdetector/internal/db"
+	"example/downdetector/internal/mail"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// subjectPrefix starts the subject of every email, so they're easy to filter.
+const subjectPrefix = "[Downdetector] "
+
+// reportMessage writes the subject and the body of an email about a change to the report.
+// The update is the one which was posted, if any.
+func reportMessage(eventType string, report db.Report, update *db.ReportUpdate, services []db.Service) (string, string) {
+	var subject strings.Builder
+	var body strings.Builder
+	subject.WriteString(subjectPrefix)
+
+	switch eventType {
+	case broadcast.ReportCreated:
+		subject.WriteString("Nowe zgłoszenie: ")
+		body.WriteString("Otwarto nowe zgłoszenie.\n\n")
+	case broadcast.ReportReopened:
+		subject.WriteString("Ponownie otwarte: ")
+		body.WriteString("Zgłoszenie zostało ponownie otwarte.\n\n")
+	case broadcast.ReportSolved:
+		subject.WriteString("Rozwiązane: ")
+		body.WriteString("Zgłoszenie zostało rozwiązane.\n\n")
+	case broadcast.UpdatePosted:
+		if update.Status == db.UpdateResolved {
+			subject.WriteString("Rozwiązane: ")
+		} else {
+			subject.WriteString("Aktualizacja: ")
+		}
+		fmt.Fprintf(&body, "Nowa aktualizacja zgłoszenia – %s:\n%s\n\n", db.UpdateStatusNames[update.Status], update.Message)
+	}
+	subject.WriteString(report.Title)
+
+	fmt.Fprintf(&body, "%s\nWaga: %s\n", report.Title, db.SeverityNames[report.Severity])
+	var names []string
+	for _, service := range services {
+		if report.HasService(service.ID) {
+			names = append(names, service.Name)
+		}
+	}
+	if len(names) > 0 {
+		fmt.Fprintf(&body, "Usługi: %s\n", strings.Join(names, ", "))
+	}
+	if report.Content != "" {
+		fmt.Fprintf(&body, "\n%s\n", report.Content)
+	}
+	fmt.Fprintf(&body, "\nAktualny stan wszystkich usług: %s\n", link("/", nil))
+
+	return subject.String(), body.String()
+}
+
+// confirmationMessage is the email asking the owner of the address to confirm the subscription.
+func confirmationMessage(subscriber db.Subscriber) mail.Message {
+	return mail.Message{
+		To:      subscriber.Email,
+		Subject: subjectPrefix + "Potwierdź subskrypcję",
+		Body: fmt.Sprintf("Ktoś, prawdopodobnie Ty, zapisał ten adres na powiadomienia o zgłoszeniach awarii.\n\n"+
+			"Aby zacząć je otrzymywać, potwierdź subskrypcję: %s\n\n"+
+			"Jeśli to nie Ty, zignoruj tę wiadomość – bez potwierdzenia nic więcej nie wyślemy.\n",
+			link("/subscription/confirm", url.Values{"token": {subscriber.Token}})),
+	}
+}
@@ -0,0 +1,130 @@
+// Package notify emails the subscribers of the public page when reports are opened, updated or solved.
+// Addresses are only mailed once their owners confirm the subscription through a link sent to them,
+// and every email carries a link to unsubscribe.
+package notify
+
+import (
+	"context"
+	"errors"
+	"example/downdetector/internal/broadcast"
+	"example/downdetector/internal/config"
+	"example/downdetector/internal/db"
+	"example/downdetector/internal/mail"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+// sender sends the emails. It's nil when emails are disabled.
+var sender *mail.Sender
+
+// publicURL is the address of the app used in links, without a trailing slash.
+var publicURL string
+
+// Setup prepares sending emails through the relay set in the configuration. Emails stay disabled when there is none.
+func Setup(cfg config.Config) error {
+	sender = nil
+	if cfg.SMTPAddr == "" {
+		return nil
+	}
+
+	s, err := mail.New(cfg)
+	if err != nil {
+		return err
+	}
+	sender, publicURL = s, strings.TrimSuffix(cfg.PublicURL, "/")
+	return nil
+}
+
+// Enabled reports whether emails are sent, so that subscriptions are possible.
+func Enabled() bool {
+	return sender != nil
+}
+
+// Run mails the subscribers about the published events until ctx is cancelled,
+// then sends the emails which are still queued. It must only be called when emails are enabled.
+func Run(ctx context.Context) {
+	stopListening := broadcast.Listen(notifySubscribers)
+	sender.Run(ctx)
+	stopListening()
+}
+
+// notifySubscribers queues an email about the event to every confirmed subscriber.
+// It's called by the broker while the event is published, so it doesn't wait for the emails to be sent.
+func notifySubscribers(event broadcast.Event) {
+	if _, ok := event.Cause.(db.ReportUpdate); ok {
+		// Reports solved or reopened by an update were already announced together with the update
+		return
+	}
+
+	var report db.Report
+	var update *db.ReportUpdate
+	var err error
+	switch data := event.Data.(type) {
+	case db.Report:
+		if event.Type == broadcast.ReportEdited || event.Type == broadcast.ReportDeleted || event.Type == broadcast.ReportRestored {
+			return
+		}
+		report = data
+	case db.ReportUpdate:
+		update = &data
+		report, err = db.DB.Report(data.ReportID)
+	default:
+		return
+	}
+	if errors.Is(err, db.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		log.Error("Failed to select report for notification", "event", event.Type, "err", err)
+		return
+	}
+
+	subscribers, err := db.DB.ConfirmedSubscribers()
+	if err == nil && len(subscribers) == 0 {
+		return
+	}
+	var services []db.Service
+	if err == nil {
+		services, err = db.DB.Services()
+	}
+	if err != nil {
+		log.Error("Failed to select subscribers", "event", event.Type, "err", err)
+		return
+	}
+
+	subject, body := reportMessage(event.Type, report, update, services)
+	for _, subscriber := range subscribers {
+		if err := sender.Send(withUnsubscribe(mail.Message{To: subscriber.Email, Subject: subject, Body: body}, subscriber)); err != nil {
+			log.Error("Failed to queue notification", "event", event.Type, "err", err)
+			return
+		}
+	}
+}
+
+// link returns the absolute address of the path.
+func link(path string, query url.Values) string {
+	if len(query) == 0 {
+		return publicURL + path
+	}
+	return publicURL + path + "?" + query.Encode()
+}
+
+// unsubscribeLink returns the address of the page cancelling the subscription.
+func unsubscribeLink(subscriber db.Subscriber) string {
+	return link("/subscription/unsubscribe", url.Values{"token": {subscriber.Token}})
+}
+
+// withUnsubscribe adds the unsubscribe link to the body and the headers of the message,
+// the latter letting mail clients unsubscribe with a single click.
+func withUnsubscribe(msg mail.Message, subscriber db.Subscriber) mail.Message {
+	msg.Body += fmt.Sprintf("\n\n--\nOtrzymujesz tę wiadomość, bo subskrybujesz powiadomienia o zgłoszeniach.\nAby zrezygnować, otwórz: %s\n",
+		unsubscribeLink(subscriber))
+	msg.Headers = map[string]string{
+		"List-Unsubscribe":      "<" + link("/api/subscribers/unsubscribe", url.Values{"token": {subscriber.Token}}) + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+	return msg
+}
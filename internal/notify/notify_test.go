@@ -0,0 +1,231 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"example/downdetector/internal/broadcast"
+	"example/downdetector/internal/config"
+	"example/downdetector/internal/db"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// email is a message received by the relay.
+type email struct {
+	subject, body string
+}
+
+// relay is a local SMTP server which accepts every message.
+type relay struct {
+	ln net.Listener
+
+	mu     sync.Mutex
+	emails []email
+}
+
+func newRelay(t *testing.T) *relay {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &relay{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(t, conn)
+		}
+	}()
+	return r
+}
+
+func (r *relay) serve(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	c := textproto.NewConn(conn)
+	c.PrintfLine("220 relay")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, _, _ := strings.Cut(strings.ToUpper(line), " ")
+		switch verb {
+		case "EHLO", "HELO":
+			c.PrintfLine("250-relay")
+			c.PrintfLine("250 8BITMIME")
+		case "MAIL", "RCPT":
+			c.PrintfLine("250 OK")
+		case "DATA":
+			c.PrintfLine("354 Go ahead")
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg, err := decodeEmail(string(data))
+			if err != nil {
+				t.Errorf("relay got an invalid message: %v", err)
+			}
+			r.mu.Lock()
+			r.emails = append(r.emails, msg)
+			r.mu.Unlock()
+			c.PrintfLine("250 Queued")
+		case "QUIT":
+			c.PrintfLine("221 Bye")
+			return
+		default:
+			c.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+// decodeEmail decodes the subject and the body of the message.
+func decodeEmail(data string) (email, error) {
+	tp := textproto.NewReader(bufio.NewReader(strings.NewReader(data)))
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return email{}, err
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if err != nil {
+		return email{}, err
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(tp.R))
+	return email{subject: subject, body: string(body)}, err
+}
+
+// setup connects notify to an empty in-memory store with a confirmed subscriber, and to the relay.
+// It returns a function which sends the queued emails and returns all the relay received.
+func setup(t *testing.T) func() []email {
+	t.Helper()
+	if err := db.Open(config.Config{DBDriver: config.DriverMemory}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DB.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+	subscriber, err := db.DB.CreateSubscriber(db.Subscriber{Email: "jan@example.com", Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DB.ConfirmSubscriber(subscriber.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newRelay(t)
+	if err := Setup(config.Config{SMTPAddr: r.ln.Addr().String(), SMTPFrom: "noreply@example.com", PublicURL: "http://localhost", ShutdownTimeout: 5 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sender = nil })
+	stopListening := broadcast.Listen(notifySubscribers)
+	t.Cleanup(stopListening)
+
+	return func() []email {
+		stopListening()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		sender.Run(ctx)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.emails
+	}
+}
+
+// postUpdate posts an update to the report the way the dashboard does.
+func postUpdate(t *testing.T, id uint, status db.UpdateStatus, message string) {
+	t.Helper()
+	body := `{"status":"` + string(status) + `","message":"` + message + `"}`
+	r := httptest.NewRequest(http.MethodPost, "/api/reports/"+strconv.Itoa(int(id))+"/updates", strings.NewReader(body))
+	r.SetPathValue("id", strconv.Itoa(int(id)))
+	w := httptest.NewRecorder()
+	db.AddReportUpdateHandler(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("posting the update answered %d: %s", w.Code, w.Body)
+	}
+}
+
+// editReport solves or reopens the report from the dashboard.
+func editReport(t *testing.T, report db.Report, solved bool) {
+	t.Helper()
+	var body strings.Builder
+	form := multipart.NewWriter(&body)
+	form.WriteField("title", report.Title)
+	form.WriteField("content", report.Content)
+	if solved {
+		form.WriteField("isSolved", "on")
+	}
+	form.Close()
+	r := httptest.NewRequest(http.MethodPut, "/api/reports/"+strconv.Itoa(int(report.ID)), strings.NewReader(body.String()))
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	r.SetPathValue("id", strconv.Itoa(int(report.ID)))
+	w := httptest.NewRecorder()
+	db.EditReportHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("editing the report answered %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestSolvedByUpdateAnnouncedOnce(t *testing.T) {
+	sent := setup(t)
+	report, err := db.SubmitReport(db.NewReport{Title: "Awaria API", Content: "Nie działa logowanie."}, "jan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postUpdate(t, report.ID, db.UpdateResolved, "Naprawione.")
+	// Changed from the dashboard within the same second, which the update's time doesn't tell apart
+	editReport(t, report, false)
+	editReport(t, report, true)
+
+	want := []struct {
+		subject, body string
+	}{
+		{"[Downdetector] Nowe zgłoszenie: Awaria API", "Otwarto nowe zgłoszenie."},
+		{"[Downdetector] Rozwiązane: Awaria API", "Naprawione."},
+		{"[Downdetector] Ponownie otwarte: Awaria API", "Zgłoszenie zostało ponownie otwarte."},
+		{"[Downdetector] Rozwiązane: Awaria API", "Zgłoszenie zostało rozwiązane."},
+	}
+	emails := sent()
+	if len(emails) != len(want) {
+		t.Fatalf("got %d emails, want %d: %+v", len(emails), len(want), emails)
+	}
+	for i, w := range want {
+		if emails[i].subject != w.subject || !strings.Contains(emails[i].body, w.body) {
+			t.Errorf("email %d = %q, want %q containing %q:\n%s", i+1, emails[i].subject, w.subject, w.body, emails[i].body)
+		}
+	}
+}
+
+func TestReopenedByUpdateAnnouncedOnce(t *testing.T) {
+	sent := setup(t)
+	report, err := db.SubmitReport(db.NewReport{Title: "Awaria API", Content: "Nie działa logowanie."}, "jan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	editReport(t, report, true)
+	postUpdate(t, report.ID, db.UpdateInvestigating, "Znowu nie działa.")
+
+	emails := sent()
+	if len(emails) != 3 {
+		t.Fatalf("got %d emails, want 3: %+v", len(emails), emails)
+	}
+	if got := emails[2]; got.subject != "[Downdetector] Aktualizacja: Awaria API" || !strings.Contains(got.body, "Znowu nie działa.") {
+		t.Errorf("email about the update = %q:\n%s", got.subject, got.body)
+	}
+}
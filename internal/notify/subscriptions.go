@@ -0,0 +1,184 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"example/downdetector/internal/db"
+	"example/downdetector/internal/utils"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// tokenLength is the length of the tokens in the confirmation and unsubscribe links.
+const tokenLength = 32
+
+// resendAfter is how long an unconfirmed subscriber waits before the confirmation can be sent again,
+// so that the form can't be used to flood someone's mailbox.
+const resendAfter = 10 * time.Minute
+
+// NewSubscription is the payload used to subscribe.
+type NewSubscription struct {
+	Email string `json:"email"`
+}
+
+// now returns the current time as stored in the database.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// parseEmail validates the address and returns it in the form it's stored in.
+func parseEmail(email string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || addr.Name != "" || len(addr.Address) > 254 {
+		return "", errors.New("email must be a plain email address")
+	}
+	return strings.ToLower(addr.Address), nil
+}
+
+// subscribe adds the address, or finds the unconfirmed subscriber it belongs to, and sends it the confirmation.
+// Nothing is sent to confirmed subscribers, nor to ones which got the confirmation recently.
+func subscribe(email string) error {
+	subscriber, err := db.DB.SubscriberByEmail(email)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		t := now()
+		subscriber, err = db.DB.CreateSubscriber(db.Subscriber{
+			Email:              email,
+			Token:              utils.GenerateRandomString(tokenLength),
+			CreatedAt:          t,
+			ConfirmationSentAt: t,
+		})
+		if err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case subscriber.Confirmed() || time.Since(subscriber.ConfirmationSentAt) < resendAfter:
+		return nil
+	default:
+		if err := db.DB.TouchConfirmationSent(subscriber.ID, now()); err != nil {
+			return err
+		}
+	}
+
+	return sender.Send(confirmationMessage(subscriber))
+}
+
+// SubscribeHandler subscribes an email address to the notifications.
+//
+// @Summary Subscribe to notifications
+// @Description Sends a link confirming the subscription to the address. Nothing else is sent before it's opened.
+// @Description The response is the same whether the address is new, unconfirmed or already subscribed,
+// @Description and the confirmation is sent again at most every 10 minutes.
+// @Tags subscribers
+// @Accept json
+// @Produce plain
+// @Param subscription body NewSubscription true "Email address"
+// @Success 202
+// @Failure 400
+// @Failure 404 "Emails are disabled"
+// @Failure 500
+// @Router /subscribers [post]
+func SubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	if !Enabled() {
+		http.Error(w, "Email notifications are disabled", http.StatusNotFound)
+		return
+	}
+
+	subscription := NewSubscription{}
+	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	email, err := parseEmail(subscription.Email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := subscribe(email); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to subscribe", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s subscribed %s", ip, email)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// subscriberByToken finds the subscriber the token in the query belongs to.
+func subscriberByToken(r *http.Request) (db.Subscriber, error) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		return db.Subscriber{}, db.ErrNotFound
+	}
+	return db.DB.SubscriberByToken(token)
+}
+
+// ConfirmSubscriptionHandler starts sending the notifications to a subscriber.
+//
+// @Summary Confirm a subscription
+// @Description Confirms the subscription with the token from the link sent to the address. Confirming it again does nothing.
+// @Tags subscribers
+// @Produce plain
+// @Param token query string true "Token from the confirmation link"
+// @Success 200
+// @Failure 404
+// @Failure 500
+// @Router /subscribers/confirm [post]
+func ConfirmSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	subscriber, err := subscriberByToken(r)
+	if err == nil && !subscriber.Confirmed() {
+		err = db.DB.ConfirmSubscriber(subscriber.ID, now())
+	}
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to confirm subscription", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s confirmed subscription of %s", ip, subscriber.Email)
+	w.WriteHeader(http.StatusOK)
+}
+
+// UnsubscribeHandler stops sending the notifications to a subscriber and forgets the address.
+//
+// @Summary Unsubscribe from notifications
+// @Description Removes the subscriber the token belongs to. It's also the one-click unsubscribe address
+// @Description given to mail clients in the List-Unsubscribe header of every notification.
+// @Tags subscribers
+// @Produce plain
+// @Param token query string true "Token from the unsubscribe link"
+// @Success 200
+// @Failure 404
+// @Failure 500
+// @Router /subscribers/unsubscribe [post]
+func UnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	subscriber, err := subscriberByToken(r)
+	if err == nil {
+		err = db.DB.DeleteSubscriber(subscriber.ID)
+	}
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to unsubscribe", "err", err)
+		return
+	}
+
+	ip := r.RemoteAddr
+	utils.NoReportLog.Infof("%s unsubscribed %s", ip, subscriber.Email)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,322 @@
+// Package stats computes downtime and incident statistics from the history of the reports.
+// Every period a report stays open is an incident, so a reopened report counts again, and the time covered
+// by at least one incident is downtime. Maintenance reports announce planned work, so they're left out.
+package stats
+
+import (
+	"example/downdetector/internal/db"
+	"example/downdetector/internal/utils"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// Window is a period ending now which the statistics are computed over.
+type Window struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Windows are the periods the statistics are computed over.
+var Windows = []Window{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+	{"90d", 90 * 24 * time.Hour},
+}
+
+// HistoryDays is the number of days in the daily history, today included.
+const HistoryDays = 90
+
+// WindowStats are the statistics of a single window.
+type WindowStats struct {
+	Window string `json:"window"`
+	// DowntimeSeconds is how long at least one incident was open during the window.
+	DowntimeSeconds int64   `json:"downtimeSeconds"`
+	DowntimePercent float64 `json:"downtimePercent"`
+	UptimePercent   float64 `json:"uptimePercent"`
+	// Incidents is the number of incidents which started during the window.
+	Incidents int `json:"incidents"`
+	// MTTRSeconds is the mean time to recovery of the incidents solved during the window, 0 if none were.
+	MTTRSeconds int64 `json:"mttrSeconds"`
+}
+
+// Day is a single day of the history, in the time zone of the server.
+type Day struct {
+	// Date is formatted as YYYY-MM-DD.
+	Date            string `json:"date"`
+	DowntimeSeconds int64  `json:"downtimeSeconds"`
+	// Incidents is the number of incidents which started that day.
+	Incidents int `json:"incidents"`
+}
+
+// Summary are the statistics of the whole app or of a single service.
+type Summary struct {
+	Windows []WindowStats `json:"windows"`
+	// Days is the daily history, oldest first.
+	Days []Day `json:"days"`
+}
+
+// ServiceStats are the statistics of the incidents attached to a service.
+type ServiceStats struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Summary
+}
+
+// Stats are the statistics of every incident and of each service.
+type Stats struct {
+	GeneratedAt time.Time      `json:"generatedAt"`
+	Overall     Summary        `json:"overall"`
+	Services    []ServiceStats `json:"services"`
+}
+
+// Service returns the statistics of the service with the given ID.
+func (s Stats) Service(id int64) (ServiceStats, bool) {
+	for _, service := range s.Services {
+		if service.ID == id {
+			return service, true
+		}
+	}
+	return ServiceStats{}, false
+}
+
+// interval is the time an incident stayed open. Incidents which are still open end now and aren't solved.
+type interval struct {
+	start, end time.Time
+	solved     bool
+}
+
+// intervals finds the incidents of a report in its history. Reports from before the history was kept
+// fall back to their timestamps, and are skipped when those are missing too.
+func intervals(report db.Report, events []db.ReportEvent, now time.Time) []interval {
+	if len(events) == 0 {
+		if report.CreatedAt == nil {
+			return nil
+		}
+		if !report.IsSolved {
+			return []interval{{start: *report.CreatedAt, end: now}}
+		}
+		if report.ResolvedAt == nil {
+			return nil
+		}
+		return []interval{{start: *report.CreatedAt, end: *report.ResolvedAt, solved: true}}
+	}
+
+	var found []interval
+	var open *time.Time
+	for _, event := range events {
+		switch {
+		case !event.IsSolved && open == nil:
+			open = &event.CreatedAt
+		case event.IsSolved && open != nil:
+			found = append(found, interval{start: *open, end: event.CreatedAt, solved: true})
+			open = nil
+		}
+	}
+	if open != nil {
+		found = append(found, interval{start: *open, end: now})
+	}
+	return found
+}
+
+// merge joins the overlapping intervals, so that no moment of downtime is counted twice.
+func merge(intervals []interval) []interval {
+	sorted := slices.Clone(intervals)
+	slices.SortFunc(sorted, func(a, b interval) int { return a.start.Compare(b.start) })
+
+	var merged []interval
+	for _, i := range sorted {
+		if n := len(merged); n > 0 && !i.start.After(merged[n-1].end) {
+			if i.end.After(merged[n-1].end) {
+				merged[n-1].end = i.end
+			}
+			continue
+		}
+		merged = append(merged, i)
+	}
+	return merged
+}
+
+// overlap returns how much of the merged intervals falls between from and to.
+func overlap(merged []interval, from, to time.Time) time.Duration {
+	var total time.Duration
+	for _, i := range merged {
+		start, end := i.start, i.end
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if end.After(start) {
+			total += end.Sub(start)
+		}
+	}
+	return total
+}
+
+// summarize computes the statistics of the incidents.
+func summarize(incidents []interval, now time.Time) Summary {
+	merged := merge(incidents)
+	summary := Summary{}
+
+	for _, window := range Windows {
+		from := now.Add(-window.Duration)
+		downtime := overlap(merged, from, now)
+		stats := WindowStats{
+			Window:          window.Name,
+			DowntimeSeconds: int64(downtime.Seconds()),
+			DowntimePercent: 100 * downtime.Seconds() / window.Duration.Seconds(),
+		}
+		stats.UptimePercent = 100 - stats.DowntimePercent
+
+		var repairs time.Duration
+		solved := 0
+		for _, i := range incidents {
+			if !i.start.Before(from) {
+				stats.Incidents++
+			}
+			if i.solved && !i.end.Before(from) {
+				repairs += i.end.Sub(i.start)
+				solved++
+			}
+		}
+		if solved > 0 {
+			stats.MTTRSeconds = int64((repairs / time.Duration(solved)).Seconds())
+		}
+		summary.Windows = append(summary.Windows, stats)
+	}
+
+	local := now.Local()
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+	for n := HistoryDays - 1; n >= 0; n-- {
+		// AddDate rather than 24 hours, so that days changing the clocks stay whole
+		from := today.AddDate(0, 0, -n)
+		to := from.AddDate(0, 0, 1)
+		if to.After(now) {
+			to = now
+		}
+		day := Day{Date: from.Format("2006-01-02"), DowntimeSeconds: int64(overlap(merged, from, to).Seconds())}
+		for _, i := range incidents {
+			if !i.start.Before(from) && i.start.Before(to) {
+				day.Incidents++
+			}
+		}
+		summary.Days = append(summary.Days, day)
+	}
+
+	return summary
+}
+
+// Compute works out the statistics at the given time from the reports, their history and the services.
+func Compute(reports []db.Report, events []db.ReportEvent, services []db.Service, now time.Time) Stats {
+	history := map[uint][]db.ReportEvent{}
+	for _, event := range events {
+		history[event.ReportID] = append(history[event.ReportID], event)
+	}
+
+	var all []interval
+	byService := map[int64][]interval{}
+	for _, report := range reports {
+		if report.Severity == db.SeverityMaintenance {
+			continue
+		}
+		found := intervals(report, history[report.ID], now)
+		all = append(all, found...)
+		for _, id := range report.ServiceIDs {
+			byService[id] = append(byService[id], found...)
+		}
+	}
+
+	stats := Stats{GeneratedAt: now, Overall: summarize(all, now), Services: []ServiceStats{}}
+	for _, service := range services {
+		stats.Services = append(stats.Services, ServiceStats{ID: service.ID, Name: service.Name, Summary: summarize(byService[service.ID], now)})
+	}
+	return stats
+}
+
+// Load computes the current statistics from the database. Deleted reports are left out.
+func Load() (Stats, error) {
+	reports, err := db.DB.AllReports()
+	if err != nil {
+		return Stats{}, err
+	}
+	events, err := db.DB.AllReportEvents()
+	if err != nil {
+		return Stats{}, err
+	}
+	services, err := db.DB.Services()
+	if err != nil {
+		return Stats{}, err
+	}
+	return Compute(reports, events, services, time.Now().UTC().Truncate(time.Second)), nil
+}
+
+// Level tells how bad the day was, as the Bootstrap color of its bar: success, warning or danger.
+func (d Day) Level() string {
+	switch {
+	case d.DowntimeSeconds == 0:
+		return "success"
+	case d.DowntimeSeconds < 60*60:
+		return "warning"
+	default:
+		return "danger"
+	}
+}
+
+// Description describes the day in a few words shown to the public.
+func (d Day) Description() string {
+	if d.DowntimeSeconds == 0 {
+		return d.Date + ": brak awarii"
+	}
+	return fmt.Sprintf("%s: przestój %s, nowe zgłoszenia: %d", d.Date, formatDuration(d.DowntimeSeconds), d.Incidents)
+}
+
+// Window returns the statistics of the window with the given name, e.g. "90d".
+func (s Summary) Window(name string) WindowStats {
+	for _, window := range s.Windows {
+		if window.Window == name {
+			return window
+		}
+	}
+	return WindowStats{}
+}
+
+// formatDuration writes a number of seconds as hours and minutes.
+func formatDuration(seconds int64) string {
+	hours, minutes := seconds/3600, seconds%3600/60
+	switch {
+	case hours > 0:
+		return fmt.Sprintf("%d godz. %d min", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%d min", minutes)
+	default:
+		return "poniżej minuty"
+	}
+}
+
+// StatsHandler returns the downtime and incident statistics.
+//
+// @Summary Get downtime statistics
+// @Description Returns the downtime, uptime, number of incidents and mean time to recovery over the last 24 hours,
+// @Description 7, 30 and 90 days, together with the daily history of the last 90 days, for all incidents and for each service.
+// @Description Every period a report stays open is an incident, and maintenance reports aren't counted.
+// @Tags stats
+// @Produce json
+// @Success 200 {object} Stats
+// @Failure 500
+// @Router /stats [get]
+func StatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := Load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error("Failed to compute statistics", "err", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,265 @@
+package stats
+
+import (
+	"example/downdetector/internal/db"
+	"slices"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// now is the fixed time the statistics are computed at.
+var now = time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+
+// ago returns the time d before now.
+func ago(d time.Duration) time.Time {
+	return now.Add(-d)
+}
+
+// event is a change of report id at the given time, leaving it solved or open.
+func event(id uint, at time.Time, action db.EventAction, solved bool) db.ReportEvent {
+	return db.ReportEvent{ReportID: id, Action: action, IsSolved: solved, CreatedAt: at}
+}
+
+// useLocal sets the time zone of the server for the test.
+func useLocal(t *testing.T, name string) {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := time.Local
+	time.Local = loc
+	t.Cleanup(func() { time.Local = local })
+}
+
+func TestIntervals(t *testing.T) {
+	created, resolved := ago(3*time.Hour), ago(time.Hour)
+
+	tests := []struct {
+		name   string
+		report db.Report
+		events []db.ReportEvent
+		want   []interval
+	}{
+		{
+			name:   "open without history",
+			report: db.Report{CreatedAt: &created},
+			want:   []interval{{start: created, end: now}},
+		},
+		{
+			name:   "solved without history",
+			report: db.Report{CreatedAt: &created, IsSolved: true, ResolvedAt: &resolved},
+			want:   []interval{{start: created, end: resolved, solved: true}},
+		},
+		{
+			name:   "no timestamps",
+			report: db.Report{IsSolved: true},
+		},
+		{
+			name:   "solved without the time",
+			report: db.Report{CreatedAt: &created, IsSolved: true},
+		},
+		{
+			name:   "solved",
+			report: db.Report{CreatedAt: &created, IsSolved: true, ResolvedAt: &resolved},
+			events: []db.ReportEvent{
+				event(1, created, db.EventCreated, false),
+				event(1, ago(2*time.Hour), db.EventEdited, false),
+				event(1, resolved, db.EventSolved, true),
+				event(1, ago(time.Minute), db.EventEdited, true),
+			},
+			want: []interval{{start: created, end: resolved, solved: true}},
+		},
+		{
+			name:   "reopened and still open",
+			report: db.Report{CreatedAt: &created},
+			events: []db.ReportEvent{
+				event(1, created, db.EventCreated, false),
+				event(1, ago(2*time.Hour), db.EventSolved, true),
+				event(1, resolved, db.EventReopened, false),
+			},
+			want: []interval{{start: created, end: ago(2 * time.Hour), solved: true}, {start: resolved, end: now}},
+		},
+		{
+			name:   "reopened and solved again",
+			report: db.Report{CreatedAt: &created, IsSolved: true},
+			events: []db.ReportEvent{
+				event(1, created, db.EventCreated, false),
+				event(1, ago(2*time.Hour), db.EventSolved, true),
+				event(1, resolved, db.EventReopened, false),
+				event(1, ago(time.Minute), db.EventSolved, true),
+			},
+			want: []interval{{start: created, end: ago(2 * time.Hour), solved: true}, {start: resolved, end: ago(time.Minute), solved: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := intervals(tt.report, tt.events, now); !slices.Equal(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []interval
+		want []interval
+	}{
+		{"none", nil, nil},
+		{
+			"apart",
+			[]interval{{start: ago(2 * time.Hour), end: ago(time.Hour)}, {start: ago(5 * time.Hour), end: ago(4 * time.Hour)}},
+			[]interval{{start: ago(5 * time.Hour), end: ago(4 * time.Hour)}, {start: ago(2 * time.Hour), end: ago(time.Hour)}},
+		},
+		{
+			"overlapping",
+			[]interval{{start: ago(5 * time.Hour), end: ago(3 * time.Hour)}, {start: ago(4 * time.Hour), end: ago(time.Hour)}},
+			[]interval{{start: ago(5 * time.Hour), end: ago(time.Hour)}},
+		},
+		{
+			"touching",
+			[]interval{{start: ago(2 * time.Hour), end: ago(time.Hour)}, {start: ago(3 * time.Hour), end: ago(2 * time.Hour)}},
+			[]interval{{start: ago(3 * time.Hour), end: ago(time.Hour)}},
+		},
+		{
+			"contained",
+			[]interval{{start: ago(5 * time.Hour), end: now}, {start: ago(3 * time.Hour), end: ago(2 * time.Hour)}},
+			[]interval{{start: ago(5 * time.Hour), end: now}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := merge(tt.in); !slices.Equal(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompute(t *testing.T) {
+	useLocal(t, "UTC")
+	oldCreated, oldResolved := ago(10*24*time.Hour), ago(10*24*time.Hour-2*time.Hour)
+	reports := []db.Report{
+		// Open from 5 to 3 hours ago and again for the last 2 hours
+		{ID: 1, Severity: db.SeverityMajor, ServiceIDs: []int64{1}},
+		// Open from 4 hours to an hour ago, overlapping the first one
+		{ID: 2, Severity: db.SeverityMinor, ServiceIDs: []int64{2}},
+		// Planned work isn't downtime
+		{ID: 3, Severity: db.SeverityMaintenance, ServiceIDs: []int64{1}},
+		// Solved within 2 hours 10 days ago, from before the history was kept
+		{ID: 4, Severity: db.SeverityMinor, ServiceIDs: []int64{1}, CreatedAt: &oldCreated, IsSolved: true, ResolvedAt: &oldResolved},
+	}
+	events := []db.ReportEvent{
+		event(1, ago(5*time.Hour), db.EventCreated, false),
+		event(1, ago(3*time.Hour), db.EventSolved, true),
+		event(1, ago(2*time.Hour), db.EventReopened, false),
+		event(2, ago(4*time.Hour), db.EventCreated, false),
+		event(2, ago(time.Hour), db.EventSolved, true),
+		event(3, ago(10*time.Hour), db.EventCreated, false),
+	}
+	services := []db.Service{{ID: 1, Name: "API"}, {ID: 2, Name: "Poczta"}, {ID: 3, Name: "VPN"}}
+
+	stats := Compute(reports, events, services, now)
+
+	hour := int64(time.Hour.Seconds())
+	tests := []struct {
+		name    string
+		summary Summary
+		window  string
+		want    WindowStats
+	}{
+		{"overall", stats.Overall, "24h", WindowStats{Window: "24h", DowntimeSeconds: 5 * hour, DowntimePercent: 100 * 5.0 / 24, Incidents: 3, MTTRSeconds: 5 * hour / 2}},
+		{"overall", stats.Overall, "7d", WindowStats{Window: "7d", DowntimeSeconds: 5 * hour, DowntimePercent: 100 * 5.0 / (7 * 24), Incidents: 3, MTTRSeconds: 5 * hour / 2}},
+		{"overall", stats.Overall, "30d", WindowStats{Window: "30d", DowntimeSeconds: 7 * hour, DowntimePercent: 100 * 7.0 / (30 * 24), Incidents: 4, MTTRSeconds: 7 * hour / 3}},
+		{"API", serviceSummary(t, stats, 1), "24h", WindowStats{Window: "24h", DowntimeSeconds: 4 * hour, DowntimePercent: 100 * 4.0 / 24, Incidents: 2, MTTRSeconds: 2 * hour}},
+		{"API", serviceSummary(t, stats, 1), "30d", WindowStats{Window: "30d", DowntimeSeconds: 6 * hour, DowntimePercent: 100 * 6.0 / (30 * 24), Incidents: 3, MTTRSeconds: 2 * hour}},
+		{"Poczta", serviceSummary(t, stats, 2), "24h", WindowStats{Window: "24h", DowntimeSeconds: 3 * hour, DowntimePercent: 100 * 3.0 / 24, Incidents: 1, MTTRSeconds: 3 * hour}},
+		{"VPN", serviceSummary(t, stats, 3), "90d", WindowStats{Window: "90d"}},
+	}
+	for _, tt := range tests {
+		got := tt.summary.Window(tt.window)
+		tt.want.UptimePercent = 100 - tt.want.DowntimePercent
+		if !almostEqual(got, tt.want) {
+			t.Errorf("%s over %s = %+v, want %+v", tt.name, tt.window, got, tt.want)
+		}
+	}
+
+	days := stats.Overall.Days
+	if len(days) != HistoryDays {
+		t.Fatalf("got %d days, want %d", len(days), HistoryDays)
+	}
+	today, old := days[len(days)-1], days[len(days)-11]
+	if today.Date != "2026-06-15" || today.DowntimeSeconds != 5*hour || today.Incidents != 3 {
+		t.Errorf("today = %+v, want 5 hours of downtime and 3 incidents", today)
+	}
+	if old.Date != "2026-06-05" || old.DowntimeSeconds != 2*hour || old.Incidents != 1 {
+		t.Errorf("10 days ago = %+v, want 2 hours of downtime and 1 incident", old)
+	}
+}
+
+// serviceSummary returns the statistics of the service, which have to be there.
+func serviceSummary(t *testing.T, stats Stats, id int64) Summary {
+	t.Helper()
+	service, ok := stats.Service(id)
+	if !ok {
+		t.Fatalf("no statistics of service %d", id)
+	}
+	return service.Summary
+}
+
+// almostEqual compares the statistics, allowing for rounding of the percentages.
+func almostEqual(a, b WindowStats) bool {
+	near := func(x, y float64) bool { return x-y < 1e-9 && y-x < 1e-9 }
+	return near(a.DowntimePercent, b.DowntimePercent) && near(a.UptimePercent, b.UptimePercent) &&
+		a.Window == b.Window && a.DowntimeSeconds == b.DowntimeSeconds && a.Incidents == b.Incidents && a.MTTRSeconds == b.MTTRSeconds
+}
+
+func TestDaysAcrossDST(t *testing.T) {
+	useLocal(t, "Europe/Warsaw")
+	local := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name string
+		// The incident lasts from the start of the first day to the end of the last one, until now at noon the day after.
+		from, to, now time.Time
+		want          []Day
+	}{
+		{
+			name: "clocks forward",
+			from: local(2026, 3, 28, 0), to: local(2026, 3, 30, 0), now: local(2026, 3, 30, 12),
+			want: []Day{
+				{Date: "2026-03-28", DowntimeSeconds: 24 * 3600, Incidents: 1},
+				{Date: "2026-03-29", DowntimeSeconds: 23 * 3600},
+				{Date: "2026-03-30"},
+			},
+		},
+		{
+			name: "clocks back",
+			from: local(2026, 10, 24, 0), to: local(2026, 10, 26, 0), now: local(2026, 10, 26, 12),
+			want: []Day{
+				{Date: "2026-10-24", DowntimeSeconds: 24 * 3600, Incidents: 1},
+				{Date: "2026-10-25", DowntimeSeconds: 25 * 3600},
+				{Date: "2026-10-26"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := summarize([]interval{{start: tt.from.UTC(), end: tt.to.UTC(), solved: true}}, tt.now.UTC())
+			got := summary.Days[len(summary.Days)-len(tt.want):]
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			for i := 1; i < len(summary.Days); i++ {
+				if summary.Days[i].Date <= summary.Days[i-1].Date {
+					t.Fatalf("day %s follows %s", summary.Days[i].Date, summary.Days[i-1].Date)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+// Package trash purges the deleted reports for good once they've stayed in the trash for the retention period.
+package trash
+
+import (
+	"context"
+	"example/downdetector/internal/db"
+	"example/downdetector/internal/utils"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// interval is how often the trash is checked for reports to purge.
+// Retention is counted in days, so purging up to an hour late doesn't matter.
+const interval = time.Hour
+
+// Purger removes the reports which were deleted longer than the retention period ago.
+type Purger struct {
+	retention time.Duration
+}
+
+// New creates a purger keeping the deleted reports for the given number of days.
+func New(days int) *Purger {
+	return &Purger{retention: time.Duration(days) * 24 * time.Hour}
+}
+
+// Run purges the trash right away and then every interval, until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge(time.Now().UTC())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purge removes the reports which were deleted longer than the retention period before the given time.
+func (p *Purger) purge(at time.Time) {
+	purged, err := db.DB.PurgeReports(at.Add(-p.retention))
+	if err != nil {
+		log.Error("Failed to purge the trash", "err", err)
+		return
+	}
+	for _, report := range purged {
+		utils.NoReportLog.Infof("purged report %d deleted by %s at %s", report.ID, report.DeletedBy, report.DeletedAt.Format(time.RFC3339))
+	}
+}
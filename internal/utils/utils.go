@@ -1,32 +1,38 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/json"
 	"io"
-	"math/rand"
+	"math/big"
+	"net/http"
 	"os"
-	"time"
 
 	"github.com/charmbracelet/log"
 )
 
 const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
-var seededRand *rand.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
-
 var NoReportLog = log.New(os.Stderr)
 
-// GenerateRandomString generates a random string of the specified length.
+// GenerateRandomString generates a cryptographically secure random string of the specified length.
 func GenerateRandomString(length int) string {
 	b := make([]byte, length)
+	max := big.NewInt(int64(len(charset)))
 	for i := range b {
-		b[i] = charset[seededRand.Intn(len(charset))]
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = charset[n.Int64()]
 	}
 	return string(b)
 }
 
-func SetupLogging() *os.File {
+// SetupLogging sends the logs both to stdout and to the file at path.
+func SetupLogging(path string) *os.File {
 	// log.SetLevel(log.DebugLevel) // for developement purpose
-	logFile, err := os.OpenFile("log.txt", os.O_CREATE|os.O_APPEND|os.O_RDWR, 0666)
+	logFile, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0666)
 	if err != nil {
 		panic(err)
 	}
@@ -40,3 +46,12 @@ func SetupLogging() *os.File {
 
 	return logFile
 }
+
+// WriteJSON writes v as a JSON response with the given status code.
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error("Failed to encode JSON response", "err", err)
+	}
+}
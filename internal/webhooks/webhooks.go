@@ -0,0 +1,249 @@
+// Package webhooks sends report events to the webhooks set up by admins.
+// Every event is queued in the database as a delivery to each webhook that wants it, and a worker sends the deliveries
+// in the background, retrying failed ones with exponential backoff. Queued deliveries survive restarts.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"example/downdetector/internal/broadcast"
+	"example/downdetector/internal/db"
+	"example/downdetector/internal/utils"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// Headers sent with every delivery.
+const (
+	// SignatureHeader holds "sha256=" followed by the hex HMAC-SHA256 of the body keyed with the webhook secret.
+	SignatureHeader = "X-Noticeboard-Signature"
+	EventHeader     = "X-Noticeboard-Event"
+	DeliveryHeader  = "X-Noticeboard-Delivery"
+)
+
+const (
+	// MaxAttempts is the number of attempts after which a delivery is given up on.
+	MaxAttempts = 8
+	// firstRetry is the delay before the second attempt, which doubles with every further attempt.
+	firstRetry = 30 * time.Second
+	maxRetry   = time.Hour
+	// pollInterval is how often the queue is checked for deliveries which are due.
+	pollInterval = 5 * time.Second
+	// batchSize is the number of due deliveries picked up at once.
+	batchSize      = 20
+	requestTimeout = 10 * time.Second
+	// maxErrorLength caps the error, including a part of the response body, kept in the delivery log.
+	maxErrorLength = 500
+)
+
+// Payload is the JSON body sent to webhooks.
+type Payload struct {
+	// Event is the type of the event, e.g. report.created.
+	Event     string    `json:"event"`
+	Timestamp time.Time `json:"timestamp"`
+	// Data is the report, or the incident update for update.posted.
+	Data any `json:"data"`
+}
+
+// Worker sends the queued deliveries.
+type Worker struct {
+	client *http.Client
+	// wake makes the worker check the queue right away.
+	wake chan struct{}
+}
+
+// New creates a worker.
+func New() *Worker {
+	return &Worker{
+		client: &http.Client{Timeout: requestTimeout},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Sign returns the signature of the body sent in SignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns how long to wait before retrying a delivery which failed the given number of times.
+func Backoff(attempts int) time.Duration {
+	delay := firstRetry
+	for i := 1; i < attempts && delay < maxRetry; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetry)
+}
+
+// Run queues the published events and sends the deliveries until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	stopListening := broadcast.Listen(w.queue)
+	defer stopListening()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		w.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+// queue queues a delivery of the event to every webhook which wants it.
+// It's called by the broker while the event is published, so it only touches the database.
+func (w *Worker) queue(event broadcast.Event) {
+	webhooks, err := db.DB.Webhooks()
+	if err != nil {
+		log.Error("Failed to select webhooks", "event", event.Type, "err", err)
+		return
+	}
+
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	payload, err := json.Marshal(Payload{Event: event.Type, Timestamp: createdAt, Data: event.Data})
+	if err != nil {
+		log.Error("Failed to encode webhook payload", "event", event.Type, "err", err)
+		return
+	}
+
+	queued := false
+	for _, webhook := range webhooks {
+		if !webhook.Wants(event.Type) {
+			continue
+		}
+		_, err := db.DB.QueueDelivery(db.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			Event:         event.Type,
+			Payload:       payload,
+			Status:        db.DeliveryPending,
+			CreatedAt:     createdAt,
+			NextAttemptAt: &createdAt,
+		})
+		if err != nil {
+			log.Error("Failed to queue webhook delivery", "webhook", webhook.ID, "event", event.Type, "err", err)
+			continue
+		}
+		queued = true
+	}
+
+	if queued {
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// deliverDue sends the deliveries which are due, until none are left or ctx is cancelled.
+func (w *Worker) deliverDue(ctx context.Context) {
+	attempted := map[int64]bool{}
+	for ctx.Err() == nil {
+		deliveries, err := db.DB.DueDeliveries(time.Now().UTC(), batchSize)
+		if err != nil {
+			log.Error("Failed to select due webhook deliveries", "err", err)
+			return
+		}
+
+		for _, delivery := range deliveries {
+			// A delivery which is still due couldn't be updated, leave it for the next round
+			if ctx.Err() != nil || attempted[delivery.ID] {
+				return
+			}
+			attempted[delivery.ID] = true
+			w.attempt(ctx, delivery)
+		}
+		if len(deliveries) < batchSize {
+			return
+		}
+	}
+}
+
+// attempt sends the delivery once and records the outcome.
+func (w *Worker) attempt(ctx context.Context, delivery db.WebhookDelivery) {
+	webhook, err := db.DB.Webhook(delivery.WebhookID)
+	if err != nil {
+		// A webhook deleted in the meantime takes its deliveries with it
+		log.Error("Failed to select webhook", "webhook", delivery.WebhookID, "err", err)
+		return
+	}
+
+	status, err := w.send(ctx, webhook, delivery)
+	// Attempts interrupted by a shutdown are repeated after the restart
+	if ctx.Err() != nil {
+		return
+	}
+
+	attemptedAt := time.Now().UTC().Truncate(time.Second)
+	delivery.Attempts++
+	delivery.LastAttemptAt = &attemptedAt
+	delivery.ResponseStatus = status
+	delivery.Error = ""
+	delivery.NextAttemptAt = nil
+	switch {
+	case err == nil:
+		delivery.Status = db.DeliveryDelivered
+	case delivery.Attempts >= MaxAttempts:
+		delivery.Status = db.DeliveryFailed
+		delivery.Error = err.Error()
+	default:
+		next := attemptedAt.Add(Backoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+		delivery.Error = err.Error()
+	}
+
+	if err != nil {
+		utils.NoReportLog.Warn("Webhook delivery failed", "webhook", webhook.ID, "delivery", delivery.ID, "attempts", delivery.Attempts, "err", err)
+	}
+	if err := db.DB.SaveDeliveryAttempt(delivery); err != nil {
+		log.Error("Failed to update webhook delivery", "delivery", delivery.ID, "err", err)
+	}
+}
+
+// send posts the payload of the delivery to the webhook and returns the response status.
+// Any status other than 2xx is an error.
+func (w *Worker) send(ctx context.Context, webhook db.Webhook, delivery db.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "noticeboard-webhooks")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, fmt.Sprint(delivery.ID))
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, delivery.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, deliveryError(err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorLength))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, deliveryError(fmt.Sprintf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(body)))
+	}
+	return resp.StatusCode, nil
+}
+
+// deliveryError returns the error of a failed delivery, with the message cut down to maxErrorLength.
+func deliveryError(msg string) error {
+	if len(msg) > maxErrorLength {
+		msg = strings.ToValidUTF8(msg[:maxErrorLength], "") + "…"
+	}
+	return errors.New(msg)
+}
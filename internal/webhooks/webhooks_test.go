@@ -0,0 +1,222 @@
+package webhooks
+
+import (
+	"context"
+	"example/downdetector/internal/config"
+	"example/downdetector/internal/db"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestSign(t *testing.T) {
+	// Test case 2 of RFC 4231
+	got := Sign("Jefe", []byte("what do ya want for nothing?"))
+	want := "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{5, 8 * time.Minute},
+		{6, 16 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{20, time.Hour},
+		{1000, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// receiver is a local webhook endpoint answering with the queued statuses, 200 once they run out.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	rc := &receiver{statuses: statuses}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rc.mu.Lock()
+		rc.requests = append(rc.requests, r)
+		rc.bodies = append(rc.bodies, string(body))
+		status := http.StatusOK
+		if len(rc.statuses) > 0 {
+			status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+		}
+		rc.mu.Unlock()
+
+		w.WriteHeader(status)
+		// A long body, which has to be cut down in the delivery log
+		w.Write([]byte(strings.Repeat("błąd ", 200)))
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+// received returns the number of requests the receiver got.
+func (rc *receiver) received() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.requests)
+}
+
+// setup connects the worker to an empty in-memory store with a webhook of the receiver and a queued delivery to it.
+func setup(t *testing.T, rc *receiver) db.WebhookDelivery {
+	t.Helper()
+	if err := db.Open(config.Config{DBDriver: config.DriverMemory}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DB.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+
+	at := time.Now().UTC().Truncate(time.Second)
+	webhook, err := db.DB.CreateWebhook(db.Webhook{URL: rc.URL, Secret: "sekret", CreatedAt: at})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivery, err := db.DB.QueueDelivery(db.WebhookDelivery{
+		WebhookID:     webhook.ID,
+		Event:         "report.created",
+		Payload:       []byte(`{"event":"report.created"}`),
+		Status:        db.DeliveryPending,
+		CreatedAt:     at,
+		NextAttemptAt: &at,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return delivery
+}
+
+func TestDeliverySigned(t *testing.T) {
+	rc := newReceiver(t)
+	delivery := setup(t, rc)
+
+	New().deliverDue(context.Background())
+
+	if rc.received() != 1 {
+		t.Fatalf("got %d requests, want 1", rc.received())
+	}
+	r, body := rc.requests[0], rc.bodies[0]
+	if body != string(delivery.Payload) {
+		t.Errorf("body = %s, want %s", body, delivery.Payload)
+	}
+	headers := map[string]string{
+		"Content-Type":  "application/json",
+		SignatureHeader: Sign("sekret", []byte(body)),
+		EventHeader:     "report.created",
+		DeliveryHeader:  strconv.FormatInt(delivery.ID, 10),
+	}
+	for name, want := range headers {
+		if got := r.Header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	saved, err := db.DB.Delivery(delivery.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != db.DeliveryDelivered || saved.Attempts != 1 || saved.ResponseStatus != http.StatusOK || saved.NextAttemptAt != nil {
+		t.Errorf("delivery = %+v, want it delivered at the first attempt", saved)
+	}
+}
+
+func TestDeliveryRetriedAndGivenUp(t *testing.T) {
+	statuses := make([]int, MaxAttempts+1)
+	for i := range statuses {
+		statuses[i] = http.StatusInternalServerError
+	}
+	rc := newReceiver(t, statuses...)
+	delivery := setup(t, rc)
+	w := New()
+
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		w.attempt(context.Background(), delivery)
+		saved, err := db.DB.Delivery(delivery.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.Attempts != attempt || saved.ResponseStatus != http.StatusInternalServerError || saved.LastAttemptAt == nil {
+			t.Fatalf("after attempt %d: %+v", attempt, saved)
+		}
+		if !strings.HasPrefix(saved.Error, "unexpected status 500 Internal Server Error: błąd") ||
+			len(saved.Error) > maxErrorLength+len("…") || !utf8.ValidString(saved.Error) {
+			t.Errorf("after attempt %d: error %q isn't cut down to %d bytes", attempt, saved.Error, maxErrorLength)
+		}
+
+		if attempt < MaxAttempts {
+			if saved.Status != db.DeliveryPending || saved.NextAttemptAt == nil || !saved.NextAttemptAt.Equal(saved.LastAttemptAt.Add(Backoff(attempt))) {
+				t.Errorf("after attempt %d: %+v, want it retried in %s", attempt, saved, Backoff(attempt))
+			}
+		} else if saved.Status != db.DeliveryFailed || saved.NextAttemptAt != nil {
+			t.Errorf("after the last attempt: %+v, want it given up on", saved)
+		}
+		delivery = saved
+	}
+
+	// Given up deliveries are never due again
+	due, err := db.DB.DueDeliveries(time.Now().Add(24*time.Hour), batchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Errorf("failed delivery still due: %+v", due)
+	}
+	if rc.received() != MaxAttempts {
+		t.Errorf("got %d requests, want %d", rc.received(), MaxAttempts)
+	}
+}
+
+func TestDeliverySucceedsOnRetry(t *testing.T) {
+	rc := newReceiver(t, http.StatusServiceUnavailable)
+	delivery := setup(t, rc)
+	w := New()
+
+	w.deliverDue(context.Background())
+	// Not due again until the backoff passes
+	w.deliverDue(context.Background())
+	if rc.received() != 1 {
+		t.Fatalf("got %d requests before the retry was due, want 1", rc.received())
+	}
+
+	saved, err := db.DB.Delivery(delivery.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.attempt(context.Background(), saved)
+	saved, err = db.DB.Delivery(delivery.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != db.DeliveryDelivered || saved.Attempts != 2 || saved.Error != "" || saved.NextAttemptAt != nil {
+		t.Errorf("delivery = %+v, want it delivered at the second attempt", saved)
+	}
+}
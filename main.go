@@ -1,8 +1,12 @@
 package main
 
 import (
+	"errors"
 	"example/downdetector/internal/app"
+	"example/downdetector/internal/config"
 	"example/downdetector/internal/utils"
+	"flag"
+	"os"
 
 	"github.com/charmbracelet/log"
 )
@@ -20,12 +24,54 @@ import (
 // @Router /api
 
 func main() {
-	logFile := utils.SetupLogging()
+	// Manage the database schema instead of starting the server.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := app.RunMigrate(os.Args[2:])
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		if err != nil {
+			log.Fatal("Migration failed", "err", err)
+		}
+		return
+	}
+
+	// Load the configuration from the config file, environment and flags.
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		log.Fatal("Invalid configuration", "err", err)
+	}
+
+	logFile := utils.SetupLogging(cfg.LogPath)
 	// Initialize the HTTP server.
-	srv := app.SetupServer()
+	srv := app.SetupServer(cfg)
 
 	// Connect to the database.
-	err := app.ConnectDB()
+	err = app.ConnectDB()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Start emailing subscribers first, so it's stopped last and sends what the other workers cause on shutdown.
+	err = app.StartNotifications()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Start sending report events to webhooks, before the checks can open any reports.
+	app.StartWebhooks()
+
+	// Start and complete maintenance windows on schedule.
+	app.StartMaintenance()
+
+	// Purge the reports which stayed in the trash past the retention period.
+	app.StartTrash()
+
+	// Start probing the configured health checks.
+	err = app.StartChecks()
 	if err != nil {
 		log.Fatal(err)
 	}
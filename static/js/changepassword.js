@@ -20,10 +20,7 @@ document.addEventListener('DOMContentLoaded', function() {
             event.stopPropagation()
           }
           else {
-              getSalt().then(salt => {
-              var encPass = encryptPassword(salt)
-              fetchForm(encPass)
-              })
+            fetchForm()
           }
 
           form.classList.add('was-validated')
@@ -32,13 +29,6 @@ document.addEventListener('DOMContentLoaded', function() {
     })()
 });
 
-function encryptPassword(salt) {
-  var password = document.getElementById("floatingPassword").value;
-
-  var encryptedPassword = CryptoJS.SHA256(password + salt).toString(CryptoJS.enc.Hex);
-  return encryptedPassword
-}
-
 function samePassword() {
   var pass2 = document.getElementById("floatingPassword2");
 
@@ -54,8 +44,9 @@ function samePassword() {
   return false
 }
 
-function fetchForm(password) {
+function fetchForm() {
   const username = document.getElementById("floatingInput").value;
+  const password = document.getElementById("floatingPassword").value;
   const form = document.getElementById("loginForm");
 
   fetch(form.action, {
@@ -68,7 +59,7 @@ function fetchForm(password) {
   })
     .then(response => {
       console.log(response.status);
-      if (response.status === 403) {
+      if (response.status === 400 || response.status === 403) {
         const errorMessage = document.getElementById('error-message');
         errorMessage.classList.remove('d-none');
       } else if (response.ok) {
@@ -86,22 +77,3 @@ function fetchForm(password) {
       console.error('Error during fetch:', error);
     });
 };
-
-async function getSalt() {
-  const username = document.getElementById("floatingInput").value;
-
-  const response = await fetch("/api/salt", {
-    method: "GET",
-    headers: { "username": username },
-  });
-
-  if (!response.ok) {
-    console.error('Getting salt failed with status: ', response.status)
-  }
-  else {
-    var salt = await response.text();
-    return salt
-  }
-}
-
-
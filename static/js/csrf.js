@@ -0,0 +1,28 @@
+// Sends the CSRF token of the session along every request changing something, which the server requires from logged-in users.
+(() => {
+  'use strict'
+
+  const token = () => {
+    const cookie = document.cookie.split('; ').find(c => c.startsWith('csrf_token='));
+    return cookie ? decodeURIComponent(cookie.substring('csrf_token='.length)) : '';
+  };
+
+  const send = window.fetch;
+  window.fetch = (resource, options = {}) => {
+    const request = resource instanceof Request ? resource : null;
+    const method = (options.method || (request ? request.method : 'GET')).toUpperCase();
+    // The token must never leave the app, so it's only added to requests to the app itself
+    const sameOrigin = new URL(request ? request.url : resource, window.location.href).origin === window.location.origin;
+    if (sameOrigin && !['GET', 'HEAD', 'OPTIONS'].includes(method) && token()) {
+      const headers = new Headers(options.headers || (request ? request.headers : undefined));
+      headers.set('X-CSRF-Token', token());
+      options = { ...options, headers };
+    }
+    return send(resource, options);
+  };
+
+  // Forms submitted without scripts, like the one logging out, carry the token in a hidden field
+  document.addEventListener('submit', event => {
+    event.target.querySelectorAll('input[name="csrf_token"]').forEach(input => input.value = token());
+  }, true);
+})();
@@ -16,12 +16,7 @@ document.addEventListener('DOMContentLoaded', function() {
             event.stopPropagation()
           }
           else {
-            getSalt().then(salt =>{
-              getPepper().then(pepper => {
-                var encPass = encryptPassword(salt, pepper)
-                fetchForm(encPass, pepper)
-              })
-            })
+            fetchForm()
           }
 
           form.classList.add('was-validated')
@@ -30,16 +25,9 @@ document.addEventListener('DOMContentLoaded', function() {
     })()
 });
 
-function encryptPassword(salt, pepper) {
-  var password = document.getElementById("floatingPassword").value;
-
-  var encryptedPassword = CryptoJS.SHA256(password + salt).toString(CryptoJS.enc.Hex);
-  var encryptedWithPepper = CryptoJS.SHA256(encryptedPassword + pepper).toString(CryptoJS.enc.Hex);
-  return encryptedWithPepper
-}
-
-function fetchForm(password, pepper) {
+function fetchForm() {
   const username = document.getElementById("floatingInput").value;
+  const password = document.getElementById("floatingPassword").value;
   const form = document.getElementById("loginForm");
 
   fetch(form.action, {
@@ -48,13 +36,20 @@ function fetchForm(password, pepper) {
     headers: {
       'Content-Type': 'application/json'
     },
-    body: JSON.stringify({ username, password, pepper })
+    body: JSON.stringify({ username, password })
   })
     .then(response => {
       console.log(response.status);
+      const throttledMessage = document.getElementById('throttled-message');
+      throttledMessage.classList.add('d-none');
       if (response.status === 403) {
         const errorMessage = document.getElementById('error-message');
         errorMessage.classList.remove('d-none');
+      } else if (response.status === 429) {
+        const seconds = Number(response.headers.get('Retry-After'));
+        const wait = seconds >= 60 ? Math.ceil(seconds / 60) + ' min' : seconds + ' s';
+        throttledMessage.textContent = 'Zbyt wiele nieudanych prób logowania. Spróbuj ponownie za ' + wait + '.';
+        throttledMessage.classList.remove('d-none');
       } else if (response.ok) {
         window.location.href = response.headers.get("Location");
       } else {
@@ -70,34 +65,3 @@ function fetchForm(password, pepper) {
       console.error('Error during fetch:', error);
     });
 };
-
-async function getSalt() {
-  const username = document.getElementById("floatingInput").value;
-
-  const response = await fetch("/api/salt", {
-    method: "GET",
-    headers: { "username": username },
-  });
-
-  if (!response.ok) {
-    console.error('Getting salt failed with status: ', response.status)
-  }
-  else {
-    var salt = await response.text();
-    return salt
-  }
-}
-
-async function getPepper() {
-  const username = document.getElementById("floatingInput").value;
-
-  const response = await fetch("/api/pepper", {});
-
-  if (!response.ok) {
-    console.error('Getting pepper failed with status: ', response.status)
-  }
-  else {
-    var pepper = await response.text();
-    return pepper
-  }
-}
@@ -0,0 +1,63 @@
+document.addEventListener('DOMContentLoaded', function() {
+  document.getElementById("floatingCode").focus();
+
+    // Prevent form submission when not all fields are validated
+    (() => {
+      'use strict'
+
+      // Fetch all the forms we want to apply custom Bootstrap validation styles to
+      const forms = document.querySelectorAll('.needs-validation')
+
+      // Loop over them and prevent submission
+      Array.from(forms).forEach(form => {
+        form.addEventListener('submit', event => {
+          event.preventDefault();
+          if (!form.checkValidity()) {
+            event.stopPropagation()
+          }
+          else {
+            fetchForm()
+          }
+
+          form.classList.add('was-validated')
+        }, false)
+      })
+    })()
+});
+
+function fetchForm() {
+  const code = document.getElementById("floatingCode").value;
+  const form = document.getElementById("loginForm");
+
+  fetch(form.action, {
+    method: form.method,
+    redirect: "error",
+    headers: {
+      'Content-Type': 'application/json'
+    },
+    body: JSON.stringify({ code })
+  })
+    .then(response => {
+      const throttledMessage = document.getElementById('throttled-message');
+      const errorMessage = document.getElementById('error-message');
+      throttledMessage.classList.add('d-none');
+      errorMessage.classList.add('d-none');
+      if (response.status === 401) {
+        document.getElementById('expired-message').classList.remove('d-none');
+      } else if (response.status === 403) {
+        errorMessage.classList.remove('d-none');
+      } else if (response.status === 429) {
+        const seconds = Number(response.headers.get('Retry-After'));
+        const wait = seconds >= 60 ? Math.ceil(seconds / 60) + ' min' : seconds + ' s';
+        throttledMessage.textContent = 'Zbyt wiele nieudanych prób logowania. Spróbuj ponownie za ' + wait + '.';
+        throttledMessage.classList.remove('d-none');
+      } else if (response.ok) {
+        window.location.href = response.headers.get("Location");
+      } else {
+        console.error('Login failed with status:', response.status);
+      }
+    })
+    .catch(error => {
+      console.error('Error during fetch:', error);
+    });
+};